@@ -0,0 +1,21 @@
+package endpoints
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenAuth accepts the requests with the token in the bearer authorization header
+func TokenAuth(token string) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		t, ok := strings.CutPrefix(gc.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(t), []byte(token)) != 1 {
+			gc.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		gc.Next()
+	}
+}
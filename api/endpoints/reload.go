@@ -0,0 +1,18 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reload reloads the config of the server, the current config is kept if the new one is invalid
+func Reload(reload func(done <-chan struct{}) error) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		if err := reload(gc.Request.Context().Done()); err != nil {
+			gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		gc.JSON(http.StatusOK, gin.H{"status": "reloaded"})
+	}
+}
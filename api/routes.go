@@ -7,9 +7,10 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/nixys/nxs-backup/api/endpoints"
+	"github.com/nixys/nxs-backup/api/ui"
 )
 
-func RoutesSet(log *logrus.Logger, reg *prometheus.Registry) *gin.Engine {
+func RoutesSet(log *logrus.Logger, reg *prometheus.Registry, webUI *ui.UI, apiToken string, reload func(done <-chan struct{}) error) *gin.Engine {
 
 	gin.SetMode(gin.ReleaseMode)
 
@@ -26,5 +27,17 @@ func RoutesSet(log *logrus.Logger, reg *prometheus.Registry) *gin.Engine {
 		),
 	))
 
+	// the API manages the server, so it's available only with the token set
+	if apiToken != "" {
+		apiGroup := router.Group("/api", endpoints.TokenAuth(apiToken))
+		if reload != nil {
+			apiGroup.POST("/reload", endpoints.Reload(reload))
+		}
+	}
+
+	if webUI != nil {
+		webUI.RoutesSet(router)
+	}
+
 	return router
 }
@@ -0,0 +1,393 @@
+package ui
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/nixys/nxs-backup/interfaces"
+	"github.com/nixys/nxs-backup/misc"
+	"github.com/nixys/nxs-backup/modules/metrics"
+	"github.com/nixys/nxs-backup/modules/storage"
+)
+
+//go:embed templates
+var templatesFS embed.FS
+
+const tokenCookie = "nxs_backup_token"
+
+// size of the log file tail the recent records are read from
+const logTailSize = 1 << 20
+
+type Opts struct {
+	Log            *logrus.Logger
+	MetricFilePath string
+	LogFile        string
+	LogRecords     int
+	Jobs           interfaces.Jobs
+	Username       string
+	Password       string
+	Token          string
+	// JobsMu guards the storages clients of the jobs, they aren't safe for concurrent use
+	JobsMu *sync.Mutex
+}
+
+// UI is the read-only status web interface of the server mode
+type UI struct {
+	log            *logrus.Logger
+	metricFilePath string
+	logFile        string
+	logRecords     int
+	jobs           map[string]interfaces.Job
+	username       string
+	password       string
+	token          string
+	pages          map[string]*template.Template
+	jobsMu         *sync.Mutex
+}
+
+func Init(o Opts) (*UI, error) {
+	if o.Token == "" && (o.Username == "" || o.Password == "") {
+		return nil, fmt.Errorf("web UI requires a token or a username and a password")
+	}
+
+	u := &UI{
+		log:            o.Log,
+		metricFilePath: o.MetricFilePath,
+		logFile:        o.LogFile,
+		logRecords:     o.LogRecords,
+		jobs:           make(map[string]interfaces.Job),
+		username:       o.Username,
+		password:       o.Password,
+		token:          o.Token,
+		pages:          make(map[string]*template.Template),
+		jobsMu:         o.JobsMu,
+	}
+	if u.jobsMu == nil {
+		u.jobsMu = &sync.Mutex{}
+	}
+	for _, j := range o.Jobs {
+		u.jobs[j.GetName()] = j
+	}
+
+	funcs := template.FuncMap{
+		"version":   func() string { return misc.VERSION },
+		"humanSize": func(s int64) string { return units.HumanSize(float64(s)) },
+	}
+	for _, p := range []string{"index", "job", "logs", "login"} {
+		t, err := template.New("layout.html").Funcs(funcs).ParseFS(templatesFS, "templates/layout.html", "templates/"+p+".html")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse web UI templates: %w", err)
+		}
+		u.pages[p] = t
+	}
+
+	return u, nil
+}
+
+// RoutesSet adds the UI pages protected by authentication to the router
+func (u *UI) RoutesSet(router *gin.Engine) {
+	g := router.Group("/ui", u.auth)
+	g.GET("/", u.index)
+	g.GET("/jobs/:name", u.job)
+	g.GET("/logs", u.logs)
+
+	router.GET("/ui/login", u.loginPage)
+	router.POST("/ui/login", u.login)
+
+	router.GET("/", func(gc *gin.Context) {
+		gc.Redirect(http.StatusFound, "/ui/")
+	})
+}
+
+// auth accepts the token in the bearer authorization header or the cookie set by the login form,
+// or the basic auth credentials. The token isn't accepted in the query string, so it never gets to the access log
+func (u *UI) auth(gc *gin.Context) {
+	if u.token != "" {
+		if t, ok := strings.CutPrefix(gc.GetHeader("Authorization"), "Bearer "); ok && equal(t, u.token) {
+			gc.Next()
+			return
+		}
+		if t, err := gc.Cookie(tokenCookie); err == nil && equal(t, u.token) {
+			gc.Next()
+			return
+		}
+	}
+	if u.username != "" {
+		if user, pass, ok := gc.Request.BasicAuth(); ok && equal(user, u.username) && equal(pass, u.password) {
+			gc.Next()
+			return
+		}
+		gc.Header("WWW-Authenticate", `Basic realm="nxs-backup"`)
+	} else if gc.Request.Method == http.MethodGet {
+		gc.Redirect(http.StatusFound, "/ui/login")
+		gc.Abort()
+		return
+	}
+	gc.AbortWithStatus(http.StatusUnauthorized)
+}
+
+type loginView struct {
+	Err string
+}
+
+func (u *UI) loginPage(gc *gin.Context) {
+	u.render(gc, "login", loginView{})
+}
+
+// login sets the cookie with the token posted by the login form
+func (u *UI) login(gc *gin.Context) {
+	t := gc.PostForm("token")
+	if u.token == "" || !equal(t, u.token) {
+		u.render(gc, "login", loginView{Err: "Invalid token"})
+		return
+	}
+	gc.SetSameSite(http.SameSiteStrictMode)
+	gc.SetCookie(tokenCookie, t, 0, "/ui", "", gc.Request.TLS != nil, true)
+	gc.Redirect(http.StatusFound, "/ui/")
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func (u *UI) render(gc *gin.Context, page string, data any) {
+	var buf bytes.Buffer
+	if err := u.pages[page].Execute(&buf, data); err != nil {
+		u.log.Errorf("ui: failed to render page %s: %v", page, err)
+		gc.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	gc.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+type jobView struct {
+	Name    string
+	Type    string
+	Targets []targetView
+}
+
+type targetView struct {
+	Name         string
+	Source       string
+	Status       string
+	Size         string
+	BackupTime   string
+	DeliveryTime string
+	LastRun      string
+	LastSuccess  string
+	Storages     []storageView
+}
+
+type storageView struct {
+	Name         string
+	Status       string
+	DeliveryTime string
+	LastSuccess  string
+	Backups      string
+	Usage        string
+}
+
+func (u *UI) index(gc *gin.Context) {
+	data, err := metrics.ReadFile(u.metricFilePath)
+	if err != nil {
+		u.log.Warnf("ui: failed to read metric file: %v", err)
+	}
+
+	var jobs []jobView
+	for name, j := range u.jobs {
+		jv := jobView{Name: name, Type: string(j.GetType())}
+		var jd metrics.JobData
+		if data != nil {
+			jd = data.Job[name]
+		}
+		for ofs, td := range jd.TargetMetrics {
+			jv.Targets = append(jv.Targets, newTargetView(ofs, td))
+		}
+		sort.Slice(jv.Targets, func(i, k int) bool { return jv.Targets[i].Name < jv.Targets[k].Name })
+		jobs = append(jobs, jv)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Name < jobs[k].Name })
+
+	page := struct {
+		Project string
+		Server  string
+		Jobs    []jobView
+	}{Jobs: jobs}
+	if data != nil {
+		page.Project, page.Server = data.Project, data.Server
+	}
+	u.render(gc, "index", page)
+}
+
+func newTargetView(ofs string, td metrics.TargetData) targetView {
+	v := td.Values
+	tv := targetView{
+		Name:         ofs,
+		Source:       td.Source,
+		Status:       status(v, metrics.BackupOk, metrics.DeliveryOk),
+		Size:         size(v, metrics.BackupSize),
+		BackupTime:   duration(v, metrics.BackupTime),
+		DeliveryTime: duration(v, metrics.DeliveryTime),
+		LastRun:      timestamp(v, metrics.BackupTimestamp),
+		LastSuccess:  timestamp(v, metrics.LastSuccess),
+	}
+	for name, sd := range td.Storages {
+		sv := storageView{
+			Name:         name,
+			Status:       status(sd.Values, metrics.DeliveryOk),
+			DeliveryTime: duration(sd.Values, metrics.DeliveryTime),
+			LastSuccess:  timestamp(sd.Values, metrics.LastSuccess),
+			Usage:        size(sd.Values, metrics.StorageUsage),
+		}
+		if n, ok := sd.Values[metrics.StorageBackups]; ok {
+			sv.Backups = fmt.Sprint(int(n))
+		}
+		tv.Storages = append(tv.Storages, sv)
+	}
+	sort.Slice(tv.Storages, func(i, k int) bool { return tv.Storages[i].Name < tv.Storages[k].Name })
+	return tv
+}
+
+func status(values map[string]float64, keys ...string) string {
+	for _, k := range keys {
+		v, ok := values[k]
+		if !ok {
+			return "unknown"
+		}
+		if v != 1 {
+			return "failed"
+		}
+	}
+	return "ok"
+}
+
+func size(values map[string]float64, key string) string {
+	if v, ok := values[key]; ok {
+		return units.HumanSize(v)
+	}
+	return ""
+}
+
+func duration(values map[string]float64, key string) string {
+	if v, ok := values[key]; ok {
+		return (time.Duration(v) * time.Millisecond).String()
+	}
+	return ""
+}
+
+func timestamp(values map[string]float64, key string) string {
+	if v, ok := values[key]; ok && v > 0 {
+		return time.Unix(int64(v), 0).Format("2006-01-02 15:04:05")
+	}
+	return ""
+}
+
+type backupsTarget struct {
+	Name     string
+	Storages []backupsStorage
+}
+
+type backupsStorage struct {
+	Name  string
+	Files []storage.BackupFile
+	Err   error
+}
+
+func (u *UI) job(gc *gin.Context) {
+	j, ok := u.jobs[gc.Param("name")]
+	if !ok {
+		gc.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	u.jobsMu.Lock()
+	jt := j.ListBackups()
+	u.jobsMu.Unlock()
+
+	var targets []backupsTarget
+	for tName, tOnSt := range jt {
+		bt := backupsTarget{Name: tName}
+		for st, tFiles := range tOnSt {
+			bt.Storages = append(bt.Storages, backupsStorage{Name: st, Files: tFiles.List, Err: tFiles.ListErr})
+		}
+		sort.Slice(bt.Storages, func(i, k int) bool { return bt.Storages[i].Name < bt.Storages[k].Name })
+		targets = append(targets, bt)
+	}
+	sort.Slice(targets, func(i, k int) bool { return targets[i].Name < targets[k].Name })
+
+	u.render(gc, "job", struct {
+		Name    string
+		Type    string
+		Targets []backupsTarget
+	}{j.GetName(), string(j.GetType()), targets})
+}
+
+func (u *UI) logs(gc *gin.Context) {
+	page := struct {
+		File    string
+		Records []string
+		Err     error
+	}{File: u.logFile}
+
+	page.Records, page.Err = tail(u.logFile, u.logRecords)
+	u.render(gc, "logs", page)
+}
+
+// tail returns the last n lines of the log file, the latest first
+func tail(path string, n int) ([]string, error) {
+	switch path {
+	case "", "stdout", "stderr", "journald":
+		return nil, fmt.Errorf("log records are available only if logs are written to a file")
+	}
+	if strings.HasPrefix(path, "syslog") {
+		return nil, fmt.Errorf("log records are available only if logs are written to a file")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := max(fi.Size()-logTailSize, 0)
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		// skip the partial line
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			b = b[i+1:]
+		}
+	}
+
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i, k := 0, len(lines)-1; i < k; i, k = i+1, k-1 {
+		lines[i], lines[k] = lines[k], lines[i]
+	}
+	return lines, nil
+}
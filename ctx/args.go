@@ -3,11 +3,13 @@ package ctx
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/alexflint/go-arg"
 
 	"github.com/nixys/nxs-backup/misc"
+	"github.com/nixys/nxs-backup/modules/cmd_handler/list_backups"
 )
 
 type command string
@@ -19,6 +21,7 @@ const (
 	update    command = "update"
 	lsBackups command = "ls_backups"
 	testCfg   command = "test_cfg"
+	checkSt   command = "check_storages"
 	unknown   command = "unknown"
 )
 
@@ -32,6 +35,7 @@ type ArgsParams struct {
 
 type StartCmd struct {
 	JobName string `arg:"positional" help:"Name of job or jobs group to run [default: all]" default:"all" placeholder:"JOB_NAME/GROUP_NAME"`
+	DryRun  bool   `arg:"--dry-run" help:"Show planned actions without dumping, uploading or deleting anything"`
 }
 
 // ServerCmd "Running the nxs-backup in server mode"
@@ -43,8 +47,20 @@ type GenerateCmd struct {
 	OutPath  string            `arg:"-O,--out-path" help:"Path to the generated configuration file" placeholder:"PATH"`
 }
 
+type ListBackupsCmd struct {
+	JobName string `arg:"positional" help:"Name of job or jobs group to list backups [default: all]" default:"all" placeholder:"JOB_NAME/GROUP_NAME"`
+	Output  string `arg:"-o,--output" help:"Output format: tree, json, yaml or csv" default:"tree" placeholder:"FORMAT"`
+}
+
 type ListCmd struct {
-	Backups *StartCmd `arg:"subcommand:backups"`
+	Backups *ListBackupsCmd `arg:"subcommand:backups"`
+}
+
+// CheckStoragesCmd "Checking of the storages used by jobs"
+type CheckStoragesCmd struct{}
+
+type CheckCmd struct {
+	Storages *CheckStoragesCmd `arg:"subcommand:storages" help:"Check connect, write, read, list and delete on the storages and report their free space"`
 }
 
 type UpdateCmd struct {
@@ -57,6 +73,7 @@ type args struct {
 	Generate *GenerateCmd `arg:"subcommand:generate"`
 	Update   *UpdateCmd   `arg:"subcommand:update"`
 	List     *ListCmd     `arg:"subcommand:ls"`
+	Check    *CheckCmd    `arg:"subcommand:check"`
 	ConfPath string       `arg:"-c,--config" help:"Path to config file" default:"/etc/nxs-backup/nxs-backup.conf" placeholder:"PATH"`
 	TestConf bool         `arg:"-t,--test-config" help:"Check if configuration correct"`
 }
@@ -92,6 +109,11 @@ func ReadArgs() (p ArgsParams, err error) {
 	p.CmdParams = curArgs.Subcommand()
 	p.Arg = curArgs
 
+	if lsCmd, ok := p.CmdParams.(*ListBackupsCmd); ok && !slices.Contains(list_backups.Outputs, lsCmd.Output) {
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown output format \"%s\", available formats: %s\n", lsCmd.Output, strings.Join(list_backups.Outputs, ", "))
+		return p, misc.ErrArg
+	}
+
 	return
 }
 
@@ -113,6 +135,8 @@ func getCmd(argCmd string) command {
 		return lsBackups
 	case testCfg:
 		return testCfg
+	case checkSt:
+		return checkSt
 	default:
 		return unknown
 	}
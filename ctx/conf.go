@@ -23,13 +23,43 @@ type ConfOpts struct {
 	StorageConnects []storageConnectConf `conf:"storage_connects"`
 	IncludeCfgs     []string             `conf:"include_jobs_configs"`
 	WaitingTimeout  time.Duration        `conf:"waiting_timeout"`
+	FreeSpaceCheck  string               `conf:"free_space_check" conf_extraopts:"default=warn"`
+
+	Server  serverConf  `conf:"server"`
+	Limits  *limitsConf `conf:"limits" conf_extraopts:"default={}"`
+	Tracing tracingConf `conf:"tracing"`
+	Vault   vaultConf   `conf:"vault"`
+
+	LogFile   string        `conf:"logfile" conf_extraopts:"default=stdout"`
+	LogLevel  string        `conf:"loglevel" conf_extraopts:"default=info"`
+	LogFormat string        `conf:"log_format" conf_extraopts:"default=text"`
+	LogRotate logRotateConf `conf:"log_rotate"`
+	ConfPath  string
+}
+
+type logRotateConf struct {
+	MaxSize    string `conf:"max_size"`
+	Period     string `conf:"period"`
+	MaxBackups int    `conf:"max_backups"`
+}
 
-	Server serverConf  `conf:"server"`
-	Limits *limitsConf `conf:"limits" conf_extraopts:"default={}"`
+type tracingConf struct {
+	Enabled  bool              `conf:"enabled" conf_extraopts:"default=false"`
+	Protocol string            `conf:"protocol" conf_extraopts:"default=grpc"`
+	Endpoint string            `conf:"endpoint" conf_extraopts:"default=localhost:4317"`
+	Insecure bool              `conf:"insecure" conf_extraopts:"default=true"`
+	Headers  map[string]string `conf:"headers"`
+}
 
-	LogFile  string `conf:"logfile" conf_extraopts:"default=stdout"`
-	LogLevel string `conf:"loglevel" conf_extraopts:"default=info"`
-	ConfPath string
+type vaultConf struct {
+	Address     string `conf:"address"`
+	Namespace   string `conf:"namespace"`
+	Token       string `conf:"token"`
+	RoleID      string `conf:"role_id"`
+	SecretID    string `conf:"secret_id"`
+	AuthMount   string `conf:"auth_mount" conf_extraopts:"default=approle"`
+	InsecureTLS bool   `conf:"insecure_tls" conf_extraopts:"default=false"`
+	Timeout     int    `conf:"timeout" conf_extraopts:"default=10"` // seconds
 }
 
 type limitsConf struct {
@@ -39,39 +69,124 @@ type limitsConf struct {
 }
 
 type serverConf struct {
-	Bind    string      `conf:"bind" conf_extraopts:"default=:7979"`
-	Metrics metricsConf `conf:"metrics"`
+	Bind     string      `conf:"bind" conf_extraopts:"default=:7979"`
+	APIToken string      `conf:"api_token"` // bearer token of the management API, the API is disabled without it
+	Metrics  metricsConf `conf:"metrics"`
+	UI       uiConf      `conf:"ui"`
+}
+
+type uiConf struct {
+	Enabled    bool   `conf:"enabled" conf_extraopts:"default=false"`
+	Username   string `conf:"username"`
+	Password   string `conf:"password"`
+	Token      string `conf:"token"`
+	LogRecords int    `conf:"log_records" conf_extraopts:"default=200"`
 }
 
 type metricsConf struct {
-	Enabled  bool   `conf:"enabled" conf_extraopts:"default=true"`
-	FilePath string `conf:"metrics_file_path" conf_extraopts:"default=/tmp/nxs-backup.metrics"`
+	Enabled  bool            `conf:"enabled" conf_extraopts:"default=true"`
+	FilePath string          `conf:"metrics_file_path" conf_extraopts:"default=/tmp/nxs-backup.metrics"`
+	Push     metricsPushConf `conf:"push"`
+	// seconds, storages are checked in server mode, 0 disables the checks
+	StorageCheckInterval int `conf:"storage_check_interval" conf_extraopts:"default=0"`
+}
+
+type metricsPushConf struct {
+	Enabled     bool              `conf:"enabled" conf_extraopts:"default=false"`
+	Type        string            `conf:"type" conf_extraopts:"default=pushgateway"`
+	URL         string            `conf:"url"`
+	Protocol    string            `conf:"protocol" conf_extraopts:"default=http"` // OTLP only
+	Username    string            `conf:"username"`
+	Password    string            `conf:"password"`
+	Headers     map[string]string `conf:"headers"`
+	InsecureTLS bool              `conf:"insecure_tls" conf_extraopts:"default=false"`
+	Timeout     int               `conf:"timeout" conf_extraopts:"default=10"` // seconds
 }
 
 type notificationsConf struct {
-	Mail     mailConf      `conf:"mail"`
-	Webhooks []webhookConf `conf:"webhooks"`
+	Mail       mailConf         `conf:"mail"`
+	Webhooks   []webhookConf    `conf:"webhooks"`
+	Telegram   []telegramConf   `conf:"telegram"`
+	Slack      []slackConf      `conf:"slack"`
+	Mattermost []mattermostConf `conf:"mattermost"`
+	Retry      retryConf        `conf:"retry"`
+	Outbox     outboxConf       `conf:"outbox"`
+}
+
+type retryConf struct {
+	Attempts     int `conf:"attempts" conf_extraopts:"default=3"`
+	InitialDelay int `conf:"initial_delay" conf_extraopts:"default=2"` // seconds
+	MaxDelay     int `conf:"max_delay" conf_extraopts:"default=60"`    // seconds
+}
+
+type outboxConf struct {
+	Enabled       bool   `conf:"enabled" conf_extraopts:"default=true"`
+	Path          string `conf:"path" conf_extraopts:"default=/var/lib/nxs-backup/outbox"`
+	MaxAge        int    `conf:"max_age" conf_extraopts:"default=72"`        // hours
+	FlushInterval int    `conf:"flush_interval" conf_extraopts:"default=60"` // seconds, used in server mode
 }
 
 type mailConf struct {
-	Enabled      bool     `conf:"enabled" conf_extraopts:"default=true"`
-	From         string   `conf:"mail_from"`
-	SmtpServer   string   `conf:"smtp_server"`
-	SmtpPort     int      `conf:"smtp_port"`
-	SmtpUser     string   `conf:"smtp_user"`
-	SmtpPassword string   `conf:"smtp_password"`
-	Recipients   []string `conf:"recipients"`
-	MessageLevel string   `conf:"message_level" conf_extraopts:"default=err"`
+	Enabled         bool     `conf:"enabled" conf_extraopts:"default=true"`
+	From            string   `conf:"mail_from"`
+	SmtpServer      string   `conf:"smtp_server"`
+	SmtpPort        int      `conf:"smtp_port"`
+	SmtpUser        string   `conf:"smtp_user"`
+	SmtpPassword    string   `conf:"smtp_password"`
+	Recipients      []string `conf:"recipients"`
+	MessageLevel    string   `conf:"message_level" conf_extraopts:"default=err"`
+	Mode            string   `conf:"mode" conf_extraopts:"default=per_event"`
+	SubjectTemplate string   `conf:"subject_template"`
+	BodyTemplate    string   `conf:"body_template"`
 }
 
 type webhookConf struct {
 	Enabled           bool                   `conf:"enabled" conf_extraopts:"default=true"`
 	WebhookURL        string                 `conf:"webhook_url" conf_extraopts:"required"`
-	PayloadMessageKey string                 `conf:"payload_message_key" conf_extraopts:"required"`
+	PayloadMessageKey string                 `conf:"payload_message_key"`
 	ExtraPayload      map[string]interface{} `conf:"extra_payload"`
 	ExtraHeaders      map[string]string      `conf:"extra_headers"`
 	InsecureTLS       bool                   `conf:"insecure_tls" conf_extraopts:"default=false"`
 	MessageLevel      string                 `conf:"message_level" conf_extraopts:"default=warn"`
+	Mode              string                 `conf:"mode" conf_extraopts:"default=per_event"`
+	MessageTemplate   string                 `conf:"message_template"`
+	PayloadTemplate   string                 `conf:"payload_template"`
+}
+
+type telegramConf struct {
+	Enabled         bool   `conf:"enabled" conf_extraopts:"default=true"`
+	APIURL          string `conf:"api_url" conf_extraopts:"default=https://api.telegram.org"`
+	BotToken        string `conf:"bot_token" conf_extraopts:"required"`
+	ChatID          string `conf:"chat_id" conf_extraopts:"required"`
+	ThreadID        int    `conf:"thread_id"`
+	InsecureTLS     bool   `conf:"insecure_tls" conf_extraopts:"default=false"`
+	MessageLevel    string `conf:"message_level" conf_extraopts:"default=warn"`
+	Mode            string `conf:"mode" conf_extraopts:"default=per_event"`
+	MessageTemplate string `conf:"message_template"`
+}
+
+type slackConf struct {
+	Enabled         bool   `conf:"enabled" conf_extraopts:"default=true"`
+	WebhookURL      string `conf:"webhook_url" conf_extraopts:"required"`
+	Channel         string `conf:"channel"`
+	Username        string `conf:"username"`
+	IconEmoji       string `conf:"icon_emoji"`
+	InsecureTLS     bool   `conf:"insecure_tls" conf_extraopts:"default=false"`
+	MessageLevel    string `conf:"message_level" conf_extraopts:"default=warn"`
+	Mode            string `conf:"mode" conf_extraopts:"default=per_event"`
+	MessageTemplate string `conf:"message_template"`
+}
+
+type mattermostConf struct {
+	Enabled         bool   `conf:"enabled" conf_extraopts:"default=true"`
+	WebhookURL      string `conf:"webhook_url" conf_extraopts:"required"`
+	Channel         string `conf:"channel"`
+	Username        string `conf:"username"`
+	IconURL         string `conf:"icon_url"`
+	InsecureTLS     bool   `conf:"insecure_tls" conf_extraopts:"default=false"`
+	MessageLevel    string `conf:"message_level" conf_extraopts:"default=warn"`
+	Mode            string `conf:"mode" conf_extraopts:"default=per_event"`
+	MessageTemplate string `conf:"message_template"`
 }
 
 type jobConf struct {
@@ -124,22 +239,35 @@ type sourceConnectConf struct {
 }
 
 type storageConf struct {
-	StorageName  string        `conf:"storage_name" conf_extraopts:"required"`
-	BackupPath   string        `conf:"backup_path" conf_extraopts:"required"`
-	EnableRotate bool          `conf:"enable_rotate" conf_extraopts:"default=true"`
-	Retention    retentionConf `conf:"retention" conf_extraopts:"required"`
+	StorageName  string         `conf:"storage_name" conf_extraopts:"required"`
+	BackupPath   string         `conf:"backup_path" conf_extraopts:"required"`
+	EnableRotate bool           `conf:"enable_rotate" conf_extraopts:"default=true"`
+	VolumeSize   string         `conf:"volume_size"`
+	Retention    retentionConf  `conf:"retention" conf_extraopts:"required"`
+	Repository   repositoryConf `conf:"repository"`
+}
+
+type repositoryConf struct {
+	Enabled      bool   `conf:"enabled" conf_extraopts:"default=false"`
+	AvgChunkSize string `conf:"avg_chunk_size" conf_extraopts:"default=1M"`
 }
 
 type retentionConf struct {
-	Days     int  `conf:"days" conf_extraopts:"default=7"`
-	Weeks    int  `conf:"weeks" conf_extraopts:"default=5"`
-	Months   int  `conf:"months" conf_extraopts:"default=12"`
-	UseCount bool `conf:"count_instead_of_period" conf_extraopts:"default=false"`
+	Hours      int  `conf:"hours" conf_extraopts:"default=0"`
+	Days       int  `conf:"days" conf_extraopts:"default=7"`
+	Weeks      int  `conf:"weeks" conf_extraopts:"default=5"`
+	Months     int  `conf:"months" conf_extraopts:"default=12"`
+	Years      int  `conf:"years" conf_extraopts:"default=0"`
+	UseCount   bool `conf:"count_instead_of_period" conf_extraopts:"default=false"`
+	DailyHour  int  `conf:"daily_backup_hour" conf_extraopts:"default=0"`
+	WeeklyDay  int  `conf:"weekly_backup_day" conf_extraopts:"default=0"`
+	MonthlyDay int  `conf:"monthly_backup_day" conf_extraopts:"default=1"`
 }
 
 type storageConnectConf struct {
 	Name         string          `conf:"name" conf_extraopts:"required"`
 	RateLimit    *string         `conf:"rate_limit"`
+	Retry        stRetryConf     `conf:"retry"`
 	S3Params     *s3ConnConf     `conf:"s3_params"`
 	ScpParams    *sftpConnConf   `conf:"scp_params"`
 	SftpParams   *sftpConnConf   `conf:"sftp_params"`
@@ -149,23 +277,38 @@ type storageConnectConf struct {
 	SmbParams    *smbConnConf    `conf:"smb_params"`
 }
 
+type stRetryConf struct {
+	Attempts     int      `conf:"attempts" conf_extraopts:"default=3"`
+	InitialDelay int      `conf:"initial_delay" conf_extraopts:"default=5"` // seconds
+	MaxDelay     int      `conf:"max_delay" conf_extraopts:"default=60"`    // seconds
+	RetryOn      []string `conf:"retry_on"`
+}
+
 type s3ConnConf struct {
-	BucketName    string `conf:"bucket_name" conf_extraopts:"required"`
-	AccessKeyID   string `conf:"access_key_id"`
-	SecretKey     string `conf:"secret_access_key"`
-	Endpoint      string `conf:"endpoint" conf_extraopts:"required"`
-	Region        string `conf:"region" conf_extraopts:"required"`
-	BatchDeletion bool   `conf:"batch_deletion" conf_extraopts:"default=true"`
-	Secure        bool   `conf:"secure" conf_extraopts:"default=true"`
+	BucketName     string `conf:"bucket_name" conf_extraopts:"required"`
+	AccessKeyID    string `conf:"access_key_id"`
+	SecretKey      string `conf:"secret_access_key"`
+	Endpoint       string `conf:"endpoint" conf_extraopts:"required"`
+	Region         string `conf:"region" conf_extraopts:"required"`
+	BatchDeletion  bool   `conf:"batch_deletion" conf_extraopts:"default=true"`
+	Secure         bool   `conf:"secure" conf_extraopts:"default=true"`
+	ObjectLockMode string `conf:"object_lock_mode"`
 }
 
 type sftpConnConf struct {
-	User           string        `conf:"user" conf_extraopts:"required"`
-	Host           string        `conf:"host" conf_extraopts:"required"`
-	Port           int           `conf:"port" conf_extraopts:"default=22"`
-	Password       string        `conf:"password"`
-	KeyFile        string        `conf:"key_file"`
-	ConnectTimeout time.Duration `conf:"connection_timeout" conf_extraopts:"default=10"`
+	User                  string        `conf:"user" conf_extraopts:"required"`
+	Host                  string        `conf:"host" conf_extraopts:"required"`
+	Port                  int           `conf:"port" conf_extraopts:"default=22"`
+	Password              string        `conf:"password"`
+	KeyFile               string        `conf:"key_file"`
+	KeyPassphrase         string        `conf:"key_passphrase"`
+	UseAgent              bool          `conf:"use_agent" conf_extraopts:"default=false"`
+	KnownHostsFile        string        `conf:"known_hosts_file"`
+	HostKeyFingerprint    string        `conf:"host_key_fingerprint"`
+	InsecureIgnoreHostKey bool          `conf:"insecure_ignore_host_key" conf_extraopts:"default=false"`
+	JumpHosts             []string      `conf:"jump_hosts"`
+	KeepaliveInterval     time.Duration `conf:"keepalive_interval" conf_extraopts:"default=30"` // seconds, 0 disables keepalives
+	ConnectTimeout        time.Duration `conf:"connection_timeout" conf_extraopts:"default=10"`
 }
 
 type ftpConnConf struct {
@@ -3,27 +3,40 @@ package ctx
 import (
 	"fmt"
 	"github.com/nixys/nxs-backup/modules/cmd_handler/list_backups"
+	"io"
 	"os"
 	"path"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/docker/go-units"
+	"github.com/google/uuid"
 	"github.com/hashicorp/go-multierror"
 	appctx "github.com/nixys/nxs-go-appctx/v3"
 	"github.com/sirupsen/logrus"
 
+	"github.com/nixys/nxs-backup/api/ui"
 	"github.com/nixys/nxs-backup/interfaces"
 	"github.com/nixys/nxs-backup/misc"
+	"github.com/nixys/nxs-backup/modules/backup"
 	"github.com/nixys/nxs-backup/modules/cmd_handler/api_server"
+	"github.com/nixys/nxs-backup/modules/cmd_handler/check_storages"
+	"github.com/nixys/nxs-backup/modules/cmd_handler/dry_run"
 	"github.com/nixys/nxs-backup/modules/cmd_handler/generate_config"
 	"github.com/nixys/nxs-backup/modules/cmd_handler/self_update"
 	"github.com/nixys/nxs-backup/modules/cmd_handler/start_backup"
 	"github.com/nixys/nxs-backup/modules/cmd_handler/test_config"
 	"github.com/nixys/nxs-backup/modules/logger"
 	"github.com/nixys/nxs-backup/modules/metrics"
+	"github.com/nixys/nxs-backup/modules/notifier/outbox"
+	"github.com/nixys/nxs-backup/modules/report"
+	"github.com/nixys/nxs-backup/modules/secrets"
+	"github.com/nixys/nxs-backup/modules/storage"
+	"github.com/nixys/nxs-backup/modules/tracing"
 )
 
 // Ctx defines application custom context
@@ -33,25 +46,67 @@ type Ctx struct {
 	Done      chan error
 	EventCh   chan logger.LogRecord
 	EventsWG  *sync.WaitGroup
+	ReportCh  chan *report.Report
 	Notifiers []interfaces.Notifier
+	// RunID identifies log entries of the current invocation
+	RunID string
+	// JobTypes is used to set the job type of log records sent by storages
+	JobTypes map[string]string
+	Outbox   *outbox.Outbox
+	// Redactor masks the secrets in log records, nil if the config has no secrets
+	Redactor *logger.Redactor
+	// FlushOutbox enables sending of the queued notifications, FlushInterval repeats it in server mode
+	FlushOutbox   bool
+	FlushInterval time.Duration
+	// ReloadCh receives the config reload requests in server mode
+	ReloadCh chan chan error
+
+	cfgPath      string
+	reloadServer func(api_server.Opts) error
+	storages     map[string]interfaces.Storage
+	jobsMu       *sync.Mutex
+	tracing      *tracing.Provider
+	// the new version is checked once, the config reload keeps the result
+	versionChecked      bool
+	newVersionAvailable float64
+	// replaced is the context replaced by this one on the config reload
+	replaced *Ctx
 }
 
 type app struct {
-	waitTimeout time.Duration
-	jobs        map[string]interfaces.Job
-	fileJobs    interfaces.Jobs
-	dbJobs      interfaces.Jobs
-	extJobs     interfaces.Jobs
-	initErrs    *multierror.Error
-	metricsData *metrics.Data
-	serverBind  string
+	waitTimeout    time.Duration
+	freeSpaceCheck string
+	jobs           map[string]interfaces.Job
+	fileJobs       interfaces.Jobs
+	dbJobs         interfaces.Jobs
+	extJobs        interfaces.Jobs
+	initErrs       *multierror.Error
+	metricsData    *metrics.Data
+	serverBind     string
+	apiToken       string
+	outboxCount    func() (queued, failed int)
+	flushInterval  time.Duration
+	uiOpts         *ui.Opts
+	storagesCheck  func() []storage.CheckResult
+	checkInterval  time.Duration
+	storages       map[string]interfaces.Storage
+	// jobsMu guards the storages clients of the jobs in server mode
+	jobsMu *sync.Mutex
+	// openLog switches the logger to the configured output
+	openLog func() error
+	// cpuLimit is applied to the process only if the config is valid
+	cpuLimit *int
 }
 
 func AppCtxInit() (any, error) {
 	c := &Ctx{
 		EventsWG: &sync.WaitGroup{},
 		EventCh:  make(chan logger.LogRecord),
+		ReportCh: make(chan *report.Report),
 		Done:     make(chan error),
+		Outbox:   outbox.Init(outbox.Opts{Policy: outbox.Policy{Attempts: 1}}),
+		RunID:    uuid.NewString(),
+		JobTypes: make(map[string]string),
 	}
 
 	ra, err := ReadArgs()
@@ -109,23 +164,52 @@ func AppCtxInit() (any, error) {
 			list_backups.Opts{
 				InitErr:  a.initErrs.ErrorOrNil(),
 				Done:     c.Done,
-				JobName:  ra.CmdParams.(*StartCmd).JobName,
+				JobName:  ra.CmdParams.(*ListBackupsCmd).JobName,
+				Output:   ra.CmdParams.(*ListBackupsCmd).Output,
 				FileJobs: a.fileJobs,
 				DBJobs:   a.dbJobs,
 				ExtJobs:  a.extJobs,
 				Jobs:     a.jobs,
 			},
 		)
+	case checkSt:
+		a, err := appInit(c, ra.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		c.Cmd = check_storages.Init(
+			check_storages.Opts{
+				InitErr: a.initErrs.ErrorOrNil(),
+				Done:    c.Done,
+				Check:   a.storagesCheck,
+			},
+		)
 	case start:
 		a, err := appInit(c, ra.ConfigPath)
 		if err != nil {
 			return nil, err
 		}
+		if ra.CmdParams.(*StartCmd).DryRun {
+			c.Cmd = dry_run.Init(
+				dry_run.Opts{
+					InitErr:  a.initErrs.ErrorOrNil(),
+					Done:     c.Done,
+					JobName:  ra.CmdParams.(*StartCmd).JobName,
+					FileJobs: a.fileJobs,
+					DBJobs:   a.dbJobs,
+					ExtJobs:  a.extJobs,
+					Jobs:     a.jobs,
+				},
+			)
+			break
+		}
+		c.FlushOutbox = true
 		c.Cmd = start_backup.Init(
 			start_backup.Opts{
 				InitErr:     a.initErrs.ErrorOrNil(),
 				Done:        c.Done,
 				EvCh:        c.EventCh,
+				ReportCh:    c.ReportCh,
 				WaitPrev:    a.waitTimeout,
 				JobName:     ra.CmdParams.(*StartCmd).JobName,
 				Jobs:        a.jobs,
@@ -133,6 +217,10 @@ func AppCtxInit() (any, error) {
 				DBJobs:      a.dbJobs,
 				ExtJobs:     a.extJobs,
 				MetricsData: a.metricsData,
+				RunID:       c.RunID,
+				Tracing:     c.tracing,
+
+				FreeSpaceCheck: a.freeSpaceCheck,
 			},
 		)
 	case server:
@@ -145,17 +233,20 @@ func AppCtxInit() (any, error) {
 			printInitError("Init err:\n%s", err)
 			return nil, err
 		}
-		c.Cmd, err = api_server.Init(
-			api_server.Opts{
-				Bind:           a.serverBind,
-				MetricFilePath: a.metricsData.MetricFilePath(),
-				Log:            c.Log,
-				Done:           c.Done,
-			},
-		)
+		if err = a.initErrs.ErrorOrNil(); err != nil {
+			c.Log.Warnf("Config has errors, it can't be reloaded until they are fixed: %v", err)
+		}
+		c.ReloadCh = make(chan chan error)
+		c.cfgPath = ra.ConfigPath
+		c.storages, c.jobsMu = a.storages, a.jobsMu
+		srv, err := api_server.Init(serverOpts(c, a))
 		if err != nil {
 			return nil, err
 		}
+		c.Cmd = srv
+		c.reloadServer = srv.Reload
+		c.FlushOutbox = true
+		c.FlushInterval = a.flushInterval
 	default:
 		err = fmt.Errorf("unknown command: %s", ra.Cmd)
 		printInitError("Init err:\n%s", err)
@@ -165,14 +256,68 @@ func AppCtxInit() (any, error) {
 	return c, nil
 }
 
+func serverOpts(c *Ctx, a app) api_server.Opts {
+	return api_server.Opts{
+		Bind:           a.serverBind,
+		APIToken:       a.apiToken,
+		MetricFilePath: a.metricsData.MetricFilePath(),
+		OutboxCount:    a.outboxCount,
+		Project:        a.metricsData.Project,
+		Server:         a.metricsData.Server,
+		UI:             a.uiOpts,
+		StoragesCheck:  a.storagesCheck,
+		CheckInterval:  a.checkInterval,
+		Reload:         c.Reload,
+		Log:            c.Log,
+		Done:           c.Done,
+	}
+}
+
 func printInitError(ft string, err error) {
 	_, _ = fmt.Fprintf(os.Stderr, ft, err)
 }
 
+// appInit inits the app by the config and applies it to the process
 func appInit(c *Ctx, cfgPath string) (app, error) {
+	a, err := buildApp(c, cfgPath)
+	if err != nil {
+		return a, err
+	}
+	if err = a.openLog(); err != nil {
+		printInitError("Failed to init log file: %v\n", err)
+		return a, err
+	}
+	c.applyGlobals(a)
+	return a, nil
+}
+
+// applyGlobals applies the settings of the app shared by the whole process
+func (c *Ctx) applyGlobals(a app) {
+	if a.cpuLimit != nil {
+		misc.CPULimit = *a.cpuLimit
+	}
+	c.tracing.Register()
+
+	if a.metricsData.Enabled {
+		if !c.versionChecked {
+			ver, _ := semver.NewVersion(misc.VERSION)
+			newVer, _, _ := misc.CheckNewVersionAvailable(strconv.FormatUint(ver.Major(), 10))
+			if newVer != "" {
+				c.newVersionAvailable = 1
+			}
+			c.versionChecked = true
+		}
+		a.metricsData.NewVersionAvailable = c.newVersionAvailable
+	}
+}
+
+// buildApp inits the app by the config without changing the process state, so the config reload
+// with errors doesn't affect the running server
+func buildApp(c *Ctx, cfgPath string) (app, error) {
 
 	a := app{
-		jobs: make(map[string]interfaces.Job),
+		jobs:   make(map[string]interfaces.Job),
+		jobsMu: &sync.Mutex{},
 	}
 
 	conf, err := readConfig(cfgPath)
@@ -181,8 +326,38 @@ func appInit(c *Ctx, cfgPath string) (app, error) {
 		return a, err
 	}
 
+	secretsRes, err := resolveSecrets(&conf)
+	if err != nil {
+		printInitError("Failed to resolve secrets: %v\n", err)
+		return a, err
+	}
+
 	a.waitTimeout = conf.WaitingTimeout
+	a.freeSpaceCheck = conf.FreeSpaceCheck
+	if !slices.Contains(backup.FreeSpaceChecks, conf.FreeSpaceCheck) {
+		a.initErrs = multierror.Append(a.initErrs, fmt.Errorf("unknown `free_space_check` value `%s`, allowed: %s", conf.FreeSpaceCheck, strings.Join(backup.FreeSpaceChecks, ", ")))
+		a.freeSpaceCheck = backup.FreeSpaceCheckWarn
+	}
 	a.serverBind = conf.Server.Bind
+	a.apiToken = conf.Server.APIToken
+
+	var pushOpts *metrics.PushOpts
+	if pc := conf.Server.Metrics.Push; pc.Enabled {
+		pushOpts = &metrics.PushOpts{
+			Type:        pc.Type,
+			URL:         pc.URL,
+			Protocol:    pc.Protocol,
+			Username:    pc.Username,
+			Password:    pc.Password,
+			Headers:     pc.Headers,
+			InsecureTLS: pc.InsecureTLS,
+			Timeout:     time.Duration(pc.Timeout) * time.Second,
+		}
+		if err = pushOpts.Validate(); err != nil {
+			a.initErrs = multierror.Append(a.initErrs, err)
+			pushOpts = nil
+		}
+	}
 
 	a.metricsData = metrics.InitData(
 		metrics.DataOpts{
@@ -190,26 +365,56 @@ func appInit(c *Ctx, cfgPath string) (app, error) {
 			Server:      conf.ServerName,
 			MetricsFile: conf.Server.Metrics.FilePath,
 			Enabled:     false,
+			Push:        pushOpts,
 		},
 	)
 
 	if conf.Server.Metrics.Enabled {
-		nva := 0.0
-		ver, _ := semver.NewVersion(misc.VERSION)
-		newVer, _, _ := misc.CheckNewVersionAvailable(strconv.FormatUint(ver.Major(), 10))
-		if newVer != "" {
-			nva = 1
-		}
-		a.metricsData.NewVersionAvailable = nva
 		a.metricsData.Enabled = true
 	}
 
-	if err = logInit(c, conf.LogFile, conf.LogLevel); err != nil {
+	if a.openLog, err = logInit(c, conf); err != nil {
 		printInitError("Failed to init log file: %v\n", err)
 		return a, err
 	}
+	if vals := secretsRes.Values(); len(vals) > 0 {
+		c.Redactor = logger.NewRedactor(vals)
+		hooks := make(logrus.LevelHooks)
+		hooks.Add(logger.NewRedactHook(c.Redactor))
+		c.Log.ReplaceHooks(hooks)
+	}
+
+	if c.tracing, err = tracing.Init(
+		tracing.Opts{
+			Enabled:  conf.Tracing.Enabled,
+			Protocol: conf.Tracing.Protocol,
+			Endpoint: conf.Tracing.Endpoint,
+			Insecure: conf.Tracing.Insecure,
+			Headers:  conf.Tracing.Headers,
+			Project:  conf.ProjectName,
+			Server:   conf.ServerName,
+		},
+	); err != nil {
+		a.initErrs = multierror.Append(a.initErrs, err)
+	}
 
 	// Notifications init
+	c.Outbox = outbox.Init(
+		outbox.Opts{
+			Enabled: conf.Notifications.Outbox.Enabled,
+			Path:    conf.Notifications.Outbox.Path,
+			MaxAge:  time.Duration(conf.Notifications.Outbox.MaxAge) * time.Hour,
+			Policy: outbox.Policy{
+				Attempts:     conf.Notifications.Retry.Attempts,
+				InitialDelay: time.Duration(conf.Notifications.Retry.InitialDelay) * time.Second,
+				MaxDelay:     time.Duration(conf.Notifications.Retry.MaxDelay) * time.Second,
+			},
+		},
+	)
+	a.flushInterval = time.Duration(conf.Notifications.Outbox.FlushInterval) * time.Second
+	if conf.Notifications.Outbox.Enabled {
+		a.outboxCount = c.Outbox.Count
+	}
 	if err = notifiersInit(c, conf); err != nil {
 		a.initErrs = multierror.Append(a.initErrs, err.(*multierror.Error).WrappedErrors()...)
 	}
@@ -226,13 +431,14 @@ func appInit(c *Ctx, cfgPath string) (app, error) {
 		if conf.Limits.DiskRate != nil {
 			lim.DiskRate = conf.Limits.DiskRate
 		}
-		if conf.Limits.CPUCount != nil {
-			misc.CPULimit = *conf.Limits.CPUCount
-		}
+		a.cpuLimit = conf.Limits.CPUCount
 	}
 
 	// Init app
 	storages, err := storagesInit(conf.StorageConnects, lim)
+	a.storages = storages
+	a.storagesCheck = storagesCheck(conf, lim)
+	a.checkInterval = time.Duration(conf.Server.Metrics.StorageCheckInterval) * time.Second
 	if err != nil {
 		a.initErrs = multierror.Append(a.initErrs, err.(*multierror.Error).WrappedErrors()...)
 	}
@@ -259,39 +465,133 @@ func appInit(c *Ctx, cfgPath string) (app, error) {
 			a.extJobs = append(a.extJobs, job)
 		}
 		a.jobs[job.GetName()] = job
+		c.JobTypes[job.GetName()] = string(job.GetType())
+	}
+
+	if conf.Server.UI.Enabled {
+		a.uiOpts = &ui.Opts{
+			Log:            c.Log,
+			MetricFilePath: conf.Server.Metrics.FilePath,
+			LogFile:        conf.LogFile,
+			LogRecords:     conf.Server.UI.LogRecords,
+			Jobs:           jobs,
+			Username:       conf.Server.UI.Username,
+			Password:       conf.Server.UI.Password,
+			Token:          conf.Server.UI.Token,
+			JobsMu:         a.jobsMu,
+		}
 	}
 
 	return a, nil
 }
 
-func logInit(c *Ctx, file, level string) error {
+// resolveSecrets replaces the secret references in the config, the Vault connection may refer only to
+// the environment and files
+func resolveSecrets(conf *ConfOpts) (*secrets.Resolver, error) {
+	res := secrets.NewResolver()
+
+	if err := res.Resolve(&conf.Vault); err != nil {
+		return nil, err
+	}
+	vc := conf.Vault
+	if vc.Address == "" {
+		vc.Address = os.Getenv("VAULT_ADDR")
+	}
+	if vc.Token == "" {
+		vc.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if vc.Address != "" {
+		if err := res.SetVault(secrets.VaultOpts{
+			Address:     vc.Address,
+			Namespace:   vc.Namespace,
+			Token:       vc.Token,
+			RoleID:      vc.RoleID,
+			SecretID:    vc.SecretID,
+			AuthMount:   vc.AuthMount,
+			InsecureTLS: vc.InsecureTLS,
+			Timeout:     time.Duration(vc.Timeout) * time.Second,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, res.Resolve(conf)
+}
+
+// logInit checks the log options and inits the logger of the context. The returned function switches
+// the logger to the configured output, it's called only if the config is valid
+func logInit(c *Ctx, conf ConfOpts) (func() error, error) {
 	var (
-		f   *os.File
 		l   logrus.Level
+		lf  logrus.Formatter
+		ro  logger.RotateOpts
 		err error
 	)
 
-	switch file {
-	case "stdout":
-		f = os.Stdout
-	case "stderr":
-		f = os.Stderr
+	switch conf.LogFormat {
+	case "text":
+		lf = &logger.LogFormatter{}
+	case "json":
+		lf = &logger.JSONFormatter{RunID: c.RunID}
 	default:
-		if err = os.MkdirAll(path.Dir(file), os.ModePerm); err != nil {
-			return err
-		}
-		if f, err = os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
-			return err
+		return nil, fmt.Errorf("log init: unknown log format \"%s\", available formats: 'text', 'json'", conf.LogFormat)
+	}
+
+	ro = logger.RotateOpts{
+		Period:     conf.LogRotate.Period,
+		MaxBackups: conf.LogRotate.MaxBackups,
+	}
+	if conf.LogRotate.MaxSize != "" {
+		if ro.MaxSize, err = units.FromHumanSize(conf.LogRotate.MaxSize); err != nil {
+			return nil, fmt.Errorf("log init: wrong `max_size` of log rotation: %w", err)
 		}
 	}
 
 	// Validate log level
-	if l, err = logrus.ParseLevel(level); err != nil {
-		return fmt.Errorf("log init: %w", err)
+	if l, err = logrus.ParseLevel(conf.LogLevel); err != nil {
+		return nil, fmt.Errorf("log init: %w", err)
+	}
+
+	if c.Log, err = appctx.DefaultLogInit(os.Stderr, l, lf); err != nil {
+		return nil, err
 	}
 
-	c.Log, err = appctx.DefaultLogInit(f, l, &logger.LogFormatter{})
-	return err
+	log := c.Log
+	return func() error {
+		var (
+			w   io.Writer
+			lf  logrus.Formatter
+			err error
+		)
+
+		switch {
+		case conf.LogFile == "stdout":
+			w = os.Stdout
+		case conf.LogFile == "stderr":
+			w = os.Stderr
+		case conf.LogFile == "journald":
+			// journald and syslog have own formats with the fields of the entries
+			if w, lf, err = logger.NewJournald(c.RunID); err != nil {
+				return fmt.Errorf("log init: %w", err)
+			}
+			log.SetFormatter(lf)
+		case strings.HasPrefix(conf.LogFile, "syslog"):
+			if w, lf, err = logger.NewSyslog(conf.LogFile, c.RunID); err != nil {
+				return fmt.Errorf("log init: %w", err)
+			}
+			log.SetFormatter(lf)
+		default:
+			if err = os.MkdirAll(path.Dir(conf.LogFile), os.ModePerm); err != nil {
+				return err
+			}
+			if w, err = logger.OpenRotatingFile(conf.LogFile, ro); err != nil {
+				return fmt.Errorf("log init: %w", err)
+			}
+		}
+
+		log.SetOutput(w)
+		return nil
+	}, nil
 }
 
 func getRateLimit(limit *string) (rl int64, err error) {
@@ -5,6 +5,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/docker/go-units"
 	"github.com/hashicorp/go-multierror"
 
 	"github.com/nixys/nxs-backup/ds/mongo_connect"
@@ -24,6 +25,7 @@ import (
 	"github.com/nixys/nxs-backup/modules/backup/redis"
 	"github.com/nixys/nxs-backup/modules/metrics"
 	"github.com/nixys/nxs-backup/modules/storage"
+	"github.com/nixys/nxs-backup/modules/storage/repository"
 )
 
 type jobsOpts struct {
@@ -93,17 +95,42 @@ func jobsInit(o jobsOpts) ([]interfaces.Job, error) {
 				continue
 			}
 
-			if opt.Retention.Days < 0 || opt.Retention.Weeks < 0 || opt.Retention.Months < 0 {
+			if err = checkRetention(opt.Retention); err != nil {
 				stErrs++
-				errs = multierror.Append(errs, fmt.Errorf("Failed to set storage `%s` for job `%s`: retention period can't be negative ", opt.StorageName, j.Name))
+				errs = multierror.Append(errs, fmt.Errorf("Failed to set storage `%s` for job `%s`: %w", opt.StorageName, j.Name, err))
 				continue
 			}
+			var volumeSize int64
+			if volumeSize, err = getVolumeSize(opt); err != nil {
+				stErrs++
+				errs = multierror.Append(errs, fmt.Errorf("Failed to set storage `%s` for job `%s`: %w", opt.StorageName, j.Name, err))
+				continue
+			}
+			retention := storage.Retention{
+				Hours:      opt.Retention.Hours,
+				Days:       opt.Retention.Days,
+				Weeks:      opt.Retention.Weeks,
+				Months:     opt.Retention.Months,
+				Years:      opt.Retention.Years,
+				UseCount:   opt.Retention.UseCount,
+				DailyHour:  opt.Retention.DailyHour,
+				WeeklyDay:  opt.Retention.WeeklyDay,
+				MonthlyDay: opt.Retention.MonthlyDay,
+			}
 
 			st := s.Clone()
+			if opt.Repository.Enabled {
+				if st, err = getRepository(st, j.Type, opt.Repository); err != nil {
+					stErrs++
+					errs = multierror.Append(errs, fmt.Errorf("Failed to set storage `%s` for job `%s`: %w", opt.StorageName, j.Name, err))
+					continue
+				}
+			}
 			stParams := storage.Params{
 				BackupPath:    opt.BackupPath,
+				VolumeSize:    volumeSize,
 				RotateEnabled: opt.EnableRotate,
-				Retention:     storage.Retention(opt.Retention),
+				Retention:     retention,
 			}
 			if opt.StorageName == "local" {
 				stParams.RateLimit = diskRate
@@ -112,7 +139,7 @@ func jobsInit(o jobsOpts) ([]interfaces.Job, error) {
 			}
 			st.Configure(stParams)
 
-			if storage.IsNeedToBackup(opt.Retention.Days, opt.Retention.Weeks, opt.Retention.Months) {
+			if storage.IsNeedToBackup(retention) {
 				needToMakeBackup = true
 			}
 
@@ -417,6 +444,58 @@ func jobsInit(o jobsOpts) ([]interfaces.Job, error) {
 	return jobs, errs.ErrorOrNil()
 }
 
+func checkRetention(r retentionConf) error {
+	if r.Hours < 0 || r.Days < 0 || r.Weeks < 0 || r.Months < 0 || r.Years < 0 {
+		return fmt.Errorf("retention period can't be negative ")
+	}
+	if r.DailyHour < 0 || r.DailyHour > 23 {
+		return fmt.Errorf("`daily_backup_hour` must be in range 0-23 ")
+	}
+	if r.WeeklyDay < 0 || r.WeeklyDay > 6 {
+		return fmt.Errorf("`weekly_backup_day` must be in range 0-6 (Sunday-Saturday) ")
+	}
+	if r.MonthlyDay < 1 || r.MonthlyDay > 28 {
+		return fmt.Errorf("`monthly_backup_day` must be in range 1-28 ")
+	}
+	return nil
+}
+
+func getRepository(st interfaces.Storage, jobType misc.BackupType, rc repositoryConf) (interfaces.Storage, error) {
+	if jobType == misc.IncFiles {
+		return nil, fmt.Errorf("repository format isn't supported for `%s` jobs ", misc.IncFiles)
+	}
+
+	chunkSize, err := units.RAMInBytes(rc.AvgChunkSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository chunk size: %w ", err)
+	}
+
+	return repository.Init(st, repository.Opts{
+		AvgChunkSize: int(chunkSize),
+	})
+}
+
+// minVolumeSize protects from the size set without units by mistake
+const minVolumeSize = 1 << 20
+
+func getVolumeSize(opt storageConf) (int64, error) {
+	if opt.VolumeSize == "" {
+		return 0, nil
+	}
+	if opt.Repository.Enabled {
+		return 0, fmt.Errorf("volume size can't be used with repository format ")
+	}
+
+	size, err := units.RAMInBytes(opt.VolumeSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse volume size: %w ", err)
+	}
+	if size < minVolumeSize {
+		return 0, fmt.Errorf("volume size must be at least %s ", units.BytesSize(minVolumeSize))
+	}
+	return size, nil
+}
+
 func isGzip(sgz *bool, jgz bool) bool {
 	if sgz != nil {
 		return *sgz
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"github.com/hashicorp/go-multierror"
 	"github.com/nixys/nxs-backup/modules/notifier/mailer"
+	"github.com/nixys/nxs-backup/modules/notifier/mattermost"
+	"github.com/nixys/nxs-backup/modules/notifier/slack"
+	"github.com/nixys/nxs-backup/modules/notifier/telegram"
 	"github.com/nixys/nxs-backup/modules/notifier/webhooker"
+	"github.com/nixys/nxs-backup/modules/report"
 	"github.com/sirupsen/logrus"
 	"net/mail"
 	"strings"
@@ -37,6 +41,10 @@ func notifiersInit(c *Ctx, conf ConfOpts) error {
 		if _, err := mail.ParseAddress(conf.Notifications.Mail.From); err != nil {
 			mailErrs = multierror.Append(mailErrs, fmt.Errorf("Email init fail. Failed to parse `mail_from` \"%s\". %v ", conf.Notifications.Mail.From, err))
 		}
+		mode := report.Mode(strings.ToLower(conf.Notifications.Mail.Mode))
+		if !mode.IsValid() {
+			mailErrs = multierror.Append(mailErrs, fmt.Errorf("Email init fail. Unknown mode \"%s\". Available modes: 'per_event', 'summary', 'both' ", conf.Notifications.Mail.Mode))
+		}
 
 		ml, ok := messageLevels[strings.ToUpper(conf.Notifications.Mail.MessageLevel)]
 		if ok {
@@ -44,15 +52,18 @@ func notifiersInit(c *Ctx, conf ConfOpts) error {
 				errs = multierror.Append(errs, mailErrs.Errors...)
 			} else {
 				m, err := mailer.Init(mailer.Opts{
-					From:         conf.Notifications.Mail.From,
-					SmtpServer:   conf.Notifications.Mail.SmtpServer,
-					SmtpPort:     conf.Notifications.Mail.SmtpPort,
-					SmtpUser:     conf.Notifications.Mail.SmtpUser,
-					SmtpPassword: conf.Notifications.Mail.SmtpPassword,
-					Recipients:   conf.Notifications.Mail.Recipients,
-					MessageLevel: ml,
-					ProjectName:  conf.ProjectName,
-					ServerName:   conf.ServerName,
+					From:            conf.Notifications.Mail.From,
+					SmtpServer:      conf.Notifications.Mail.SmtpServer,
+					SmtpPort:        conf.Notifications.Mail.SmtpPort,
+					SmtpUser:        conf.Notifications.Mail.SmtpUser,
+					SmtpPassword:    conf.Notifications.Mail.SmtpPassword,
+					Recipients:      conf.Notifications.Mail.Recipients,
+					MessageLevel:    ml,
+					Mode:            mode,
+					SubjectTemplate: conf.Notifications.Mail.SubjectTemplate,
+					BodyTemplate:    conf.Notifications.Mail.BodyTemplate,
+					ProjectName:     conf.ProjectName,
+					ServerName:      conf.ServerName,
 				})
 				if err != nil {
 					errs = multierror.Append(errs, err)
@@ -67,6 +78,11 @@ func notifiersInit(c *Ctx, conf ConfOpts) error {
 
 	for _, wh := range conf.Notifications.Webhooks {
 		if wh.Enabled {
+			mode := report.Mode(strings.ToLower(wh.Mode))
+			if !mode.IsValid() {
+				errs = multierror.Append(errs, fmt.Errorf("Webhook init fail. Unknown mode \"%s\". Available modes: 'per_event', 'summary', 'both' ", wh.Mode))
+				continue
+			}
 			ml, ok := messageLevels[strings.ToUpper(wh.MessageLevel)]
 			if ok {
 				a, err := webhooker.Init(webhooker.Opts{
@@ -76,6 +92,9 @@ func notifiersInit(c *Ctx, conf ConfOpts) error {
 					PayloadMessageKey: wh.PayloadMessageKey,
 					ExtraPayload:      wh.ExtraPayload,
 					MessageLevel:      ml,
+					Mode:              mode,
+					MessageTemplate:   wh.MessageTemplate,
+					PayloadTemplate:   wh.PayloadTemplate,
 					ProjectName:       conf.ProjectName,
 					ServerName:        conf.ServerName,
 				})
@@ -90,7 +109,103 @@ func notifiersInit(c *Ctx, conf ConfOpts) error {
 		}
 	}
 
+	for _, tg := range conf.Notifications.Telegram {
+		if !tg.Enabled {
+			continue
+		}
+		ml, mode, err := getLevelAndMode("Telegram", tg.MessageLevel, tg.Mode)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		t, err := telegram.Init(telegram.Opts{
+			APIURL:          tg.APIURL,
+			BotToken:        tg.BotToken,
+			ChatID:          tg.ChatID,
+			ThreadID:        tg.ThreadID,
+			InsecureTLS:     tg.InsecureTLS,
+			MessageLevel:    ml,
+			Mode:            mode,
+			MessageTemplate: tg.MessageTemplate,
+			ProjectName:     conf.ProjectName,
+			ServerName:      conf.ServerName,
+		})
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		} else {
+			ns = append(ns, t)
+		}
+	}
+
+	for _, sl := range conf.Notifications.Slack {
+		if !sl.Enabled {
+			continue
+		}
+		ml, mode, err := getLevelAndMode("Slack", sl.MessageLevel, sl.Mode)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		s, err := slack.Init(slack.Opts{
+			WebhookURL:      sl.WebhookURL,
+			Channel:         sl.Channel,
+			Username:        sl.Username,
+			IconEmoji:       sl.IconEmoji,
+			InsecureTLS:     sl.InsecureTLS,
+			MessageLevel:    ml,
+			Mode:            mode,
+			MessageTemplate: sl.MessageTemplate,
+			ProjectName:     conf.ProjectName,
+			ServerName:      conf.ServerName,
+		})
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		} else {
+			ns = append(ns, s)
+		}
+	}
+
+	for _, mm := range conf.Notifications.Mattermost {
+		if !mm.Enabled {
+			continue
+		}
+		ml, mode, err := getLevelAndMode("Mattermost", mm.MessageLevel, mm.Mode)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		m, err := mattermost.Init(mattermost.Opts{
+			WebhookURL:      mm.WebhookURL,
+			Channel:         mm.Channel,
+			Username:        mm.Username,
+			IconURL:         mm.IconURL,
+			InsecureTLS:     mm.InsecureTLS,
+			MessageLevel:    ml,
+			Mode:            mode,
+			MessageTemplate: mm.MessageTemplate,
+			ProjectName:     conf.ProjectName,
+			ServerName:      conf.ServerName,
+		})
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		} else {
+			ns = append(ns, m)
+		}
+	}
+
 	c.Notifiers = ns
 
 	return errs.ErrorOrNil()
 }
+
+func getLevelAndMode(notifier, level, mode string) (logrus.Level, report.Mode, error) {
+	ml, ok := messageLevels[strings.ToUpper(level)]
+	if !ok {
+		return ml, "", fmt.Errorf("%s init fail. Unknown message level. Available levels: 'INFO', 'WARN', 'ERR' ", notifier)
+	}
+	m := report.Mode(strings.ToLower(mode))
+	if !m.IsValid() {
+		return ml, m, fmt.Errorf("%s init fail. Unknown mode \"%s\". Available modes: 'per_event', 'summary', 'both' ", notifier, mode)
+	}
+	return ml, m, nil
+}
@@ -0,0 +1,116 @@
+package ctx
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/nixys/nxs-backup/modules/logger"
+)
+
+// Reload asks the server to reload the config and waits for the result
+func (c *Ctx) Reload(done <-chan struct{}) error {
+	if c.ReloadCh == nil {
+		return fmt.Errorf("config reload is available only in server mode")
+	}
+
+	res := make(chan error, 1)
+	select {
+	case c.ReloadCh <- res:
+	case <-done:
+		return fmt.Errorf("config reload canceled")
+	}
+	select {
+	case err := <-res:
+		return err
+	case <-done:
+		return fmt.Errorf("config reload canceled")
+	}
+}
+
+// Reinit inits the new context of the server with the reread config. The server is switched to the new
+// storages, jobs and notifiers only if the config has no errors, otherwise the current context is kept
+func (c *Ctx) Reinit() (*Ctx, error) {
+	nc := &Ctx{
+		Cmd:     c.Cmd,
+		Done:    c.Done,
+		EventCh: c.EventCh,
+		// the log of the replaced context is closed when its notifications are sent
+		EventsWG:     &sync.WaitGroup{},
+		ReportCh:     c.ReportCh,
+		RunID:        c.RunID,
+		JobTypes:     make(map[string]string),
+		FlushOutbox:  c.FlushOutbox,
+		ReloadCh:     c.ReloadCh,
+		cfgPath:      c.cfgPath,
+		reloadServer: c.reloadServer,
+
+		versionChecked:      c.versionChecked,
+		newVersionAvailable: c.newVersionAvailable,
+		replaced:            c,
+	}
+
+	a, err := buildApp(nc, c.cfgPath)
+	if err == nil {
+		err = a.initErrs.ErrorOrNil()
+	}
+	if err == nil && a.metricsData == nil {
+		err = fmt.Errorf("server metrics disabled by config")
+	}
+	nc.storages, nc.jobsMu = a.storages, a.jobsMu
+	// the process is changed only after the config is checked
+	if err == nil {
+		err = a.openLog()
+	}
+	if err == nil {
+		err = nc.reloadServer(serverOpts(nc, a))
+	}
+	if err != nil {
+		nc.replaced = nil
+		nc.Release()
+		nc.CloseLog()
+		return nil, err
+	}
+
+	nc.applyGlobals(a)
+	nc.FlushInterval = a.flushInterval
+	return nc, nil
+}
+
+// Release closes the storages connections and the tracing provider of the replaced context.
+// It waits for the jobs in progress, so the running backups are never interrupted by the reload
+func (c *Ctx) Release() {
+	c.jobsMu.Lock()
+	defer c.jobsMu.Unlock()
+
+	for _, st := range c.storages {
+		_ = st.Close()
+	}
+	if err := c.tracing.Shutdown(); err != nil && c.Log != nil {
+		c.Log.Warnf("Failed to export traces: %v", err)
+	}
+}
+
+// Replaced returns the contexts replaced by this one since the given context was used and forgets them.
+// Several reloads may happen before the new context is used, so the list contains all of them
+func (c *Ctx) Replaced(used *Ctx) []*Ctx {
+	var res []*Ctx
+	for p := c.replaced; p != nil; p = p.replaced {
+		res = append(res, p)
+		if p == used {
+			break
+		}
+	}
+	c.replaced = nil
+	return res
+}
+
+// CloseLog waits for the notifications sent with the replaced context and closes its log file.
+// It's called when the context isn't used to send new notifications any more
+func (c *Ctx) CloseLog() {
+	c.EventsWG.Wait()
+	if c.Log != nil {
+		if rf, ok := c.Log.Out.(*logger.RotatingFile); ok {
+			_ = rf.Close()
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package ctx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nixys/nxs-backup/interfaces"
+	"github.com/nixys/nxs-backup/modules/storage"
+	"github.com/nixys/nxs-backup/modules/storage/local"
+)
+
+type checkTarget struct {
+	job  string
+	path string
+}
+
+// storagesCheck returns the function checking the storages under the backup paths of the jobs.
+// The storages are connected again on each check to check the connection as well
+func storagesCheck(conf ConfOpts, mainLim *limitsConf) func() []storage.CheckResult {
+	targets := make(map[string][]checkTarget)
+	for _, j := range conf.Jobs {
+		for _, opt := range j.StoragesOptions {
+			targets[opt.StorageName] = append(targets[opt.StorageName], checkTarget{job: j.Name, path: opt.BackupPath})
+		}
+	}
+
+	return func() (res []storage.CheckResult) {
+		if len(targets["local"]) > 0 {
+			rl, _ := getRateLimit(mainLim.DiskRate)
+			res = append(res, checkStorage("local", targets["local"], func() (interfaces.Storage, error) {
+				return local.Init(rl), nil
+			})...)
+		}
+		for _, st := range conf.StorageConnects {
+			rl, _ := stRateLimit(st, mainLim)
+			res = append(res, checkStorage(st.Name, targets[st.Name], func() (interfaces.Storage, error) {
+				return initStorage(st, rl)
+			})...)
+		}
+		return
+	}
+}
+
+func checkStorage(name string, targets []checkTarget, connect func() (interfaces.Storage, error)) []storage.CheckResult {
+	start := time.Now()
+	s, err := connect()
+	connectTime := time.Since(start)
+
+	// only the connection is checked for storages not used by jobs
+	if len(targets) == 0 {
+		targets = []checkTarget{{}}
+	}
+
+	var res []storage.CheckResult
+	for _, t := range targets {
+		r := storage.CheckResult{FreeSpace: -1}
+		switch {
+		case err != nil:
+			r.Step, r.Err = "connect", err
+		case t.path == "":
+		default:
+			// the path is normalized by the storage the same way as for the backups
+			cl := s.Clone()
+			cl.Configure(storage.Params{BackupPath: t.path})
+			dir := t.path
+			if bp, ok := cl.(storage.BackupPather); ok {
+				dir = bp.BackupPath()
+			}
+			if d, ok := cl.(storage.Driver); ok {
+				r = storage.Probe(d, dir)
+			} else {
+				r.Step, r.Err = "write", fmt.Errorf("storage doesn't support file operations")
+			}
+		}
+		r.Storage, r.Job, r.Path, r.ConnectTime = name, t.job, t.path, connectTime
+		res = append(res, r)
+	}
+
+	if err == nil {
+		_ = s.Close()
+	}
+	return res
+}
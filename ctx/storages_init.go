@@ -3,10 +3,12 @@ package ctx
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 
 	"github.com/nixys/nxs-backup/interfaces"
+	"github.com/nixys/nxs-backup/modules/storage"
 	"github.com/nixys/nxs-backup/modules/storage/ftp"
 	"github.com/nixys/nxs-backup/modules/storage/local"
 	"github.com/nixys/nxs-backup/modules/storage/nfs"
@@ -28,9 +30,9 @@ var allowedConnectParams = []string{
 
 func storagesInit(storageConnects []storageConnectConf, mainLim *limitsConf) (storagesMap map[string]interfaces.Storage, err error) {
 	var (
-		rl      int64
-		errs    *multierror.Error
-		storage interfaces.Storage
+		rl   int64
+		errs *multierror.Error
+		s    interfaces.Storage
 	)
 
 	storagesMap = make(map[string]interfaces.Storage)
@@ -47,40 +49,60 @@ func storagesInit(storageConnects []storageConnectConf, mainLim *limitsConf) (st
 			continue
 		}
 
-		if st.RateLimit != nil {
-			rl, err = getRateLimit(st.RateLimit)
-		} else {
-			rl, err = getRateLimit(mainLim.NetRate)
-		}
+		rl, err = stRateLimit(st, mainLim)
 		if err != nil {
 			errs = multierror.Append(errs, fmt.Errorf("%s The limit won't be used for storage `%s`", err, st.Name))
 		}
 
-		switch {
-		case st.S3Params != nil:
-			storage, err = s3.Init(st.Name, s3.Opts(*st.S3Params), rl)
-		case st.ScpParams != nil:
-			storage, err = sftp.Init(st.Name, sftp.Opts(*st.ScpParams), rl)
-		case st.SftpParams != nil:
-			storage, err = sftp.Init(st.Name, sftp.Opts(*st.SftpParams), rl)
-		case st.FtpParams != nil:
-			storage, err = ftp.Init(st.Name, ftp.Opts(*st.FtpParams), rl)
-		case st.NfsParams != nil:
-			storage, err = nfs.Init(st.Name, nfs.Opts(*st.NfsParams), rl)
-		case st.WebDavParams != nil:
-			storage, err = webdav.Init(st.Name, webdav.Opts(*st.WebDavParams), rl)
-		case st.SmbParams != nil:
-			storage, err = smb.Init(st.Name, smb.Opts(*st.SmbParams), rl)
-		default:
-			err = fmt.Errorf("unable to define `%s` storage connect type by its params. Allowed connect params: %s", st.Name, strings.Join(allowedConnectParams, ", "))
-		}
-
-		if err != nil {
+		if s, err = initStorage(st, rl); err != nil {
 			errs = multierror.Append(errs, fmt.Errorf("Failed to init storage `%s` with error: %w ", st.Name, err))
 		} else {
-			storagesMap[st.Name] = storage
+			storagesMap[st.Name] = s
 		}
 	}
 
 	return storagesMap, errs.ErrorOrNil()
 }
+
+func stRateLimit(st storageConnectConf, mainLim *limitsConf) (int64, error) {
+	if st.RateLimit != nil {
+		return getRateLimit(st.RateLimit)
+	}
+	return getRateLimit(mainLim.NetRate)
+}
+
+// initStorage connects the storage defined by the connect params
+func initStorage(st storageConnectConf, rl int64) (interfaces.Storage, error) {
+	rp := stRetryPolicy(st.Retry)
+	if err := rp.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case st.S3Params != nil:
+		return s3.Init(st.Name, s3.Opts(*st.S3Params), rl, rp)
+	case st.ScpParams != nil:
+		return sftp.Init(st.Name, sftp.Opts(*st.ScpParams), rl, rp)
+	case st.SftpParams != nil:
+		return sftp.Init(st.Name, sftp.Opts(*st.SftpParams), rl, rp)
+	case st.FtpParams != nil:
+		return ftp.Init(st.Name, ftp.Opts(*st.FtpParams), rl, rp)
+	case st.NfsParams != nil:
+		return nfs.Init(st.Name, nfs.Opts(*st.NfsParams), rl, rp)
+	case st.WebDavParams != nil:
+		return webdav.Init(st.Name, webdav.Opts(*st.WebDavParams), rl, rp)
+	case st.SmbParams != nil:
+		return smb.Init(st.Name, smb.Opts(*st.SmbParams), rl, rp)
+	default:
+		return nil, fmt.Errorf("unable to define `%s` storage connect type by its params. Allowed connect params: %s", st.Name, strings.Join(allowedConnectParams, ", "))
+	}
+}
+
+func stRetryPolicy(c stRetryConf) storage.RetryPolicy {
+	return storage.RetryPolicy{
+		Attempts:     c.Attempts,
+		InitialDelay: time.Duration(c.InitialDelay) * time.Second,
+		MaxDelay:     time.Duration(c.MaxDelay) * time.Second,
+		RetryOn:      c.RetryOn,
+	}
+}
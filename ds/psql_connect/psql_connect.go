@@ -3,6 +3,7 @@ package psql_connect
 import (
 	"fmt"
 	"net/url"
+	"os"
 	"strings"
 
 	"github.com/jmoiron/sqlx"
@@ -58,3 +59,17 @@ func GetConnUrl(params Params) *url.URL {
 func GetConnect(connUrl *url.URL) (*sqlx.DB, error) {
 	return sqlx.Connect("postgres", connUrl.String())
 }
+
+// GetCmdConnUrl returns the connection URL without the password and the environment with
+// the password for the PostgreSQL client utilities
+func GetCmdConnUrl(connUrl *url.URL) (string, []string) {
+	cu := *connUrl
+	env := os.Environ()
+	if cu.User != nil {
+		if passwd, ok := cu.User.Password(); ok {
+			env = append(env, "PGPASSWORD="+passwd)
+		}
+		cu.User = url.User(cu.User.Username())
+	}
+	return cu.String(), env
+}
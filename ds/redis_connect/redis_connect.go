@@ -46,10 +46,7 @@ func GetConnectAndDSN(params Params) (rdb *redis.Client, dsn string, err error)
 
 	err = rdb.Ping(context.Background()).Err()
 
-	// this is not a bug, this is strange behavior of redis-cli uri usage
-	if params.Passwd != "" {
-		connUrl.User = url.User(params.Passwd)
-	}
+	// the password isn't included, redis-cli gets it from the REDISCLI_AUTH environment variable
 	dsn = connUrl.String()
 
 	return
@@ -1,31 +1,57 @@
 package interfaces
 
 import (
+	"context"
 	"github.com/nixys/nxs-backup/misc"
 	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/storage"
 )
 
 type JobTargets map[string]TargetsOnStorages
 
+// JobPlan contains actions planned for each job target
+type JobPlan map[string]TargetPlan
+
+type TargetPlan struct {
+	TmpFile  string
+	Storages []StoragePlan
+}
+
+type StoragePlan struct {
+	Name     string
+	Delivery *storage.DeliveryPlan
+	Rotation *storage.RotationPlan
+	Err      error
+}
+
 type Job interface {
 	SetOfsMetrics(ofs string, metrics map[string]float64)
+	SetOfsStorageMetrics(ofs, storage string, metrics map[string]float64)
 	GetName() string
 	GetTempDir() string
 	GetType() misc.BackupType
 	GetTargetOfsList() []string
 	GetStoragesCount() int
+	GetStorages() Storages
 	GetDumpObjects() map[string]DumpObject
 	SetDumpObjectDelivered(ofs string)
 	IsBackupSafety() bool
 	ListBackups() JobTargets
+	GetBackupPlan(tmpDir string) JobPlan
 	NeedToMakeBackup() bool
 	NeedToUpdateIncMeta() bool
-	DoBackup(logCh chan logger.LogRecord, tmpDir string) error
-	DeleteOldBackups(logCh chan logger.LogRecord, ofsPath string) error
+	DoBackup(ctx context.Context, logCh chan logger.LogRecord, tmpDir string) error
+	DeleteOldBackups(ctx context.Context, logCh chan logger.LogRecord, ofsPath string) error
 	CleanupTmpData() error
+	CollectStorageUsage(logCh chan logger.LogRecord)
 	Close() error
 }
 
+// SizeEstimator is implemented by jobs able to estimate the size of the backup by the size of the databases
+type SizeEstimator interface {
+	EstimateBackupSize() (int64, error)
+}
+
 type Jobs []Job
 
 func (j Jobs) Close() error {
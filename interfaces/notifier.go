@@ -4,8 +4,11 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/report"
 )
 
 type Notifier interface {
-	Send(log *logrus.Logger, rec logger.LogRecord)
+	GetName() string
+	Send(log *logrus.Logger, rec logger.LogRecord) error
+	SendReport(log *logrus.Logger, rep *report.Report) error
 }
@@ -1,6 +1,7 @@
 package interfaces
 
 import (
+	"context"
 	"io"
 	"os"
 	"path"
@@ -12,10 +13,11 @@ import (
 	"github.com/nixys/nxs-backup/modules/logger"
 	"github.com/nixys/nxs-backup/modules/metrics"
 	"github.com/nixys/nxs-backup/modules/storage"
+	"github.com/nixys/nxs-backup/modules/tracing"
 )
 
 type TargetFiles struct {
-	List    []string
+	List    []storage.BackupFile
 	ListErr error
 }
 
@@ -25,11 +27,13 @@ type Storage interface {
 	Clone() Storage
 	Configure(storage.Params)
 	DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupPath, ofs, bakType string) error
-	DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job Job, full bool) error
+	DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job Job, full bool) (storage.RotationStats, error)
+	GetDeliveryPlan(tmpBackupFile, ofs, bakType string) (*storage.DeliveryPlan, error)
+	GetRotationPlan(ofsPart string, job Job, full bool) (*storage.RotationPlan, error)
 	GetFileReader(string) (io.Reader, error)
 	GetName() string
 	IsLocal() int
-	ListBackups(string) ([]string, error)
+	ListBackups(string) ([]storage.BackupFile, error)
 	Close() error
 }
 
@@ -39,19 +43,17 @@ func (s Storages) Len() int           { return len(s) }
 func (s Storages) Less(i, j int) bool { return s[i].IsLocal() < s[j].IsLocal() }
 func (s Storages) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
-func (s Storages) DeleteOldBackups(logCh chan logger.LogRecord, j Job, ofsPath string) error {
+func (s Storages) DeleteOldBackups(ctx context.Context, logCh chan logger.LogRecord, j Job, ofsPath string) error {
 	errs := new(multierror.Error)
 
 	for _, st := range s {
 		if ofsPath != "" {
-			err := st.DeleteOldBackups(logCh, ofsPath, j, true)
-			if err != nil {
+			if err := deleteOldBackups(ctx, logCh, st, j, ofsPath, true); err != nil {
 				errs = multierror.Append(errs, err)
 			}
 		} else {
 			for _, ofsPart := range j.GetTargetOfsList() {
-				err := st.DeleteOldBackups(logCh, ofsPart, j, false)
-				if err != nil {
+				if err := deleteOldBackups(ctx, logCh, st, j, ofsPart, false); err != nil {
 					errs = multierror.Append(errs, err)
 				}
 			}
@@ -60,7 +62,46 @@ func (s Storages) DeleteOldBackups(logCh chan logger.LogRecord, j Job, ofsPath s
 	return errs.ErrorOrNil()
 }
 
-func (s Storages) Delivery(logCh chan logger.LogRecord, job Job) error {
+func deleteOldBackups(ctx context.Context, logCh chan logger.LogRecord, st Storage, j Job, ofsPart string, full bool) error {
+	_, span := tracing.Start(ctx, "DeleteOldBackups",
+		tracing.AttrStorage.String(st.GetName()),
+		tracing.AttrTarget.String(ofsPart),
+	)
+	stats, err := st.DeleteOldBackups(logCh, ofsPart, j, full)
+	span.SetAttributes(tracing.AttrDeleted.Int(stats.Deleted))
+	tracing.End(span, err)
+
+	j.SetOfsStorageMetrics(ofsPart, st.GetName(), map[string]float64{
+		metrics.RotatedCount: float64(stats.Rotated),
+		metrics.RotatedTotal: float64(stats.Rotated),
+		metrics.DeletedTotal: float64(stats.Deleted),
+	})
+	return err
+}
+
+// CollectUsage sets the number and the total size of backups of the job targets on each storage
+func (s Storages) CollectUsage(logCh chan logger.LogRecord, j Job) {
+	for _, st := range s {
+		for _, ofs := range j.GetTargetOfsList() {
+			list, err := st.ListBackups(ofs)
+			if err != nil {
+				logCh <- logger.Log(j.GetName(), st.GetName()).WithTarget(ofs).Debugf("Failed to list backups to collect storage usage: %s", err)
+				continue
+			}
+			list = storage.DropPartials(list)
+			var size int64
+			for _, f := range list {
+				size += f.Size
+			}
+			j.SetOfsStorageMetrics(ofs, st.GetName(), map[string]float64{
+				metrics.StorageBackups: float64(len(list)),
+				metrics.StorageUsage:   float64(size),
+			})
+		}
+	}
+}
+
+func (s Storages) Delivery(ctx context.Context, logCh chan logger.LogRecord, job Job) error {
 	errs := new(multierror.Error)
 
 	for ofs, dumpObj := range job.GetDumpObjects() {
@@ -70,18 +111,47 @@ func (s Storages) Delivery(logCh chan logger.LogRecord, job Job) error {
 		deliveryErrs := new(multierror.Error)
 		startTime := time.Now()
 		ok := float64(0)
+		// the temp file may be moved by the local storage
+		var size int64
+		if fi, err := os.Stat(dumpObj.TmpFile); err == nil {
+			size = fi.Size()
+		}
 		for _, st := range s {
-			if err := st.DeliveryBackup(logCh, job.GetName(), dumpObj.TmpFile, ofs, string(job.GetType())); err != nil {
+			stStartTime := time.Now()
+			stOk := float64(1)
+			_, span := tracing.Start(ctx, "Storages.Delivery",
+				tracing.AttrStorage.String(st.GetName()),
+				tracing.AttrTarget.String(ofs),
+				tracing.AttrBytes.Int64(size),
+			)
+			err := st.DeliveryBackup(logCh, job.GetName(), dumpObj.TmpFile, ofs, string(job.GetType()))
+			tracing.End(span, err)
+			if err != nil {
 				deliveryErrs = multierror.Append(deliveryErrs, err)
+				stOk = 0
+			} else {
+				deliveryLog := logger.Log(job.GetName(), st.GetName()).WithTarget(ofs).WithPhase(logger.PhaseDeliver)
+				logCh <- deliveryLog.WithDuration(time.Since(stStartTime)).WithBytes(size).Debugf("Delivery completed")
 			}
+			stValues := map[string]float64{
+				metrics.DeliveryOk:    stOk,
+				metrics.DeliveryTime:  float64(time.Since(stStartTime).Nanoseconds() / 1e6),
+				metrics.DeliveryBytes: float64(size),
+			}
+			if stOk == 1 {
+				stValues[metrics.LastSuccess] = float64(time.Now().Unix())
+			}
+			job.SetOfsStorageMetrics(ofs, st.GetName(), stValues)
+		}
+		values := map[string]float64{
+			metrics.DeliveryTime: float64(time.Since(startTime).Nanoseconds() / 1e6),
 		}
 		if deliveryErrs.Len() == 0 {
 			ok = float64(1)
+			values[metrics.LastSuccess] = float64(time.Now().Unix())
 		}
-		job.SetOfsMetrics(ofs, map[string]float64{
-			metrics.DeliveryOk:   ok,
-			metrics.DeliveryTime: float64(time.Since(startTime).Nanoseconds() / 1e6),
-		})
+		values[metrics.DeliveryOk] = ok
+		job.SetOfsMetrics(ofs, values)
 		if deliveryErrs.Len() < len(s) {
 			job.SetDumpObjectDelivered(ofs)
 		}
@@ -91,12 +161,46 @@ func (s Storages) Delivery(logCh chan logger.LogRecord, job Job) error {
 	return errs.ErrorOrNil()
 }
 
+// GetBackupPlan returns where backups are going to be delivered and which old backups are going to be deleted.
+// Temp files are expected by target ofs, targets without a temp file are only rotated.
+func (s Storages) GetBackupPlan(job Job, tmpFiles map[string]string) JobPlan {
+	jp := make(JobPlan)
+
+	for _, ofs := range job.GetTargetOfsList() {
+		tp := TargetPlan{TmpFile: tmpFiles[ofs]}
+		for _, st := range s {
+			var errs *multierror.Error
+			sp := StoragePlan{Name: st.GetName()}
+
+			if tp.TmpFile != "" {
+				dp, err := st.GetDeliveryPlan(tp.TmpFile, ofs, string(job.GetType()))
+				if err != nil {
+					errs = multierror.Append(errs, err)
+				}
+				sp.Delivery = dp
+			}
+
+			rp, err := st.GetRotationPlan(ofs, job, false)
+			if err != nil {
+				errs = multierror.Append(errs, err)
+			}
+			sp.Rotation = rp
+			sp.Err = errs.ErrorOrNil()
+
+			tp.Storages = append(tp.Storages, sp)
+		}
+		jp[ofs] = tp
+	}
+
+	return jp
+}
+
 func (s Storages) ListBackups(ofs string) TargetsOnStorages {
 	result := make(TargetsOnStorages)
 	for _, st := range s {
 		list, err := st.ListBackups(ofs)
 		result[st.GetName()] = TargetFiles{
-			List:    list,
+			List:    storage.DropPartials(list),
 			ListErr: err,
 		}
 	}
@@ -119,7 +223,8 @@ func (s Storages) CleanupTmpData(job Job) error {
 			}
 		}
 
-		// cleanup tmp backup file
+		// cleanup tmp backup file and its volumes
+		storage.RemoveVolumes(tmpBakFile)
 		if err := os.Remove(tmpBakFile); err != nil {
 			errs = multierror.Append(errs, err)
 		}
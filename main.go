@@ -34,6 +34,12 @@ func main() {
 				},
 				Handler: sigHandlerTerm,
 			},
+			{
+				Signals: []os.Signal{
+					syscall.SIGHUP,
+				},
+				Handler: sigHandlerReload,
+			},
 		}).
 		Run()
 	if err != nil {
@@ -49,3 +55,14 @@ func main() {
 func sigHandlerTerm(sig appctx.Signal) {
 	sig.Shutdown(nil)
 }
+
+// sigHandlerReload reloads the config in server mode, other commands are terminated on SIGHUP as before
+func sigHandlerReload(sig appctx.Signal) {
+	cc := sig.ValueGet().(*ctx.Ctx)
+	if cc.ReloadCh == nil {
+		sig.Shutdown(nil)
+		return
+	}
+	// the result is logged by the handler routine
+	_ = cc.Reload(sig.CtxDone())
+}
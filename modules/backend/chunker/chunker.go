@@ -0,0 +1,128 @@
+package chunker
+
+import (
+	"io"
+	"math/bits"
+)
+
+const DefaultAvgSize = 1024 * 1024
+
+// gear is a table of pseudo-random values for the rolling hash.
+// It is generated from a fixed seed, so chunk boundaries are stable between releases.
+var gear [256]uint64
+
+func init() {
+	seed := uint64(0x6e78732d6261636b)
+	for i := range gear {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunker splits a stream into content-defined chunks using FastCDC algorithm
+type Chunker struct {
+	r            io.Reader
+	minSize      int
+	avgSize      int
+	maxSize      int
+	maskS, maskL uint64
+	// buf holds at least maxSize bytes after fill unless the stream is over
+	buf      []byte
+	pos, end int
+	err      error
+}
+
+// New creates a chunker with the given average chunk size.
+// Minimal and maximal sizes are derived as avg/2 and avg*8 respectively.
+func New(r io.Reader, avgSize int) *Chunker {
+	if avgSize <= 0 {
+		avgSize = DefaultAvgSize
+	}
+	b := bits.Len(uint(avgSize)) - 1
+
+	return &Chunker{
+		r:       r,
+		minSize: avgSize / 2,
+		avgSize: avgSize,
+		maxSize: avgSize * 8,
+		// normalized chunking: harder to cut before avg size, easier after it
+		maskS: mask(b + 1),
+		maskL: mask(b - 1),
+		buf:   make([]byte, avgSize*16),
+	}
+}
+
+// Next returns the next chunk or io.EOF when the stream is over.
+// Returned slice is only valid until the next call.
+func (c *Chunker) Next() ([]byte, error) {
+	if c.end-c.pos < c.maxSize && c.err == nil {
+		c.fill()
+	}
+	if c.err != nil && c.err != io.EOF {
+		return nil, c.err
+	}
+	if c.pos == c.end {
+		return nil, io.EOF
+	}
+
+	n := c.cut(c.buf[c.pos:c.end])
+	chunk := c.buf[c.pos : c.pos+n]
+	c.pos += n
+	return chunk, nil
+}
+
+// fill moves the unread data to the start of the buffer and reads the stream till the buffer is full
+func (c *Chunker) fill() {
+	c.end = copy(c.buf, c.buf[c.pos:c.end])
+	c.pos = 0
+
+	for c.end < len(c.buf) && c.err == nil {
+		var n int
+		n, c.err = c.r.Read(c.buf[c.end:])
+		c.end += n
+	}
+}
+
+// cut returns the size of the chunk at the start of the data
+func (c *Chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.minSize {
+		return n
+	}
+	if n > c.maxSize {
+		n = c.maxSize
+	}
+
+	var h uint64
+	for i := max(c.minSize, 1) - 1; i < n; i++ {
+		// the chunk of the max size is cut without checking the hash of its last byte
+		if i+1 >= c.maxSize {
+			return c.maxSize
+		}
+
+		h = (h << 1) + gear[data[i]]
+		m := c.maskL
+		if i+1 < c.avgSize {
+			m = c.maskS
+		}
+		if h&m == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+func mask(n int) uint64 {
+	if n < 1 {
+		n = 1
+	}
+	if n > 63 {
+		n = 63
+	}
+	// use the highest bits, they depend on the widest window of the gear hash
+	return ((uint64(1) << n) - 1) << (64 - n)
+}
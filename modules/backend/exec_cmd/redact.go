@@ -0,0 +1,46 @@
+package exec_cmd
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+const masked = "******"
+
+var (
+	urlPasswdRx  = regexp.MustCompile(`(://[^/?#@\s:]*:)[^/?#@\s]+@`)
+	secretFlagRx = regexp.MustCompile(`(?i)^--?(password|passwd|pass|pwd|secret|token|auth)(=|$)`)
+)
+
+// Redact masks passwords of URLs in the string
+func Redact(s string) string {
+	return urlPasswdRx.ReplaceAllString(s, "${1}"+masked+"@")
+}
+
+// String returns the command line like exec.Cmd.String does, with masked passwords of URLs and
+// values of password flags such as `--password=x` or `--pass x`
+func String(cmd *exec.Cmd) string {
+	b := new(strings.Builder)
+	b.WriteString(cmd.Path)
+
+	maskNext := false
+	for _, a := range cmd.Args[1:] {
+		b.WriteByte(' ')
+		switch {
+		case maskNext:
+			b.WriteString(masked)
+			maskNext = false
+		case secretFlagRx.MatchString(a):
+			if flag, _, ok := strings.Cut(a, "="); ok {
+				b.WriteString(flag + "=" + masked)
+			} else {
+				b.WriteString(a)
+				maskNext = true
+			}
+		default:
+			b.WriteString(Redact(a))
+		}
+	}
+	return b.String()
+}
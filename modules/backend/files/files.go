@@ -4,9 +4,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"syscall"
 
 	"github.com/juju/ratelimit"
 	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
 
 	"github.com/nixys/nxs-backup/misc"
 )
@@ -60,6 +62,20 @@ func DeleteTmpMysqlAuthFile(path string) error {
 	return os.RemoveAll(path)
 }
 
+// CreateTmpMongoAuthFile creates the mongodump config file with the password
+func CreateTmpMongoAuthFile(passwd string) (authFile string, err error) {
+	data, err := yaml.Marshal(map[string]string{"password": passwd})
+	if err != nil {
+		return
+	}
+
+	authFile = filepath.Join("/tmp", misc.RandString(20))
+	if err = os.WriteFile(authFile, data, 0400); err != nil {
+		_ = os.Remove(authFile)
+	}
+	return
+}
+
 func GetLimitedFileWriter(filePath string, rateLim int64) (io.WriteCloser, error) {
 	file, err := os.Create(filePath)
 	if err != nil {
@@ -98,3 +114,29 @@ func GetLimitedFileReader(filePath string, rateLim int64) (*LimitedReadCloser, e
 
 	return lrc, err
 }
+
+func GetLimitedReader(r io.Reader, rateLim int64) io.Reader {
+	if rateLim == 0 {
+		return r
+	}
+	bucket := ratelimit.NewBucketWithRate(float64(rateLim), rateLim*2)
+	return ratelimit.Reader(r, bucket)
+}
+
+// FreeSpace returns the space available to the user on the filesystem of the path. The path may not exist yet,
+// the nearest existing parent directory is checked then
+func FreeSpace(p string) (int64, error) {
+	p = filepath.Clean(p)
+	for {
+		var st syscall.Statfs_t
+		err := syscall.Statfs(p, &st)
+		if err == nil {
+			return int64(st.Bavail) * int64(st.Bsize), nil
+		}
+		parent := filepath.Dir(p)
+		if !os.IsNotExist(err) || parent == p {
+			return 0, err
+		}
+		p = parent
+	}
+}
@@ -1,5 +1,21 @@
 package webdav
 
+import "fmt"
+
+// StatusError is the error response of the WebDAV server
+type StatusError struct {
+	Code int
+	msg  string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s(%d): %s", httpFriendlyStatus(e.Code), e.Code, e.msg)
+}
+
+func statusError(code int, format string, a ...any) *StatusError {
+	return &StatusError{Code: code, msg: fmt.Sprintf(format, a...)}
+}
+
 func httpFriendlyStatus(n int) string {
 	switch n {
 	case 400:
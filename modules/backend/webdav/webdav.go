@@ -142,7 +142,7 @@ func (w *Client) Ls(path string) ([]os.FileInfo, error) {
 	defer func() { _ = res.Body.Close() }()
 	if res.StatusCode >= 400 {
 		if res.StatusCode == 404 {
-			return nil, fmt.Errorf("%s: %v", path, fs.ErrNotExist)
+			return nil, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
 		}
 		return nil, fmt.Errorf("%s(%d): can't get things in %s", httpFriendlyStatus(res.StatusCode), res.StatusCode, filepath.Base(path))
 	}
@@ -198,7 +198,7 @@ func (w *Client) Mkdir(path string) error {
 	}
 	_ = res.Body.Close()
 	if res.StatusCode >= 400 {
-		return fmt.Errorf("%s(%d): can't create %s", httpFriendlyStatus(res.StatusCode), res.StatusCode, filepath.Base(path))
+		return statusError(res.StatusCode, "can't create %s", filepath.Base(path))
 	}
 	return nil
 }
@@ -210,7 +210,24 @@ func (w *Client) Upload(path string, file io.Reader) error {
 	}
 	_ = res.Body.Close()
 	if res.StatusCode >= 400 {
-		return fmt.Errorf("%s(%d): can't upload file %s", httpFriendlyStatus(res.StatusCode), res.StatusCode, filepath.Base(path))
+		return statusError(res.StatusCode, "can't upload file %s", filepath.Base(path))
+	}
+	return nil
+}
+
+// UploadRange writes the rest of the file from the offset with the partial PUT. Servers that don't support
+// the `Content-Range` header in requests may reply with error or overwrite the whole file with the part
+func (w *Client) UploadRange(path string, file io.Reader, offset, size int64) error {
+	res, err := w.request("PUT", path, file, func(req *http.Request) {
+		req.ContentLength = size - offset
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size))
+	})
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode >= 400 {
+		return statusError(res.StatusCode, "can't upload file %s from offset %d", filepath.Base(path), offset)
 	}
 	return nil
 }
@@ -225,7 +242,22 @@ func (w *Client) Copy(src, dst string) error {
 	}
 	_ = res.Body.Close()
 	if res.StatusCode >= 400 {
-		return fmt.Errorf("%s(%d): can't copy %s to %s", httpFriendlyStatus(res.StatusCode), res.StatusCode, src, dst)
+		return statusError(res.StatusCode, "can't copy %s to %s", src, dst)
+	}
+	return nil
+}
+
+func (w *Client) Move(src, dst string) error {
+	res, err := w.request("MOVE", src, nil, func(req *http.Request) {
+		req.Header.Add("Destination", w.URL+encodeURL(dst))
+		req.Header.Add("Overwrite", "T")
+	})
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode >= 400 {
+		return statusError(res.StatusCode, "can't move %s to %s", src, dst)
 	}
 	return nil
 }
@@ -236,6 +268,10 @@ func (w *Client) Read(path string) (io.ReadCloser, error) {
 		return nil, err
 	}
 	if res.StatusCode >= 400 {
+		_ = res.Body.Close()
+		if res.StatusCode == 404 {
+			return nil, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+		}
 		return nil, fmt.Errorf("%s(%d): can't read %s", httpFriendlyStatus(res.StatusCode), res.StatusCode, path)
 	}
 	return res.Body, nil
@@ -1,22 +1,51 @@
 package backup
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 
+	"github.com/docker/go-units"
 	"github.com/hashicorp/go-multierror"
 
 	"github.com/nixys/nxs-backup/interfaces"
 	"github.com/nixys/nxs-backup/misc"
+	"github.com/nixys/nxs-backup/modules/backend/files"
 	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/metrics"
+	"github.com/nixys/nxs-backup/modules/storage"
+	"github.com/nixys/nxs-backup/modules/storage/local"
+	"github.com/nixys/nxs-backup/modules/tracing"
 )
 
-func Perform(logCh chan logger.LogRecord, job interfaces.Job) error {
+// Modes of the free space check
+const (
+	FreeSpaceCheckAbort    = "abort"
+	FreeSpaceCheckWarn     = "warn"
+	FreeSpaceCheckDisabled = "disabled"
+)
+
+var FreeSpaceChecks = []string{FreeSpaceCheckAbort, FreeSpaceCheckWarn, FreeSpaceCheckDisabled}
+
+// Opts are the options of the backup run
+type Opts struct {
+	Metrics        *metrics.Data
+	FreeSpaceCheck string
+}
+
+func Perform(ctx context.Context, logCh chan logger.LogRecord, job interfaces.Job, o Opts) (err error) {
 	var errs *multierror.Error
 	var tmpDirPath string
 
+	ctx, span := tracing.Start(ctx, "backup.Perform",
+		tracing.AttrJobName.String(job.GetName()),
+		tracing.AttrJobType.String(string(job.GetType())),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	if !job.NeedToMakeBackup() {
 		logCh <- logger.Log(job.GetName(), "").Infof("According to the backup plan today new backups are not created for job %s", job.GetName())
 		return nil
@@ -27,16 +56,22 @@ func Perform(logCh chan logger.LogRecord, job interfaces.Job) error {
 		return nil
 	}
 
+	if err = checkFreeSpace(logCh, job, o); err != nil {
+		for _, ofs := range job.GetTargetOfsList() {
+			job.SetOfsMetrics(ofs, map[string]float64{metrics.BackupOk: 0})
+		}
+		return err
+	}
+
 	if !job.IsBackupSafety() {
-		if err := job.DeleteOldBackups(logCh, ""); err != nil {
+		if err := job.DeleteOldBackups(ctx, logCh, ""); err != nil {
 			errs = multierror.Append(errs, err)
 		}
 	}
 
 	logCh <- logger.Log(job.GetName(), "").Info("Starting")
 
-	if jobTmpDir := job.GetTempDir(); jobTmpDir != "" {
-		tmpDirPath = path.Join(jobTmpDir, fmt.Sprintf("%s_%s", job.GetType(), misc.GetDateTimeNow("")))
+	if tmpDirPath = GetTmpDirPath(job); tmpDirPath != "" {
 		err := os.MkdirAll(tmpDirPath, os.ModePerm)
 		if err != nil {
 			logCh <- logger.Log(job.GetName(), "").Errorf("Job `%s` failed. Unable to create tmp dir with next error: %s", job.GetName(), err)
@@ -45,8 +80,11 @@ func Perform(logCh chan logger.LogRecord, job interfaces.Job) error {
 		}
 	}
 
-	if err := job.DoBackup(logCh, tmpDirPath); err != nil {
-		errs = multierror.Append(errs, err)
+	dCtx, dSpan := tracing.Start(ctx, "DoBackup")
+	dErr := job.DoBackup(dCtx, logCh, tmpDirPath)
+	tracing.End(dSpan, dErr)
+	if dErr != nil {
+		errs = multierror.Append(errs, dErr)
 	}
 
 	_ = job.CleanupTmpData()
@@ -66,12 +104,95 @@ func Perform(logCh chan logger.LogRecord, job interfaces.Job) error {
 	_ = os.Remove(tmpDirPath)
 
 	if job.IsBackupSafety() {
-		if err := job.DeleteOldBackups(logCh, ""); err != nil {
+		if err := job.DeleteOldBackups(ctx, logCh, ""); err != nil {
 			errs = multierror.Append(errs, err)
 		}
 	}
 
+	job.CollectStorageUsage(logCh)
+
 	logCh <- logger.Log(job.GetName(), "").Info("Finished")
 
 	return errs.ErrorOrNil()
 }
+
+// checkFreeSpace compares the expected size of the backup with the free space in the temp dir and on the local storage
+func checkFreeSpace(logCh chan logger.LogRecord, job interfaces.Job, o Opts) error {
+	if o.FreeSpaceCheck == FreeSpaceCheckDisabled {
+		return nil
+	}
+	log := logger.Log(job.GetName(), "")
+
+	size, source := estimateBackupSize(logCh, job, o.Metrics)
+	if size == 0 {
+		logCh <- log.Debug("Unable to estimate the backup size, the free space check is skipped")
+		return nil
+	}
+
+	// the backup split into volumes takes twice as much space in the temp dir till the delivery is over
+	tmpSize := size
+	var paths []string
+	for _, st := range job.GetStorages() {
+		if vs, ok := st.(storage.VolumeSplitter); ok && vs.VolumeSize() > 0 {
+			tmpSize = 2 * size
+		}
+		if l, ok := st.(*local.Local); ok {
+			paths = append(paths, l.BackupPath())
+		}
+	}
+	if tmpDir := job.GetTempDir(); tmpDir != "" {
+		paths = append([]string{tmpDir}, paths...)
+	}
+
+	var errs *multierror.Error
+	for i, p := range paths {
+		need := size
+		if i == 0 && p == job.GetTempDir() {
+			need = tmpSize
+		}
+		free, err := files.FreeSpace(p)
+		if err != nil {
+			logCh <- log.Warnf("Unable to check free space in `%s`: %s", p, err)
+			continue
+		}
+		if free >= need {
+			logCh <- log.Debugf("Free space in `%s` is %s, %s expected by %s", p, units.HumanSize(float64(free)), units.HumanSize(float64(need)), source)
+			continue
+		}
+
+		msg := fmt.Sprintf("Not enough free space in `%s`: %s available, %s expected by %s", p, units.HumanSize(float64(free)), units.HumanSize(float64(need)), source)
+		if o.FreeSpaceCheck == FreeSpaceCheckAbort {
+			logCh <- log.Errorf("%s. The job is aborted before the rotation of old backups", msg)
+			errs = multierror.Append(errs, errors.New(msg))
+		} else {
+			logCh <- log.Warnf("%s. The backup may fail", msg)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// estimateBackupSize returns the size of the previous backup or the size of the databases and the source of the estimate
+func estimateBackupSize(logCh chan logger.LogRecord, job interfaces.Job, md *metrics.Data) (int64, string) {
+	if md != nil {
+		if size := md.LastBackupSize(job.GetName()); size > 0 {
+			return size, "the previous backup"
+		}
+	}
+	if e, ok := job.(interfaces.SizeEstimator); ok {
+		size, err := e.EstimateBackupSize()
+		if err != nil {
+			logCh <- logger.Log(job.GetName(), "").Debugf("Unable to get the databases size: %s", err)
+			return 0, ""
+		}
+		return size, "the databases size"
+	}
+	return 0, ""
+}
+
+// GetTmpDirPath returns the temp directory for the current job run or an empty string if job has no temp dir
+func GetTmpDirPath(job interfaces.Job) string {
+	if jobTmpDir := job.GetTempDir(); jobTmpDir != "" {
+		return path.Join(jobTmpDir, fmt.Sprintf("%s_%s", job.GetType(), misc.GetDateTimeNow("")))
+	}
+	return ""
+}
@@ -2,8 +2,10 @@ package external
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/nixys/nxs-backup/modules/backend/exec_cmd"
 	"github.com/nixys/nxs-backup/modules/backend/targz"
 	"os"
 	"os/exec"
@@ -13,6 +15,7 @@ import (
 	"github.com/nixys/nxs-backup/misc"
 	"github.com/nixys/nxs-backup/modules/logger"
 	"github.com/nixys/nxs-backup/modules/metrics"
+	"github.com/nixys/nxs-backup/modules/tracing"
 )
 
 type job struct {
@@ -82,6 +85,10 @@ func (j *job) SetOfsMetrics(_ string, metrics map[string]float64) {
 	}
 }
 
+func (j *job) SetOfsStorageMetrics(_, storage string, metricsMap map[string]float64) {
+	j.appMetrics.SetStorageValues(j.name, j.name, storage, metricsMap)
+}
+
 func (j *job) GetName() string {
 	return j.name
 }
@@ -102,6 +109,10 @@ func (j *job) GetStoragesCount() int {
 	return len(j.storages)
 }
 
+func (j *job) GetStorages() interfaces.Storages {
+	return j.storages
+}
+
 func (j *job) GetDumpObjects() map[string]interfaces.DumpObject {
 	return j.dumpedObjects
 }
@@ -116,6 +127,14 @@ func (j *job) ListBackups() interfaces.JobTargets {
 	return jt
 }
 
+// GetBackupPlan returns only rotation plan, the backup file is known after the dump command is done
+func (j *job) GetBackupPlan(_ string) interfaces.JobPlan {
+	if j.skipBackupRotate {
+		return interfaces.JobPlan{}
+	}
+	return j.storages.GetBackupPlan(j, nil)
+}
+
 func (j *job) SetDumpObjectDelivered(ofs string) {
 	dumpObj := j.dumpedObjects[ofs]
 	dumpObj.Delivered = true
@@ -134,24 +153,33 @@ func (j *job) NeedToUpdateIncMeta() bool {
 	return false
 }
 
-func (j *job) DeleteOldBackups(logCh chan logger.LogRecord, ofsPath string) error {
-	logCh <- logger.Log(j.name, "").Debugf("Starting rotate outdated backups.")
+func (j *job) DeleteOldBackups(ctx context.Context, logCh chan logger.LogRecord, ofsPath string) error {
+	logCh <- logger.Log(j.name, "").WithTarget(ofsPath).WithPhase(logger.PhaseRotate).Debugf("Starting rotate outdated backups.")
 	if j.skipBackupRotate {
-		logCh <- logger.Log(j.name, "").Debugf("Backup rotate skipped by config.")
+		logCh <- logger.Log(j.name, "").WithPhase(logger.PhaseRotate).Debugf("Backup rotate skipped by config.")
 		return nil
 	}
-	return j.storages.DeleteOldBackups(logCh, j, ofsPath)
+	return j.storages.DeleteOldBackups(ctx, logCh, j, ofsPath)
 }
 
 func (j *job) CleanupTmpData() error {
 	return j.storages.CleanupTmpData(j)
 }
 
-func (j *job) DoBackup(logCh chan logger.LogRecord, _ string) (err error) {
+func (j *job) CollectStorageUsage(logCh chan logger.LogRecord) {
+	// backups on storages are listed only if metrics are saved
+	if j.appMetrics.Enabled {
+		j.storages.CollectUsage(logCh, j)
+	}
+}
+
+func (j *job) DoBackup(ctx context.Context, logCh chan logger.LogRecord, _ string) (err error) {
 
 	var stderr, stdout bytes.Buffer
 
 	startTime := time.Now()
+	dumpLog := logger.Log(j.name, "").WithPhase(logger.PhaseDump)
+	_, span := tracing.Start(ctx, "createTmpBackup")
 
 	j.SetOfsMetrics("", map[string]float64{
 		metrics.BackupOk:        float64(0),
@@ -164,7 +192,7 @@ func (j *job) DoBackup(logCh chan logger.LogRecord, _ string) (err error) {
 
 	defer func() {
 		if err != nil {
-			logCh <- logger.Log(j.name, "").Error("Failed to create temp backup.")
+			logCh <- dumpLog.Error("Failed to create temp backup.")
 		}
 	}()
 
@@ -180,16 +208,17 @@ func (j *job) DoBackup(logCh chan logger.LogRecord, _ string) (err error) {
 		cmd.Env = envs
 	}
 
-	logCh <- logger.Log(j.name, "").Debugf("Dump cmd: %s", cmd.String())
+	logCh <- dumpLog.Debugf("Dump cmd: %s", exec_cmd.String(cmd))
 
-	logCh <- logger.Log(j.name, "").Infof("Starting of `%s`", j.dumpCmd)
+	logCh <- dumpLog.Infof("Starting of `%s`", exec_cmd.Redact(j.dumpCmd))
 	if err = cmd.Run(); err != nil {
 		j.SetOfsMetrics("", map[string]float64{
 			metrics.BackupTime: float64(time.Since(startTime).Nanoseconds() / 1e6),
 		})
-		logCh <- logger.Log(j.name, "").Errorf("Unable to finish `%s`. Error: %s", j.dumpCmd, err)
-		logCh <- logger.Log(j.name, "").Debugf("STDOUT: %s", stdout.String())
-		logCh <- logger.Log(j.name, "").Debugf("STDERR: %s", stderr.String())
+		logCh <- dumpLog.Errorf("Unable to finish `%s`. Error: %s", exec_cmd.Redact(j.dumpCmd), exec_cmd.Redact(err.Error()))
+		logCh <- dumpLog.Debugf("STDOUT: %s", stdout.String())
+		logCh <- dumpLog.Debugf("STDERR: %s", stderr.String())
+		tracing.End(span, err)
 		return err
 	}
 	j.SetOfsMetrics("", map[string]float64{
@@ -197,10 +226,11 @@ func (j *job) DoBackup(logCh chan logger.LogRecord, _ string) (err error) {
 		metrics.BackupTime: float64(time.Since(startTime).Nanoseconds() / 1e6),
 	})
 
-	logCh <- logger.Log(j.name, "").Infof("Dumping completed")
-	logCh <- logger.Log(j.name, "").Debugf("STDOUT: %s", stdout.String())
+	logCh <- dumpLog.Infof("Dumping completed")
+	logCh <- dumpLog.Debugf("STDOUT: %s", stdout.String())
 
 	if j.skipBackupRotate {
+		tracing.End(span, nil)
 		return
 	}
 
@@ -209,29 +239,33 @@ func (j *job) DoBackup(logCh chan logger.LogRecord, _ string) (err error) {
 	}
 	err = json.Unmarshal(stdout.Bytes(), &out)
 	if err != nil {
-		logCh <- logger.Log(j.name, "").Errorf("Unable to parse execution result. Error: %s", err)
+		logCh <- dumpLog.Errorf("Unable to parse execution result. Error: %s", err)
+		tracing.End(span, err)
 		return err
 	}
 	tmpBackupPath := out.FullPath
 	if j.gzip {
 		newTmpBackup := tmpBackupPath + ".gz"
 		if err = targz.GZip(tmpBackupPath, newTmpBackup, j.diskRateLimit); err != nil {
-			logCh <- logger.Log(j.name, "").Errorf("Unable to gzip tmp backup: %s", err)
+			logCh <- dumpLog.Errorf("Unable to gzip tmp backup: %s", err)
+			tracing.End(span, err)
 			return err
 		}
 		_ = os.RemoveAll(tmpBackupPath)
 		tmpBackupPath = newTmpBackup
 	}
 
-	logCh <- logger.Log(j.name, "").Debugf("Created temp backup %s.", tmpBackupPath)
-
 	j.dumpedObjects[j.name] = interfaces.DumpObject{TmpFile: tmpBackupPath}
 	fileInfo, _ := os.Stat(tmpBackupPath)
 	j.SetOfsMetrics("", map[string]float64{
 		metrics.BackupSize: float64(fileInfo.Size()),
 	})
 
-	return j.storages.Delivery(logCh, j)
+	logCh <- dumpLog.WithDuration(time.Since(startTime)).WithBytes(fileInfo.Size()).Debugf("Created temp backup %s.", tmpBackupPath)
+	span.SetAttributes(tracing.AttrBytes.Int64(fileInfo.Size()))
+	tracing.End(span, nil)
+
+	return j.storages.Delivery(ctx, logCh, j)
 }
 
 func (j *job) Close() error {
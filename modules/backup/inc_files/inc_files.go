@@ -1,6 +1,7 @@
 package inc_files
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -20,6 +21,7 @@ import (
 	"github.com/nixys/nxs-backup/modules/backend/targz"
 	"github.com/nixys/nxs-backup/modules/logger"
 	"github.com/nixys/nxs-backup/modules/metrics"
+	"github.com/nixys/nxs-backup/modules/tracing"
 )
 
 type job struct {
@@ -142,6 +144,10 @@ func (j *job) SetOfsMetrics(ofs string, metricsMap map[string]float64) {
 	}
 }
 
+func (j *job) SetOfsStorageMetrics(ofs, storage string, metricsMap map[string]float64) {
+	j.appMetrics.SetStorageValues(j.name, ofs, storage, metricsMap)
+}
+
 func (j *job) GetName() string {
 	return j.name
 }
@@ -165,6 +171,10 @@ func (j *job) GetStoragesCount() int {
 	return len(j.storages)
 }
 
+func (j *job) GetStorages() interfaces.Storages {
+	return j.storages
+}
+
 func (j *job) GetDumpObjects() map[string]interfaces.DumpObject {
 	return j.dumpedObjects
 }
@@ -180,6 +190,14 @@ func (j *job) ListBackups() interfaces.JobTargets {
 	return jt
 }
 
+func (j *job) GetBackupPlan(tmpDir string) interfaces.JobPlan {
+	tmpFiles := make(map[string]string)
+	for ofsPart, tgt := range j.targets {
+		tmpFiles[ofsPart] = misc.GetFileFullPath(tmpDir, ofsPart, "tar", "", tgt.gzip)
+	}
+	return j.storages.GetBackupPlan(j, tmpFiles)
+}
+
 func (j *job) SetDumpObjectDelivered(ofs string) {
 	dumpObj := j.dumpedObjects[ofs]
 	dumpObj.Delivered = true
@@ -190,15 +208,22 @@ func (j *job) IsBackupSafety() bool {
 	return j.safetyBackup
 }
 
-func (j *job) DeleteOldBackups(logCh chan logger.LogRecord, ofsPath string) error {
-	logCh <- logger.Log(j.name, "").Debugf("Starting rotate outdated backups.")
-	return j.storages.DeleteOldBackups(logCh, j, ofsPath)
+func (j *job) DeleteOldBackups(ctx context.Context, logCh chan logger.LogRecord, ofsPath string) error {
+	logCh <- logger.Log(j.name, "").WithTarget(ofsPath).WithPhase(logger.PhaseRotate).Debugf("Starting rotate outdated backups.")
+	return j.storages.DeleteOldBackups(ctx, logCh, j, ofsPath)
 }
 
 func (j *job) CleanupTmpData() error {
 	return j.storages.CleanupTmpData(j)
 }
 
+func (j *job) CollectStorageUsage(logCh chan logger.LogRecord) {
+	// backups on storages are listed only if metrics are saved
+	if j.appMetrics.Enabled {
+		j.storages.CollectUsage(logCh, j)
+	}
+}
+
 func (j *job) NeedToMakeBackup() bool {
 	return true
 }
@@ -207,11 +232,13 @@ func (j *job) NeedToUpdateIncMeta() bool {
 	return true
 }
 
-func (j *job) DoBackup(logCh chan logger.LogRecord, tmpDir string) error {
+func (j *job) DoBackup(ctx context.Context, logCh chan logger.LogRecord, tmpDir string) error {
 	var errs *multierror.Error
 
 	for ofsPart, tgt := range j.targets {
 		startTime := time.Now()
+		dumpLog := logger.Log(j.name, "").WithTarget(ofsPart).WithPhase(logger.PhaseDump)
+		_, span := tracing.Start(ctx, "createTmpBackup", tracing.AttrTarget.String(ofsPart))
 
 		j.SetOfsMetrics(ofsPart, map[string]float64{
 			metrics.BackupOk:        float64(0),
@@ -225,21 +252,23 @@ func (j *job) DoBackup(logCh chan logger.LogRecord, tmpDir string) error {
 		tmpBackupFile := misc.GetFileFullPath(tmpDir, ofsPart, "tar", "", tgt.gzip)
 		err := os.MkdirAll(path.Dir(tmpBackupFile), os.ModePerm)
 		if err != nil {
-			logCh <- logger.Log(j.name, "").Errorf("Unable to create tmp dir with next error: %s", err)
+			logCh <- dumpLog.Errorf("Unable to create tmp dir with next error: %s", err)
 			errs = multierror.Append(errs, err)
+			tracing.End(span, err)
 			continue
 		}
 
 		initMeta, err := j.getPreviousMetadata(logCh, ofsPart, tmpBackupFile)
 		if err != nil {
 			errs = multierror.Append(errs, err)
+			tracing.End(span, err)
 			continue
 		}
 
 		if initMeta {
-			logCh <- logger.Log(j.name, "").Info("Incremental backup will be reinitialized.")
+			logCh <- dumpLog.Info("Incremental backup will be reinitialized.")
 
-			if err = j.DeleteOldBackups(logCh, ofsPart); err != nil {
+			if err = j.DeleteOldBackups(ctx, logCh, ofsPart); err != nil {
 				errs = multierror.Append(errs, err)
 			}
 			if _, err = os.Create(tmpBackupFile + ".init"); err != nil {
@@ -259,12 +288,13 @@ func (j *job) DoBackup(logCh chan logger.LogRecord, tmpDir string) error {
 			j.SetOfsMetrics(ofsPart, map[string]float64{
 				metrics.BackupTime: float64(time.Since(startTime).Nanoseconds() / 1e6),
 			})
-			logCh <- logger.Log(j.name, "").Errorf("Failed to create temp backup %s", tmpBackupFile)
-			logCh <- logger.Log(j.name, "").Error(err)
+			logCh <- dumpLog.Errorf("Failed to create temp backup %s", tmpBackupFile)
+			logCh <- dumpLog.Error(err)
 			if serr, ok := err.(targz.Error); ok {
-				logCh <- logger.Log(j.name, "").Debugf("STDERR: %s", serr.Stderr)
+				logCh <- dumpLog.Debugf("STDERR: %s", serr.Stderr)
 			}
 			errs = multierror.Append(errs, err)
+			tracing.End(span, err)
 			continue
 		}
 		fileInfo, _ := os.Stat(tmpBackupFile)
@@ -274,18 +304,20 @@ func (j *job) DoBackup(logCh chan logger.LogRecord, tmpDir string) error {
 			metrics.BackupSize: float64(fileInfo.Size()),
 		})
 
-		logCh <- logger.Log(j.name, "").Debugf("Created temp backup %s", tmpBackupFile)
+		logCh <- dumpLog.WithDuration(time.Since(startTime)).WithBytes(fileInfo.Size()).Debugf("Created temp backup %s", tmpBackupFile)
+		span.SetAttributes(tracing.AttrBytes.Int64(fileInfo.Size()))
+		tracing.End(span, nil)
 
 		j.dumpedObjects[ofsPart] = interfaces.DumpObject{TmpFile: tmpBackupFile}
 		if !j.deferredCopying {
-			if err = j.storages.Delivery(logCh, j); err != nil {
+			if err = j.storages.Delivery(ctx, logCh, j); err != nil {
 				logCh <- logger.Log(j.name, "").Errorf("Failed to delivery backup. Errors: %v", err)
 				errs = multierror.Append(errs, err)
 			}
 		}
 	}
 
-	if err := j.storages.Delivery(logCh, j); err != nil {
+	if err := j.storages.Delivery(ctx, logCh, j); err != nil {
 		logCh <- logger.Log(j.name, "").Errorf("Failed to delivery backup. Errors: %v", err)
 		errs = multierror.Append(errs, err)
 	}
@@ -18,9 +18,11 @@ import (
 	"github.com/nixys/nxs-backup/interfaces"
 	"github.com/nixys/nxs-backup/misc"
 	"github.com/nixys/nxs-backup/modules/backend/exec_cmd"
+	"github.com/nixys/nxs-backup/modules/backend/files"
 	"github.com/nixys/nxs-backup/modules/backend/targz"
 	"github.com/nixys/nxs-backup/modules/logger"
 	"github.com/nixys/nxs-backup/modules/metrics"
+	"github.com/nixys/nxs-backup/modules/tracing"
 )
 
 type job struct {
@@ -177,6 +179,10 @@ func (j *job) SetOfsMetrics(ofs string, metricsMap map[string]float64) {
 	}
 }
 
+func (j *job) SetOfsStorageMetrics(ofs, storage string, metricsMap map[string]float64) {
+	j.appMetrics.SetStorageValues(j.name, ofs, storage, metricsMap)
+}
+
 func (j *job) GetName() string {
 	return j.name
 }
@@ -200,6 +206,10 @@ func (j *job) GetStoragesCount() int {
 	return len(j.storages)
 }
 
+func (j *job) GetStorages() interfaces.Storages {
+	return j.storages
+}
+
 func (j *job) GetDumpObjects() map[string]interfaces.DumpObject {
 	return j.dumpedObjects
 }
@@ -215,6 +225,14 @@ func (j *job) ListBackups() interfaces.JobTargets {
 	return jt
 }
 
+func (j *job) GetBackupPlan(tmpDir string) interfaces.JobPlan {
+	tmpFiles := make(map[string]string)
+	for ofsPart, tgt := range j.targets {
+		tmpFiles[ofsPart] = misc.GetFileFullPath(tmpDir, ofsPart, "tar", "", tgt.gzip)
+	}
+	return j.storages.GetBackupPlan(j, tmpFiles)
+}
+
 func (j *job) SetDumpObjectDelivered(ofs string) {
 	dumpObj := j.dumpedObjects[ofs]
 	dumpObj.Delivered = true
@@ -233,20 +251,29 @@ func (j *job) NeedToUpdateIncMeta() bool {
 	return false
 }
 
-func (j *job) DeleteOldBackups(logCh chan logger.LogRecord, ofsPath string) error {
-	logCh <- logger.Log(j.name, "").Debugf("Starting rotate outdated backups.")
-	return j.storages.DeleteOldBackups(logCh, j, ofsPath)
+func (j *job) DeleteOldBackups(ctx context.Context, logCh chan logger.LogRecord, ofsPath string) error {
+	logCh <- logger.Log(j.name, "").WithTarget(ofsPath).WithPhase(logger.PhaseRotate).Debugf("Starting rotate outdated backups.")
+	return j.storages.DeleteOldBackups(ctx, logCh, j, ofsPath)
 }
 
 func (j *job) CleanupTmpData() error {
 	return j.storages.CleanupTmpData(j)
 }
 
-func (j *job) DoBackup(logCh chan logger.LogRecord, tmpDir string) error {
+func (j *job) CollectStorageUsage(logCh chan logger.LogRecord) {
+	// backups on storages are listed only if metrics are saved
+	if j.appMetrics.Enabled {
+		j.storages.CollectUsage(logCh, j)
+	}
+}
+
+func (j *job) DoBackup(ctx context.Context, logCh chan logger.LogRecord, tmpDir string) error {
 	var errs *multierror.Error
 
 	for ofsPart, tgt := range j.targets {
 		startTime := time.Now()
+		dumpLog := logger.Log(j.name, "").WithTarget(ofsPart).WithPhase(logger.PhaseDump)
+		_, span := tracing.Start(ctx, "createTmpBackup", tracing.AttrTarget.String(ofsPart))
 
 		j.SetOfsMetrics(ofsPart, map[string]float64{
 			metrics.BackupOk:        float64(0),
@@ -260,8 +287,9 @@ func (j *job) DoBackup(logCh chan logger.LogRecord, tmpDir string) error {
 		tmpBackupFile := misc.GetFileFullPath(tmpDir, ofsPart, "tar", "", tgt.gzip)
 
 		if err := os.MkdirAll(path.Dir(tmpBackupFile), os.ModePerm); err != nil {
-			logCh <- logger.Log(j.name, "").Errorf("Unable to create tmp dir with next error: %s", err)
+			logCh <- dumpLog.Errorf("Unable to create tmp dir with next error: %s", err)
 			errs = multierror.Append(errs, err)
+			tracing.End(span, err)
 			continue
 		}
 
@@ -269,8 +297,9 @@ func (j *job) DoBackup(logCh chan logger.LogRecord, tmpDir string) error {
 			j.SetOfsMetrics(ofsPart, map[string]float64{
 				metrics.BackupTime: float64(time.Since(startTime).Nanoseconds() / 1e6),
 			})
-			logCh <- logger.Log(j.name, "").Errorf("Unable to create temp backups %s", tmpBackupFile)
+			logCh <- dumpLog.Errorf("Unable to create temp backups %s", tmpBackupFile)
 			errs = multierror.Append(errs, err)
+			tracing.End(span, err)
 			continue
 		}
 		fileInfo, _ := os.Stat(tmpBackupFile)
@@ -280,19 +309,21 @@ func (j *job) DoBackup(logCh chan logger.LogRecord, tmpDir string) error {
 			metrics.BackupSize: float64(fileInfo.Size()),
 		})
 
-		logCh <- logger.Log(j.name, "").Debugf("Created temp backups %s", tmpBackupFile)
+		logCh <- dumpLog.WithDuration(time.Since(startTime)).WithBytes(fileInfo.Size()).Debugf("Created temp backups %s", tmpBackupFile)
+		span.SetAttributes(tracing.AttrBytes.Int64(fileInfo.Size()))
+		tracing.End(span, nil)
 
 		j.dumpedObjects[ofsPart] = interfaces.DumpObject{TmpFile: tmpBackupFile}
 
 		if !j.deferredCopying {
-			if err := j.storages.Delivery(logCh, j); err != nil {
+			if err := j.storages.Delivery(ctx, logCh, j); err != nil {
 				logCh <- logger.Log(j.name, "").Errorf("Failed to delivery backup. Errors: %v", err)
 				errs = multierror.Append(errs, err)
 			}
 		}
 	}
 
-	if err := j.storages.Delivery(logCh, j); err != nil {
+	if err := j.storages.Delivery(ctx, logCh, j); err != nil {
 		logCh <- logger.Log(j.name, "").Errorf("Failed to delivery backup. Errors: %v", err)
 		errs = multierror.Append(errs, err)
 	}
@@ -314,7 +345,16 @@ func (j *job) createTmpBackup(logCh chan logger.LogRecord, tmpBackupFile string,
 		args = append(args, "--authenticationDatabase=admin")
 	}
 	args = append(args, "--username="+target.connOpts.User)
-	args = append(args, "--password="+target.connOpts.Passwd)
+	if target.connOpts.Passwd != "" {
+		// the password is passed in the config file to keep it out of the process list
+		authFile, err := files.CreateTmpMongoAuthFile(target.connOpts.Passwd)
+		if err != nil {
+			logCh <- logger.Log(j.name, "").Errorf("Unable to create tmp auth file. Error: %s", err)
+			return err
+		}
+		defer func() { _ = os.Remove(authFile) }()
+		args = append(args, "--config="+authFile)
+	}
 	// add db name
 	args = append(args, "--db="+target.dbName)
 
@@ -337,11 +377,11 @@ func (j *job) createTmpBackup(logCh chan logger.LogRecord, tmpBackupFile string,
 		cmd := exec.Command("mongodump", argsCol...)
 		cmd.Stdout = &stdout
 		cmd.Stderr = &stderr
-		logCh <- logger.Log(j.name, "").Debugf("Dump cmd: %s", cmd.String())
+		logCh <- logger.Log(j.name, "").Debugf("Dump cmd: %s", exec_cmd.String(cmd))
 		if err := cmd.Run(); err != nil {
 			logCh <- logger.Log(j.name, "").Errorf("Unable to dump `%s`. Error: %s", target.dbName, err)
 			logCh <- logger.Log(j.name, "").Debugf("STDOUT: %s", stdout.String())
-			logCh <- logger.Log(j.name, "").Debugf("STDERR: %s", stderr.String())
+			logCh <- logger.Log(j.name, "").Debugf("STDERR: %s", exec_cmd.Redact(stderr.String()))
 			return err
 		}
 		stdout.Reset()
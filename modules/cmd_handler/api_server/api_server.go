@@ -2,67 +2,205 @@ package api_server
 
 import (
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 
 	"github.com/nixys/nxs-backup/api"
+	"github.com/nixys/nxs-backup/api/ui"
 	"github.com/nixys/nxs-backup/modules/metrics"
+	"github.com/nixys/nxs-backup/modules/storage"
 )
 
 type Opts struct {
 	Bind           string
 	MetricFilePath string
-	Log            *logrus.Logger
-	Done           chan error
+	Project        string
+	Server         string
+	// OutboxCount returns the numbers of queued and failed notifications, nil if the outbox is disabled
+	OutboxCount func() (queued, failed int)
+	// UI is nil if the web UI is disabled
+	UI *ui.Opts
+	// StoragesCheck is run each CheckInterval, the checks are disabled if the interval is 0
+	StoragesCheck func() []storage.CheckResult
+	CheckInterval time.Duration
+	// APIToken protects the management API, the API is disabled if it's empty
+	APIToken string
+	// Reload reloads the config on the API request
+	Reload func(done <-chan struct{}) error
+	Log    *logrus.Logger
+	Done   chan error
 }
 
 type httpServer struct {
 	http.Server
-	log      *logrus.Logger
-	exporter *metrics.Exporter
-	registry *prometheus.Registry
-	done     chan error
+	done chan error
+	// reloaded wakes up the storages checks to run them with the new config
+	reloaded chan struct{}
+
+	mu            sync.RWMutex
+	log           *logrus.Logger
+	handler       http.Handler
+	exporter      *metrics.Exporter
+	storagesCheck func() []storage.CheckResult
+	checkInterval time.Duration
 }
 
 func Init(o Opts) (*httpServer, error) {
+	s := &httpServer{
+		Server: http.Server{
+			Addr:        o.Bind,
+			ReadTimeout: 10 * time.Second,
+			// listing of backups on remote storages may take a while
+			WriteTimeout: 60 * time.Second,
+		},
+		done:     o.Done,
+		reloaded: make(chan struct{}, 1),
+	}
+	s.Server.Handler = s
+
+	if err := s.apply(o); err != nil {
+		o.Log.Errorf("ctx init: %s", err.Error())
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload switches the server to the new options, the current ones are kept on error
+func (s *httpServer) Reload(o Opts) error {
+	if o.Bind != s.Addr {
+		o.Log.Warnf("Server keeps listening on %s, the change of `server.bind` requires restart", s.Addr)
+	}
+	if err := s.apply(o); err != nil {
+		return err
+	}
+
+	select {
+	case s.reloaded <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *httpServer) apply(o Opts) error {
 
 	exporter := metrics.InitExporter(
 		metrics.ExporterOpts{
 			Log:            o.Log,
 			MetricFilePath: o.MetricFilePath,
+			Project:        o.Project,
+			Server:         o.Server,
+			OutboxCount:    o.OutboxCount,
 		},
 	)
 
 	registry := prometheus.NewRegistry()
 	if err := registry.Register(exporter); err != nil {
-		o.Log.Errorf("ctx init: %s", err.Error())
-		return nil, err
+		return err
 	}
 
-	return &httpServer{
-		Server: http.Server{
-			Addr:         o.Bind,
-			ReadTimeout:  10 * time.Second,
-			WriteTimeout: 10 * time.Second,
-			Handler:      api.RoutesSet(o.Log, registry),
-		},
-		exporter: exporter,
-		registry: registry,
-		log:      o.Log,
-		done:     o.Done,
-	}, nil
+	var webUI *ui.UI
+	if o.UI != nil {
+		var err error
+		if webUI, err = ui.Init(*o.UI); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.log = o.Log
+	s.handler = api.RoutesSet(o.Log, registry, webUI, o.APIToken, o.Reload)
+	s.exporter = exporter
+	s.storagesCheck = o.StoragesCheck
+	s.checkInterval = o.CheckInterval
+	return nil
+}
+
+func (s *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	h := s.handler
+	s.mu.RUnlock()
+
+	h.ServeHTTP(w, r)
 }
 
 func (s *httpServer) Run() {
+	log := s.logger()
 
-	s.log.Trace("api: starting")
+	log.Trace("api: starting")
+	go s.checkStorages()
 	err := s.ListenAndServe()
 	if err != nil {
-		s.log.WithFields(logrus.Fields{
+		log.WithFields(logrus.Fields{
 			"details": err,
 		}).Debugf("api: server fail")
 	}
 	s.done <- err
 }
+
+func (s *httpServer) logger() *logrus.Logger {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.log
+}
+
+// checkStorages periodically checks the storages and updates the exported metrics,
+// the checks are restarted with the new interval on reload
+func (s *httpServer) checkStorages() {
+	for {
+		s.mu.RLock()
+		log, exporter, check, interval := s.log, s.exporter, s.storagesCheck, s.checkInterval
+		s.mu.RUnlock()
+
+		if check == nil || interval <= 0 {
+			<-s.reloaded
+			continue
+		}
+
+		runStoragesCheck(log, exporter, check)
+
+		t := time.NewTimer(interval)
+		select {
+		case <-t.C:
+		case <-s.reloaded:
+			t.Stop()
+		}
+	}
+}
+
+func runStoragesCheck(log *logrus.Logger, exporter *metrics.Exporter, check func() []storage.CheckResult) {
+	results := check()
+	checks := make([]metrics.StorageCheck, 0, len(results))
+	for _, r := range results {
+		ok := 0.0
+		if r.Ok() {
+			ok = 1
+		} else {
+			log.Warnf("Storage `%s` check failed at %s: %s", r.Storage, r.Step, r.Err)
+		}
+		values := map[string]float64{
+			metrics.CheckOk:          ok,
+			metrics.CheckTimestamp:   float64(time.Now().Unix()),
+			metrics.CheckConnectTime: r.ConnectTime.Seconds(),
+		}
+		if r.Path != "" && r.Ok() {
+			values[metrics.CheckLatency] = r.Latency.Seconds()
+			values[metrics.CheckWriteSpeed] = r.WriteSpeed
+			values[metrics.CheckReadSpeed] = r.ReadSpeed
+		}
+		if r.FreeSpace >= 0 {
+			values[metrics.CheckFreeSpace] = float64(r.FreeSpace)
+		}
+		checks = append(checks, metrics.StorageCheck{
+			Storage: r.Storage,
+			Job:     r.Job,
+			Path:    r.Path,
+			Values:  values,
+		})
+	}
+	exporter.SetStorageChecks(checks)
+}
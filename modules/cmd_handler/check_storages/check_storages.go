@@ -0,0 +1,112 @@
+package check_storages
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/fatih/color"
+
+	"github.com/nixys/nxs-backup/misc"
+	"github.com/nixys/nxs-backup/modules/storage"
+)
+
+type Opts struct {
+	InitErr error
+	Done    chan error
+	Check   func() []storage.CheckResult
+}
+
+type checkStorages struct {
+	initErr error
+	done    chan error
+	check   func() []storage.CheckResult
+}
+
+func Init(o Opts) *checkStorages {
+	return &checkStorages{
+		initErr: o.InitErr,
+		done:    o.Done,
+		check:   o.Check,
+	}
+}
+
+func (cs *checkStorages) Run() {
+	var err error
+
+	defer func() {
+		cs.done <- err
+	}()
+
+	if cs.initErr != nil {
+		color.HiRed("[WARNING!] Configuration initialised with errors:")
+		fmt.Println(cs.initErr)
+	}
+
+	results := cs.check()
+	if len(results) == 0 {
+		fmt.Println("No storages to check")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STORAGE\tJOB\tPATH\tCONNECT\tLATENCY\tWRITE\tREAD\tFREE\tSTATUS")
+	failed := 0
+	for _, r := range results {
+		status := "ok"
+		if !r.Ok() {
+			failed++
+			status = fmt.Sprintf("%s failed: %s", r.Step, r.Err)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Storage,
+			dash(r.Job),
+			dash(r.Path),
+			duration(r.ConnectTime),
+			duration(r.Latency),
+			rate(r.WriteSpeed),
+			rate(r.ReadSpeed),
+			free(r.FreeSpace),
+			status,
+		)
+	}
+	_ = w.Flush()
+
+	if failed > 0 {
+		color.HiRed("[WARNING!] %d of %d storage checks failed.", failed, len(results))
+		err = misc.ErrExecution
+	}
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func duration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "-"
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func rate(bps float64) string {
+	if bps == 0 {
+		return "-"
+	}
+	return units.HumanSize(bps) + "/s"
+}
+
+func free(b int64) string {
+	if b < 0 {
+		return "n/a"
+	}
+	return units.HumanSize(float64(b))
+}
@@ -0,0 +1,155 @@
+package dry_run
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/nixys/nxs-backup/interfaces"
+	"github.com/nixys/nxs-backup/misc"
+	"github.com/nixys/nxs-backup/modules/backup"
+)
+
+type Opts struct {
+	JobName  string
+	InitErr  error
+	Done     chan error
+	FileJobs interfaces.Jobs
+	DBJobs   interfaces.Jobs
+	ExtJobs  interfaces.Jobs
+	Jobs     map[string]interfaces.Job
+}
+
+type dryRun struct {
+	jobName  string
+	initErr  error
+	done     chan error
+	fileJobs interfaces.Jobs
+	dbJobs   interfaces.Jobs
+	extJobs  interfaces.Jobs
+	jobs     map[string]interfaces.Job
+}
+
+var (
+	bold       = color.New(color.Bold)
+	italic     = color.New(color.Italic)
+	italicBold = color.New(color.Italic, color.Bold)
+)
+
+func Init(o Opts) *dryRun {
+	return &dryRun{
+		jobName:  o.JobName,
+		initErr:  o.InitErr,
+		done:     o.Done,
+		fileJobs: o.FileJobs,
+		dbJobs:   o.DBJobs,
+		extJobs:  o.ExtJobs,
+		jobs:     o.Jobs,
+	}
+}
+
+// Run prints actions the backup would do without dumping, uploading or deleting anything
+func (dr *dryRun) Run() {
+	var err error
+	failed := false
+
+	defer func() {
+		dr.done <- err
+	}()
+
+	if dr.initErr != nil {
+		color.HiRed("[WARNING!] Backup plan initialised with errors:")
+		fmt.Println(dr.initErr)
+	}
+
+	color.HiYellow("Dry run. Nothing will be dumped, uploaded or deleted.\n\n")
+
+	if dr.jobName == "external" || dr.jobName == "all" {
+		failed = printPlans("External", dr.extJobs) || failed
+	}
+	if dr.jobName == "databases" || dr.jobName == "all" {
+		failed = printPlans("Database", dr.dbJobs) || failed
+	}
+	if dr.jobName == "files" || dr.jobName == "all" {
+		failed = printPlans("File", dr.fileJobs) || failed
+	}
+	if job, ok := dr.jobs[dr.jobName]; ok {
+		failed = printPlans("", interfaces.Jobs{job}) || failed
+	}
+
+	if failed {
+		color.HiRed("[WARNING!] Execution finished with errors.")
+		err = misc.ErrExecution
+	}
+}
+
+func printPlans(bType string, jobs interfaces.Jobs) (failed bool) {
+	if len(bType) > 0 && len(jobs) > 0 {
+		bold.Printf("%s backup jobs\n", bType)
+	}
+
+	for _, job := range jobs {
+		italicBold.Printf("%s (%s)\n", job.GetName(), job.GetType())
+
+		if !job.NeedToMakeBackup() {
+			fmt.Println("    According to the backup plan today new backups are not created")
+			continue
+		}
+		if job.GetStoragesCount() == 0 {
+			fmt.Println("    There are no configured storages for job")
+			continue
+		}
+
+		if job.IsBackupSafety() {
+			fmt.Println("    Old backups are deleted after new ones are delivered")
+		} else {
+			fmt.Println("    Old backups are deleted before new ones are made")
+		}
+
+		jp := job.GetBackupPlan(backup.GetTmpDirPath(job))
+
+		targets := make([]string, 0, len(jp))
+		for ofs := range jp {
+			targets = append(targets, ofs)
+		}
+		sort.Strings(targets)
+
+		for _, ofs := range targets {
+			tp := jp[ofs]
+			bold.Printf("    %s\n", ofs)
+			if tp.TmpFile != "" {
+				fmt.Printf("        temp file: %s\n", tp.TmpFile)
+			} else if job.GetType() == misc.External {
+				fmt.Println("        temp file: defined by the dump command")
+			}
+
+			for _, sp := range tp.Storages {
+				italic.Printf("        %s\n", sp.Name)
+				if sp.Delivery != nil {
+					printLines(sp.Delivery.String())
+				}
+				if sp.Rotation != nil {
+					printLines(sp.Rotation.String())
+				}
+				if sp.Err != nil {
+					color.HiRed("            failed to plan: %v", sp.Err)
+					failed = true
+				}
+			}
+		}
+		fmt.Println()
+	}
+
+	return
+}
+
+func printLines(s string) {
+	for _, l := range strings.Split(strings.TrimSpace(s), "\n") {
+		if l == "" {
+			continue
+		}
+		fmt.Printf("            %s\n", l)
+	}
+}
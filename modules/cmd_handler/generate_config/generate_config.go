@@ -88,11 +88,12 @@ type s3Params struct {
 }
 
 type sftpParams struct {
-	User     string `yaml:"user"`
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	Password string `yaml:"password"`
-	KeyFile  string `yaml:"key_file"`
+	User           string `yaml:"user"`
+	Host           string `yaml:"host"`
+	Port           int    `yaml:"port"`
+	Password       string `yaml:"password"`
+	KeyFile        string `yaml:"key_file"`
+	KnownHostsFile string `yaml:"known_hosts_file"`
 }
 
 type ftpParams struct {
@@ -492,10 +493,11 @@ func getStorageConnects(storages map[string]string) ([]*yaml.Node, error) {
 			}
 		case ast[1], ast[2], ast[3]:
 			st.ScpParams = &sftpParams{
-				Host:     "my_ssh_host",
-				Port:     22,
-				User:     "my_ssh_user",
-				Password: "my_ssh_password",
+				Host:           "my_ssh_host",
+				Port:           22,
+				User:           "my_ssh_user",
+				Password:       "my_ssh_password",
+				KnownHostsFile: "/root/.ssh/known_hosts",
 			}
 		case ast[4]:
 			st.FtpParams = &ftpParams{
@@ -1,16 +1,36 @@
 package list_backups
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
 	"github.com/fatih/color"
 	"github.com/hashicorp/go-multierror"
+	"gopkg.in/yaml.v3"
 
 	"github.com/nixys/nxs-backup/interfaces"
 	"github.com/nixys/nxs-backup/misc"
+	"github.com/nixys/nxs-backup/modules/storage"
+)
+
+const (
+	OutputTree = "tree"
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+	OutputCSV  = "csv"
 )
 
+// Outputs is the list of supported output formats
+var Outputs = []string{OutputTree, OutputJSON, OutputYAML, OutputCSV}
+
 type Opts struct {
 	JobName  string
+	Output   string
 	InitErr  error
 	Done     chan error
 	FileJobs interfaces.Jobs
@@ -21,6 +41,7 @@ type Opts struct {
 
 type listBackups struct {
 	jobName  string
+	output   string
 	initErr  error
 	done     chan error
 	fileJobs interfaces.Jobs
@@ -43,6 +64,7 @@ var (
 func Init(o Opts) *listBackups {
 	return &listBackups{
 		jobName:  o.JobName,
+		output:   o.Output,
 		initErr:  o.InitErr,
 		done:     o.Done,
 		fileJobs: o.FileJobs,
@@ -54,12 +76,18 @@ func Init(o Opts) *listBackups {
 
 func (lb *listBackups) Run() {
 	var err error
-	errs := new(multierror.Error)
 
 	defer func() {
 		lb.done <- err
 	}()
 
+	if lb.output != OutputTree {
+		err = lb.encodeBackups()
+		return
+	}
+
+	errs := new(multierror.Error)
+
 	if lb.initErr != nil {
 		color.HiRed("[WARNING!] Backup plan initialised with errors:")
 		fmt.Println(lb.initErr)
@@ -103,8 +131,15 @@ func printBackups(bType string, jobs interfaces.Jobs) (err error) {
 				jobTargetStFiles := make([]treeElement, 0, len(tFiles.List))
 				if tFiles.ListErr == nil {
 					for _, f := range tFiles.List {
+						name := f.Path
+						if f.Volumes > 0 {
+							name = fmt.Sprintf("%s (%d volumes)", name, f.Volumes)
+						}
+						if f.LockedUntil != nil {
+							name = fmt.Sprintf("%s (locked until %s)", name, f.LockedUntil.Format(time.RFC3339))
+						}
 						jobTargetStFiles = append(jobTargetStFiles, treeElement{
-							name: f,
+							name: name,
 						})
 					}
 				} else {
@@ -166,3 +201,132 @@ func printlnWithLevel(level int, msg string) {
 		fmt.Println(msg)
 	}
 }
+
+type jobBackups struct {
+	Job     string          `json:"job" yaml:"job"`
+	Type    string          `json:"type" yaml:"type"`
+	Targets []targetBackups `json:"targets" yaml:"targets"`
+}
+
+type targetBackups struct {
+	Target   string           `json:"target" yaml:"target"`
+	Storages []storageBackups `json:"storages" yaml:"storages"`
+}
+
+type storageBackups struct {
+	Storage string               `json:"storage" yaml:"storage"`
+	Files   []storage.BackupFile `json:"files" yaml:"files"`
+	Error   string               `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// encodeBackups writes backups of the selected jobs to stdout in the machine-readable format,
+// warnings are written to stderr to keep the output parsable
+func (lb *listBackups) encodeBackups() error {
+	if lb.initErr != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "[WARNING!] Backup plan initialised with errors:\n%v\n", lb.initErr)
+	}
+
+	var jobs interfaces.Jobs
+	if lb.jobName == "external" || lb.jobName == "all" {
+		jobs = append(jobs, lb.extJobs...)
+	}
+	if lb.jobName == "databases" || lb.jobName == "all" {
+		jobs = append(jobs, lb.dbJobs...)
+	}
+	if lb.jobName == "files" || lb.jobName == "all" {
+		jobs = append(jobs, lb.fileJobs...)
+	}
+	if job, ok := lb.jobs[lb.jobName]; ok {
+		jobs = append(jobs, job)
+	}
+
+	listFailed := false
+	backups := make([]jobBackups, 0, len(jobs))
+	for _, job := range jobs {
+		jb := jobBackups{
+			Job:     job.GetName(),
+			Type:    string(job.GetType()),
+			Targets: make([]targetBackups, 0),
+		}
+		for tName, tOnSt := range job.ListBackups() {
+			tb := targetBackups{Target: tName, Storages: make([]storageBackups, 0, len(tOnSt))}
+			for st, tFiles := range tOnSt {
+				sb := storageBackups{Storage: st, Files: tFiles.List}
+				if sb.Files == nil {
+					sb.Files = make([]storage.BackupFile, 0)
+				}
+				if tFiles.ListErr != nil {
+					sb.Error = tFiles.ListErr.Error()
+					listFailed = true
+				}
+				tb.Storages = append(tb.Storages, sb)
+			}
+			sort.Slice(tb.Storages, func(i, k int) bool { return tb.Storages[i].Storage < tb.Storages[k].Storage })
+			jb.Targets = append(jb.Targets, tb)
+		}
+		sort.Slice(jb.Targets, func(i, k int) bool { return jb.Targets[i].Target < jb.Targets[k].Target })
+		backups = append(backups, jb)
+	}
+
+	var err error
+	switch lb.output {
+	case OutputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(backups)
+	case OutputYAML:
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		err = enc.Encode(backups)
+		if cErr := enc.Close(); err == nil {
+			err = cErr
+		}
+	case OutputCSV:
+		err = writeCSV(backups)
+	default:
+		err = fmt.Errorf("unknown output format \"%s\"", lb.output)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Failed to write backups list: %v\n", err)
+		return misc.ErrExecution
+	}
+	if listFailed {
+		_, _ = fmt.Fprintln(os.Stderr, "[WARNING!] Execution finished with errors.")
+		return misc.ErrExecution
+	}
+	return nil
+}
+
+// writeCSV writes a row per backup file, a listing error gets a row with empty file fields
+func writeCSV(backups []jobBackups) error {
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write([]string{"job", "type", "target", "storage", "path", "size", "mod_time", "tier", "locked_until", "volumes", "error"})
+
+	for _, jb := range backups {
+		for _, tb := range jb.Targets {
+			for _, sb := range tb.Storages {
+				if sb.Error != "" {
+					_ = w.Write([]string{jb.Job, jb.Type, tb.Target, sb.Storage, "", "", "", "", "", "", sb.Error})
+				}
+				for _, f := range sb.Files {
+					lockedUntil := ""
+					if f.LockedUntil != nil {
+						lockedUntil = f.LockedUntil.Format(time.RFC3339)
+					}
+					_ = w.Write([]string{
+						jb.Job, jb.Type, tb.Target, sb.Storage,
+						f.Path,
+						strconv.FormatInt(f.Size, 10),
+						f.ModTime.Format(time.RFC3339),
+						f.Tier,
+						lockedUntil,
+						strconv.Itoa(f.Volumes),
+						"",
+					})
+				}
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
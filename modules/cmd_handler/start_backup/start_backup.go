@@ -1,6 +1,7 @@
 package start_backup
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
@@ -13,12 +14,15 @@ import (
 	"github.com/nixys/nxs-backup/modules/backup"
 	"github.com/nixys/nxs-backup/modules/logger"
 	"github.com/nixys/nxs-backup/modules/metrics"
+	"github.com/nixys/nxs-backup/modules/report"
+	"github.com/nixys/nxs-backup/modules/tracing"
 )
 
 type Opts struct {
 	InitErr     error
 	Done        chan error
 	EvCh        chan logger.LogRecord
+	ReportCh    chan *report.Report
 	WaitPrev    time.Duration
 	JobName     string
 	Jobs        map[string]interfaces.Job
@@ -26,12 +30,18 @@ type Opts struct {
 	DBJobs      interfaces.Jobs
 	ExtJobs     interfaces.Jobs
 	MetricsData *metrics.Data
+	RunID       string
+	// Tracing exports the spans of the run, nil if tracing is disabled
+	Tracing *tracing.Provider
+	// FreeSpaceCheck is the mode of the free space check before backups
+	FreeSpaceCheck string
 }
 
 type startBackup struct {
 	initErr     error
 	done        chan error
 	evCh        chan logger.LogRecord
+	reportCh    chan *report.Report
 	waitPrev    time.Duration
 	jobName     string
 	jobs        map[string]interfaces.Job
@@ -39,6 +49,10 @@ type startBackup struct {
 	dbJobs      interfaces.Jobs
 	extJobs     interfaces.Jobs
 	metricsData *metrics.Data
+	runID       string
+	tracing     *tracing.Provider
+
+	freeSpaceCheck string
 }
 
 func Init(o Opts) *startBackup {
@@ -46,6 +60,7 @@ func Init(o Opts) *startBackup {
 		initErr:     o.InitErr,
 		done:        o.Done,
 		evCh:        o.EvCh,
+		reportCh:    o.ReportCh,
 		waitPrev:    o.WaitPrev,
 		jobName:     o.JobName,
 		jobs:        o.Jobs,
@@ -53,6 +68,10 @@ func Init(o Opts) *startBackup {
 		dbJobs:      o.DBJobs,
 		extJobs:     o.ExtJobs,
 		metricsData: o.MetricsData,
+		runID:       o.RunID,
+		tracing:     o.Tracing,
+
+		freeSpaceCheck: o.FreeSpaceCheck,
 	}
 }
 
@@ -62,11 +81,26 @@ func (sb *startBackup) Run() {
 		errs *multierror.Error
 	)
 
+	startTime := time.Now()
+
+	ctx, span := tracing.Start(context.Background(), "nxs-backup start",
+		tracing.AttrRunID.String(sb.runID),
+		tracing.AttrJobName.String(sb.jobName),
+	)
+
 	defer func() {
+		tracing.End(span, errs.ErrorOrNil())
+		if tErr := sb.tracing.Shutdown(); tErr != nil {
+			sb.evCh <- logger.Log("", "").Warnf("Failed to export traces: %v", tErr)
+		}
 		if err = sb.metricsData.SaveFile(); err != nil {
 			sb.evCh <- logger.Log("", "").Errorf("Failed to save metrics to file: %v", err)
 			errs = multierror.Append(errs, err)
 		}
+		if pErr := sb.metricsData.Push(startTime); pErr != nil {
+			sb.evCh <- logger.Log("", "").Warnf("Failed to push metrics: %v", pErr)
+		}
+		sb.reportCh <- report.New(sb.metricsData, startTime)
 		if errs.ErrorOrNil() != nil {
 			err = fmt.Errorf("Some of backups failed with next errors:\n%w", errs)
 		}
@@ -105,7 +139,7 @@ func (sb *startBackup) Run() {
 		if len(sb.extJobs) > 0 {
 			sb.evCh <- logger.Log("", "").Info("Starting backup external jobs.")
 			for _, job := range sb.extJobs {
-				if err := backup.Perform(sb.evCh, job); err != nil {
+				if err := backup.Perform(ctx, sb.evCh, job, backup.Opts{Metrics: sb.metricsData, FreeSpaceCheck: sb.freeSpaceCheck}); err != nil {
 					errs = multierror.Append(errs, err)
 				}
 			}
@@ -117,7 +151,7 @@ func (sb *startBackup) Run() {
 		if len(sb.dbJobs) > 0 {
 			sb.evCh <- logger.Log("", "").Info("Starting backup databases jobs.")
 			for _, job := range sb.dbJobs {
-				if err := backup.Perform(sb.evCh, job); err != nil {
+				if err := backup.Perform(ctx, sb.evCh, job, backup.Opts{Metrics: sb.metricsData, FreeSpaceCheck: sb.freeSpaceCheck}); err != nil {
 					errs = multierror.Append(errs, err)
 				}
 			}
@@ -129,7 +163,7 @@ func (sb *startBackup) Run() {
 		if len(sb.fileJobs) > 0 {
 			sb.evCh <- logger.Log("", "").Info("Starting backup files jobs.")
 			for _, job := range sb.fileJobs {
-				if err := backup.Perform(sb.evCh, job); err != nil {
+				if err := backup.Perform(ctx, sb.evCh, job, backup.Opts{Metrics: sb.metricsData, FreeSpaceCheck: sb.freeSpaceCheck}); err != nil {
 					errs = multierror.Append(errs, err)
 				}
 			}
@@ -139,7 +173,7 @@ func (sb *startBackup) Run() {
 	}
 
 	if job, ok := sb.jobs[sb.jobName]; ok {
-		if err = backup.Perform(sb.evCh, job); err != nil {
+		if err = backup.Perform(ctx, sb.evCh, job, backup.Opts{Metrics: sb.metricsData, FreeSpaceCheck: sb.freeSpaceCheck}); err != nil {
 			errs = multierror.Append(errs, err)
 		}
 	}
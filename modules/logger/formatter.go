@@ -1,12 +1,31 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// Structured fields of the log entries. The text format omits them as they duplicate the message
+const (
+	FieldJobType  = "job_type"
+	FieldTarget   = "target"
+	FieldPhase    = "phase"
+	FieldDuration = "duration"
+	FieldBytes    = "bytes"
+)
+
+var structuredFields = map[string]bool{
+	FieldJobType:  true,
+	FieldTarget:   true,
+	FieldPhase:    true,
+	FieldDuration: true,
+	FieldBytes:    true,
+}
+
 type LogFormatter struct{}
 
 func (f *LogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
@@ -16,11 +35,12 @@ func (f *LogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	)
 
 	for k, v := range entry.Data {
-		switch k {
-		case "job":
+		switch {
+		case k == "job":
 			job = fmt.Sprintf("%s", v)
-		case "store":
+		case k == "store":
 			store = fmt.Sprintf("%s", v)
+		case structuredFields[k]:
 		default:
 			s = append(s, fmt.Sprintf("%s: %v", k, v))
 		}
@@ -42,3 +62,47 @@ func (f *LogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 
 	return []byte(out), nil
 }
+
+// JSONFormatter formats entries as JSON lines for log collectors
+type JSONFormatter struct {
+	RunID string
+}
+
+func (f *JSONFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(map[string]interface{}, len(entry.Data)+4)
+
+	for k, v := range entry.Data {
+		switch k {
+		case "job":
+			k = "job_name"
+		case "store":
+			k = "storage"
+		}
+		switch val := v.(type) {
+		case string:
+			if val == "" {
+				continue
+			}
+		case time.Duration:
+			// seconds are more convenient for aggregations
+			v = val.Seconds()
+		case error:
+			v = val.Error()
+		}
+		data[k] = v
+	}
+
+	data["time"] = entry.Time.Format(time.RFC3339Nano)
+	data["level"] = entry.Level.String()
+	data["msg"] = entry.Message
+	if f.RunID != "" {
+		data["run_id"] = f.RunID
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal log entry to JSON: %w", err)
+	}
+
+	return append(b, '\n'), nil
+}
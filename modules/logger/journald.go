@@ -0,0 +1,124 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+const journaldSocket = "/run/systemd/journal/socket"
+
+// JournaldFormatter formats entries as messages of the journald native protocol, the entry fields are sent as journal fields
+type JournaldFormatter struct {
+	Identifier string
+	RunID      string
+}
+
+type journaldWriter struct {
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+// NewJournald returns the writer and the formatter for sending logs to the local journald
+func NewJournald(runID string) (io.Writer, logrus.Formatter, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create journald socket: %w", err)
+	}
+	w := &journaldWriter{
+		conn: conn,
+		addr: &net.UnixAddr{Name: journaldSocket, Net: "unixgram"},
+	}
+	if _, err = os.Stat(journaldSocket); err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("journald is not available: %w", err)
+	}
+
+	return w, &JournaldFormatter{Identifier: "nxs-backup", RunID: runID}, nil
+}
+
+func (f *JournaldFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	var b bytes.Buffer
+
+	writeJournalField(&b, "MESSAGE", strings.TrimRight(entry.Message, "\n"))
+	writeJournalField(&b, "PRIORITY", fmt.Sprint(syslogSeverity(entry.Level)))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", f.Identifier)
+	if f.RunID != "" {
+		writeJournalField(&b, "RUN_ID", f.RunID)
+	}
+
+	for k, v := range entry.Data {
+		switch k {
+		case "job":
+			k = "job_name"
+		case "store":
+			k = "storage"
+		}
+		if s := fieldString(v); s != "" {
+			writeJournalField(&b, journalFieldName(k), s)
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// writeJournalField writes the field in the simple format or in the binary one if the value is multiline
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteString("=" + value + "\n")
+		return
+	}
+	b.WriteString("\n")
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// journalFieldName converts the name to the journal field name that consists of uppercase letters, digits and underscores
+func journalFieldName(name string) string {
+	n := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+	return strings.TrimLeft(n, "_")
+}
+
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	_, _, err := w.conn.WriteMsgUnix(p, nil, w.addr)
+	if err == nil {
+		return len(p), nil
+	}
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return 0, err
+	}
+
+	// the message is too big for a datagram, so it is passed in the file descriptor
+	f, err := os.CreateTemp("/dev/shm", "nxs-backup-journal-")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	if err = os.Remove(f.Name()); err != nil {
+		return 0, err
+	}
+	if _, err = f.Write(p); err != nil {
+		return 0, err
+	}
+	if _, _, err = w.conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), w.addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -2,14 +2,27 @@ package logger
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// Phases of the backup process
+const (
+	PhaseDump    = "dump"
+	PhaseDeliver = "deliver"
+	PhaseRotate  = "rotate"
+)
+
 type LogRecord struct {
 	Level       logrus.Level
 	JobName     string
+	JobType     string
 	StorageName string
+	Target      string
+	Phase       string
+	Duration    time.Duration
+	Bytes       int64
 	Message     string
 }
 
@@ -68,6 +81,46 @@ func Log(jobName, storageName string) LogRecord {
 	}
 }
 
+// WithTarget sets the backup target (ofs) the record relates to
+func (r LogRecord) WithTarget(ofs string) LogRecord {
+	r.Target = ofs
+	return r
+}
+
+// WithPhase sets the phase of the backup process the record relates to
+func (r LogRecord) WithPhase(phase string) LogRecord {
+	r.Phase = phase
+	return r
+}
+
+// WithDuration sets the duration of the finished operation
+func (r LogRecord) WithDuration(d time.Duration) LogRecord {
+	r.Duration = d
+	return r
+}
+
+// WithBytes sets the amount of the processed data
+func (r LogRecord) WithBytes(n int64) LogRecord {
+	r.Bytes = n
+	return r
+}
+
 func WriteLog(logger *logrus.Logger, log LogRecord) {
-	logger.WithFields(logrus.Fields{"store": log.StorageName, "job": log.JobName}).Log(log.Level, log.Message)
+	fields := logrus.Fields{"store": log.StorageName, "job": log.JobName}
+	if log.JobType != "" {
+		fields[FieldJobType] = log.JobType
+	}
+	if log.Target != "" {
+		fields[FieldTarget] = log.Target
+	}
+	if log.Phase != "" {
+		fields[FieldPhase] = log.Phase
+	}
+	if log.Duration > 0 {
+		fields[FieldDuration] = log.Duration
+	}
+	if log.Bytes > 0 {
+		fields[FieldBytes] = log.Bytes
+	}
+	logger.WithFields(fields).Log(log.Level, log.Message)
 }
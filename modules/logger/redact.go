@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "******"
+
+// Redactor masks the secret values in log messages
+type Redactor struct {
+	replacer *strings.Replacer
+}
+
+func NewRedactor(secrets []string) *Redactor {
+	// longer secrets are replaced first to mask values containing other secrets
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+
+	pairs := make([]string, 0, len(secrets)*2)
+	for _, s := range secrets {
+		if s != "" {
+			pairs = append(pairs, s, redacted)
+		}
+	}
+	return &Redactor{replacer: strings.NewReplacer(pairs...)}
+}
+
+// Redact masks the secrets in the string. Nil redactor returns the string as is
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// RedactRecord masks the secrets in the log record before it gets into notifications and reports
+func (r *Redactor) RedactRecord(rec LogRecord) LogRecord {
+	rec.Message = r.Redact(rec.Message)
+	rec.Target = r.Redact(rec.Target)
+	return rec
+}
+
+// RedactHook masks the secret values in logrus entries
+type RedactHook struct {
+	r *Redactor
+}
+
+func NewRedactHook(r *Redactor) *RedactHook {
+	return &RedactHook{r: r}
+}
+
+func (h *RedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *RedactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.r.Redact(entry.Message)
+
+	for k, v := range entry.Data {
+		var s string
+		switch val := v.(type) {
+		case string:
+			s = val
+		case error:
+			s = val.Error()
+		default:
+			continue
+		}
+		if r := h.r.Redact(s); r != s {
+			entry.Data[k] = r
+		}
+	}
+	return nil
+}
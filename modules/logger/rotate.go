@@ -0,0 +1,161 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotatedTimeFormat = "2006-01-02T15-04-05"
+
+// RotateOpts defines when the log file is rotated. Zero values disable the corresponding rotation
+type RotateOpts struct {
+	MaxSize    int64
+	Period     string
+	MaxBackups int
+}
+
+// RotatingFile is a log file that is renamed and reopened when it grows too big or a new period starts
+type RotatingFile struct {
+	path   string
+	opts   RotateOpts
+	f      *os.File
+	size   int64
+	opened time.Time
+	mu     sync.Mutex
+}
+
+func OpenRotatingFile(path string, opts RotateOpts) (*RotatingFile, error) {
+	switch opts.Period {
+	case "", "hourly", "daily", "weekly":
+	default:
+		return nil, fmt.Errorf("unknown log rotation period \"%s\", available periods: 'hourly', 'daily', 'weekly'", opts.Period)
+	}
+
+	rf := &RotatingFile{path: path, opts: opts}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.needRotate(int64(len(p))) {
+		if err := rf.rotate(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", err)
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return rf.f.Close()
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	rf.f = f
+	rf.size = fi.Size()
+	// the period of the existing file starts with its modification
+	rf.opened = fi.ModTime()
+	if fi.Size() == 0 {
+		rf.opened = time.Now()
+	}
+	return nil
+}
+
+func (rf *RotatingFile) needRotate(n int64) bool {
+	if rf.opts.MaxSize > 0 && rf.size > 0 && rf.size+n > rf.opts.MaxSize {
+		return true
+	}
+	if rf.opts.Period != "" && rf.size > 0 {
+		return !periodStart(rf.opts.Period, rf.opened).Equal(periodStart(rf.opts.Period, time.Now()))
+	}
+	return false
+}
+
+func (rf *RotatingFile) rotate() error {
+	_ = rf.f.Close()
+
+	now := time.Now()
+	rotated := rf.path + "." + now.Format(rotatedTimeFormat)
+	if _, err := os.Stat(rotated); err == nil {
+		// the file is rotated more than once a second
+		rotated = rf.path + "." + now.Format(rotatedTimeFormat+".000000000")
+	}
+	if err := os.Rename(rf.path, rotated); err != nil {
+		// continue writing to the same file
+		if oErr := rf.open(); oErr != nil {
+			return oErr
+		}
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	return rf.removeOld()
+}
+
+func (rf *RotatingFile) removeOld() error {
+	if rf.opts.MaxBackups <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+
+	var rotated []string
+	for _, m := range matches {
+		ts := strings.TrimPrefix(m, rf.path+".")
+		if _, err = time.Parse(rotatedTimeFormat, ts[:min(len(ts), len(rotatedTimeFormat))]); err == nil {
+			rotated = append(rotated, m)
+		}
+	}
+	sort.Strings(rotated)
+
+	for len(rotated) > rf.opts.MaxBackups {
+		if err = os.Remove(rotated[0]); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+func periodStart(period string, t time.Time) time.Time {
+	switch period {
+	case "hourly":
+		return t.Truncate(time.Hour)
+	case "weekly":
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		// weeks start on Monday
+		return d.AddDate(0, 0, -(int(d.Weekday())+6)%7)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
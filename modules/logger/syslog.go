@@ -0,0 +1,226 @@
+package logger
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// structured data ID of the log entry fields, 32473 is the enterprise number reserved for examples by RFC 5612
+const syslogSDID = "nxs@32473"
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogFormatter formats entries as RFC 5424 messages, the entry fields are put into the structured data
+type SyslogFormatter struct {
+	Facility int
+	Hostname string
+	AppName  string
+	RunID    string
+}
+
+type syslogWriter struct {
+	network string
+	addr    string
+	tls     *tls.Config
+	conn    net.Conn
+	retryAt time.Time
+	mu      sync.Mutex
+}
+
+// NewSyslog returns the writer and the formatter for the syslog URL.
+// Supported schemes: syslog (UDP), syslog+udp, syslog+tcp and syslog+tls.
+// Query parameters: `facility` (default daemon), `tag` (default nxs-backup) and `insecure` to skip TLS verification
+func NewSyslog(rawURL, runID string) (io.Writer, logrus.Formatter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wrong syslog URL: %w", err)
+	}
+
+	w := &syslogWriter{}
+	port := "514"
+	switch u.Scheme {
+	case "syslog", "syslog+udp":
+		w.network = "udp"
+	case "syslog+tcp":
+		w.network = "tcp"
+	case "syslog+tls":
+		w.network = "tcp"
+		port = "6514"
+		insecure, _ := strconv.ParseBool(u.Query().Get("insecure"))
+		w.tls = &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: insecure,
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown syslog URL scheme \"%s\", available schemes: 'syslog', 'syslog+udp', 'syslog+tcp', 'syslog+tls'", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("syslog host is not set")
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	w.addr = net.JoinHostPort(u.Hostname(), port)
+
+	f := &SyslogFormatter{
+		Facility: syslogFacilities["daemon"],
+		AppName:  "nxs-backup",
+		RunID:    runID,
+	}
+	if fc := u.Query().Get("facility"); fc != "" {
+		v, ok := syslogFacilities[strings.ToLower(fc)]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown syslog facility \"%s\"", fc)
+		}
+		f.Facility = v
+	}
+	if tag := u.Query().Get("tag"); tag != "" {
+		f.AppName = tag
+	}
+	if f.Hostname, err = os.Hostname(); err != nil {
+		f.Hostname = "-"
+	}
+
+	return w, f, nil
+}
+
+func (f *SyslogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	var sb strings.Builder
+
+	pri := f.Facility*8 + syslogSeverity(entry.Level)
+	_, _ = fmt.Fprintf(&sb, "<%d>1 %s %s %s %d - ",
+		pri,
+		entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		f.Hostname,
+		f.AppName,
+		os.Getpid(),
+	)
+
+	params := make(map[string]string, len(entry.Data)+1)
+	for k, v := range entry.Data {
+		switch k {
+		case "job":
+			k = "job_name"
+		case "store":
+			k = "storage"
+		}
+		s := fieldString(v)
+		if s != "" {
+			params[k] = s
+		}
+	}
+	if f.RunID != "" {
+		params["run_id"] = f.RunID
+	}
+
+	if len(params) == 0 {
+		sb.WriteString("-")
+	} else {
+		keys := make([]string, 0, len(params))
+		for k := range params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		sb.WriteString("[" + syslogSDID)
+		for _, k := range keys {
+			_, _ = fmt.Fprintf(&sb, ` %s="%s"`, k, sdEscaper.Replace(params[k]))
+		}
+		sb.WriteString("]")
+	}
+
+	sb.WriteString(" " + strings.TrimRight(entry.Message, "\n"))
+
+	return []byte(sb.String()), nil
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func syslogSeverity(l logrus.Level) int {
+	switch l {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return 2
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	default:
+		return 7
+	}
+}
+
+func fieldString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case time.Duration:
+		return strconv.FormatFloat(val.Seconds(), 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Write sends the message. The connection is established on the first write and re-established once if the sending fails,
+// so the unavailable syslog doesn't prevent backups
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	msg := p
+	if w.network == "tcp" {
+		// octet counting framing, RFC 6587
+		msg = append([]byte(strconv.Itoa(len(p))+" "), p...)
+	}
+
+	if w.conn == nil && time.Now().Before(w.retryAt) {
+		return len(p), nil
+	}
+
+	var err error
+	for i := 0; i < 2; i++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				// messages are dropped for a while instead of waiting for the connection on each of them
+				w.retryAt = time.Now().Add(10 * time.Second)
+				break
+			}
+		}
+		if _, err = w.conn.Write(msg); err == nil {
+			return len(p), nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return 0, fmt.Errorf("failed to send log to syslog: %w", err)
+}
+
+func (w *syslogWriter) connect() (err error) {
+	d := &net.Dialer{Timeout: 5 * time.Second}
+	if w.tls != nil {
+		w.conn, err = tls.DialWithDialer(d, w.network, w.addr, w.tls)
+	} else {
+		w.conn, err = d.Dial(w.network, w.addr)
+	}
+	if err != nil {
+		w.conn = nil
+		return fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return nil
+}
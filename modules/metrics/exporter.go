@@ -2,67 +2,266 @@ package metrics
 
 import (
 	"context"
+	"slices"
+	"sync"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
+// instanceLabels identify the nxs-backup instance, metrics pushed to Pushgateway get them as grouping labels
+var instanceLabels = []string{"project", "server"}
+
 type Exporter struct {
-	metrics        map[string]*prometheus.Desc
+	descs          descs
 	ctx            context.Context
 	log            *logrus.Logger
 	metricFilePath string
+	outboxCount    func() (queued, failed int)
+
+	// project and server of the storage checks, metrics of the jobs have the values saved by the backup runs
+	project  string
+	server   string
+	checksMu sync.RWMutex
+	checks   []StorageCheck
 }
 
 type ExporterOpts struct {
 	Log            *logrus.Logger
 	MetricFilePath string
+	Project        string
+	Server         string
+	// OutboxCount returns the numbers of queued and failed notifications, nil if the outbox is disabled
+	OutboxCount func() (queued, failed int)
 }
 
-func InitExporter(s ExporterOpts) *Exporter {
+type descs struct {
+	target  map[string]*prometheus.Desc
+	storage map[string]*prometheus.Desc
+	global  map[string]*prometheus.Desc
+	check   map[string]*prometheus.Desc
+}
 
-	metrics := map[string]*prometheus.Desc{
-		BackupSize: prometheus.NewDesc(
-			prometheus.BuildFQName("nxs_backup", "file", "size"),
-			"Backup file size",
-			[]string{"project", "server", "job_name", "job_type", "source", "target"}, nil,
-		),
-		BackupOk: prometheus.NewDesc(
-			prometheus.BuildFQName("nxs_backup", "collection", "success"),
-			"Backup finished successfully",
-			[]string{"project", "server", "job_name", "job_type", "source", "target"}, nil,
-		),
-		BackupTime: prometheus.NewDesc(
-			prometheus.BuildFQName("nxs_backup", "collection", "time"),
-			"Backup collection time",
-			[]string{"project", "server", "job_name", "job_type", "source", "target"}, nil,
-		),
-		BackupTimestamp: prometheus.NewDesc(
-			prometheus.BuildFQName("nxs_backup", "creation", "ts"),
-			"Backup creation timestamp",
-			[]string{"project", "server", "job_name", "job_type", "source", "target"}, nil,
-		),
-		DeliveryOk: prometheus.NewDesc(
-			prometheus.BuildFQName("nxs_backup", "delivery", "success"),
-			"Backup delivery finished successfully",
-			[]string{"project", "server", "job_name", "job_type", "source", "target"}, nil,
-		),
-		DeliveryTime: prometheus.NewDesc(
-			prometheus.BuildFQName("nxs_backup", "delivery", "time"),
-			"Backup delivering time",
-			[]string{"project", "server", "job_name", "job_type", "source", "target"}, nil,
-		),
-		UpdateAvailable: prometheus.NewDesc(
-			prometheus.BuildFQName("nxs_backup", "update", "available"),
-			"A new version of nxs-backup is available",
-			[]string{"project", "server"}, nil,
-		),
+func newDescs(instLabels []string) descs {
+	targetLabels := append(slices.Clone(instLabels), "job_name", "job_type", "source", "target")
+	storageLabels := append(slices.Clone(targetLabels), "storage")
+	checkLabels := append(slices.Clone(instLabels), "storage", "job_name", "backup_path")
+
+	return descs{
+		target: map[string]*prometheus.Desc{
+			BackupSize: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "file", "size"),
+				"Backup file size",
+				targetLabels, nil,
+			),
+			BackupOk: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "collection", "success"),
+				"Backup finished successfully",
+				targetLabels, nil,
+			),
+			BackupTime: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "collection", "time"),
+				"Backup collection time",
+				targetLabels, nil,
+			),
+			BackupTimestamp: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "creation", "ts"),
+				"Backup creation timestamp",
+				targetLabels, nil,
+			),
+			DeliveryOk: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "delivery", "success"),
+				"Backup delivery finished successfully",
+				targetLabels, nil,
+			),
+			DeliveryTime: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "delivery", "time"),
+				"Backup delivering time",
+				targetLabels, nil,
+			),
+			LastSuccess: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "", "last_success_timestamp"),
+				"Timestamp of the last backup delivered to all storages",
+				targetLabels, nil,
+			),
+		},
+		storage: map[string]*prometheus.Desc{
+			DeliveryOk: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage", "delivery_success"),
+				"Backup delivery to the storage finished successfully",
+				storageLabels, nil,
+			),
+			DeliveryTime: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage", "delivery_time"),
+				"Backup delivering time to the storage",
+				storageLabels, nil,
+			),
+			DeliveryBytes: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage", "delivery_bytes"),
+				"Size of the backup delivered to the storage",
+				storageLabels, nil,
+			),
+			LastSuccess: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage", "last_success_timestamp"),
+				"Timestamp of the last backup successfully delivered to the storage",
+				storageLabels, nil,
+			),
+			RotatedTotal: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage", "rotated_total"),
+				"Outdated backups found by the rotation",
+				storageLabels, nil,
+			),
+			DeletedTotal: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage", "deleted_total"),
+				"Outdated backups deleted by the rotation",
+				storageLabels, nil,
+			),
+			StorageBackups: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage", "backups"),
+				"Number of backup files on the storage",
+				storageLabels, nil,
+			),
+			StorageUsage: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage", "usage_bytes"),
+				"Total size of backup files on the storage",
+				storageLabels, nil,
+			),
+		},
+		global: map[string]*prometheus.Desc{
+			UpdateAvailable: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "update", "available"),
+				"A new version of nxs-backup is available",
+				instLabels, nil,
+			),
+			NotificationsQueued: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "notifications", "queued"),
+				"Notifications waiting in the outbox to be resent",
+				instLabels, nil,
+			),
+			NotificationsFailed: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "notifications", "failed"),
+				"Notifications that can't be delivered",
+				instLabels, nil,
+			),
+		},
+		check: map[string]*prometheus.Desc{
+			CheckOk: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage_check", "success"),
+				"Storage check passed",
+				checkLabels, nil,
+			),
+			CheckTimestamp: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage_check", "ts"),
+				"Storage check timestamp",
+				checkLabels, nil,
+			),
+			CheckConnectTime: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage_check", "connect_seconds"),
+				"Time of connecting to the storage",
+				checkLabels, nil,
+			),
+			CheckLatency: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage_check", "latency_seconds"),
+				"Time of the metadata request to the storage",
+				checkLabels, nil,
+			),
+			CheckWriteSpeed: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage_check", "write_bytes_per_second"),
+				"Write throughput of the storage",
+				checkLabels, nil,
+			),
+			CheckReadSpeed: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage_check", "read_bytes_per_second"),
+				"Read throughput of the storage",
+				checkLabels, nil,
+			),
+			CheckFreeSpace: prometheus.NewDesc(
+				prometheus.BuildFQName("nxs_backup", "storage", "free_bytes"),
+				"Free space on the storage",
+				checkLabels, nil,
+			),
+		},
 	}
+}
 
+func (ds descs) describe(ch chan<- *prometheus.Desc) {
+	for _, m := range []map[string]*prometheus.Desc{ds.target, ds.storage, ds.global, ds.check} {
+		for _, d := range m {
+			ch <- d
+		}
+	}
+}
+
+// collectJob sends metrics of the job targets, instValues are values of the instance labels
+func (ds descs) collectJob(ch chan<- prometheus.Metric, instValues []string, j JobData) error {
+	var errs *multierror.Error
+
+	for _, t := range j.TargetMetrics {
+		labels := append(slices.Clone(instValues), j.JobName, string(j.JobType), t.Source, t.Target)
+
+		for k, v := range t.Values {
+			desc, ok := ds.target[k]
+			if !ok {
+				continue
+			}
+			d, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, v, labels...)
+			if err != nil {
+				errs = multierror.Append(errs, err)
+				continue
+			}
+			ch <- d
+		}
+		for stName, st := range t.Storages {
+			for k, v := range st.Values {
+				desc, ok := ds.storage[k]
+				if !ok {
+					continue
+				}
+				vt := prometheus.GaugeValue
+				if k == RotatedTotal || k == DeletedTotal {
+					vt = prometheus.CounterValue
+				}
+				d, err := prometheus.NewConstMetric(desc, vt, v, append(slices.Clone(labels), stName)...)
+				if err != nil {
+					errs = multierror.Append(errs, err)
+					continue
+				}
+				ch <- d
+			}
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// collectCheck sends metrics of the storage check, instValues are values of the instance labels
+func (ds descs) collectCheck(ch chan<- prometheus.Metric, instValues []string, c StorageCheck) error {
+	var errs *multierror.Error
+
+	labels := append(slices.Clone(instValues), c.Storage, c.Job, c.Path)
+	for k, v := range c.Values {
+		desc, ok := ds.check[k]
+		if !ok {
+			continue
+		}
+		d, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, v, labels...)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		ch <- d
+	}
+	return errs.ErrorOrNil()
+}
+
+func InitExporter(s ExporterOpts) *Exporter {
 	return &Exporter{
-		metrics:        metrics,
+		descs:          newDescs(instanceLabels),
 		log:            s.Log,
 		metricFilePath: s.MetricFilePath,
+		outboxCount:    s.OutboxCount,
+		project:        s.Project,
+		server:         s.Server,
 	}
 }
 
@@ -70,48 +269,35 @@ func (e *Exporter) ContextSet(c context.Context) {
 	e.ctx = c
 }
 
+// SetStorageChecks replaces the exported results of the storage checks
+func (e *Exporter) SetStorageChecks(checks []StorageCheck) {
+	e.checksMu.Lock()
+	defer e.checksMu.Unlock()
+	e.checks = checks
+}
+
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	for _, m := range e.metrics {
-		ch <- m
-	}
+	e.descs.describe(ch)
 }
 
 // Collect function, called on by Prometheus Client library
 // This function is called when a scrape is performed on the /metrics page
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 
-	data, err := readFile(e.metricFilePath)
+	data, err := ReadFile(e.metricFilePath)
 	if err != nil {
 		e.log.Warnf("Failed to read metric file: %v", err)
 		return
 	}
 
 	for _, j := range data.Job {
-		for _, t := range j.TargetMetrics {
-			for k, v := range t.Values {
-				d, err := prometheus.NewConstMetric(
-					e.metrics[k],
-					prometheus.GaugeValue,
-					v,
-					data.Project,
-					data.Server,
-					j.JobName,
-					string(j.JobType),
-					t.Source,
-					t.Target,
-				)
-				if err != nil {
-					e.log.Warnf("Failed to export prometheus metric: %v", err)
-					continue
-				}
-				ch <- d
-			}
+		if err = e.descs.collectJob(ch, []string{data.Project, data.Server}, j); err != nil {
+			e.log.Warnf("Failed to export prometheus metric: %v", err)
 		}
-
 	}
 
 	d, err := prometheus.NewConstMetric(
-		e.metrics[UpdateAvailable],
+		e.descs.global[UpdateAvailable],
 		prometheus.GaugeValue,
 		data.NewVersionAvailable,
 		data.Project,
@@ -122,4 +308,34 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 		return
 	}
 	ch <- d
+
+	e.checksMu.RLock()
+	for _, c := range e.checks {
+		if err = e.descs.collectCheck(ch, []string{e.project, e.server}, c); err != nil {
+			e.log.Warnf("Failed to export prometheus metric: %v", err)
+		}
+	}
+	e.checksMu.RUnlock()
+
+	if e.outboxCount == nil {
+		return
+	}
+	queued, failed := e.outboxCount()
+	for k, n := range map[string]int{
+		NotificationsQueued: queued,
+		NotificationsFailed: failed,
+	} {
+		d, err = prometheus.NewConstMetric(
+			e.descs.global[k],
+			prometheus.GaugeValue,
+			float64(n),
+			data.Project,
+			data.Server,
+		)
+		if err != nil {
+			e.log.Warnf("Failed to export prometheus metric: %v", err)
+			continue
+		}
+		ch <- d
+	}
 }
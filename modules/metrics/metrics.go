@@ -20,7 +20,25 @@ const (
 	BackupSize      = "size"
 	DeliveryOk      = "delivery_ok"
 	DeliveryTime    = "delivery_time"
+	DeliveryBytes   = "delivery_bytes"
+	RotatedCount    = "rotated_count"
+	LastSuccess     = "last_success_timestamp"
+	RotatedTotal    = "rotated_total"
+	DeletedTotal    = "deleted_total"
+	StorageBackups  = "storage_backups"
+	StorageUsage    = "storage_usage"
 	UpdateAvailable = "update_available"
+
+	NotificationsQueued = "notifications_queued"
+	NotificationsFailed = "notifications_failed"
+
+	CheckOk          = "check_ok"
+	CheckTimestamp   = "check_timestamp"
+	CheckConnectTime = "check_connect_time"
+	CheckLatency     = "check_latency"
+	CheckWriteSpeed  = "check_write_speed"
+	CheckReadSpeed   = "check_read_speed"
+	CheckFreeSpace   = "check_free_space"
 )
 
 type Data struct {
@@ -32,6 +50,7 @@ type Data struct {
 	Job map[string]JobData
 
 	metricsFile string
+	push        *PushOpts
 }
 
 type JobData struct {
@@ -41,17 +60,32 @@ type JobData struct {
 }
 
 type TargetData struct {
-	Source string
-	Target string
+	Source   string
+	Target   string
+	Values   map[string]float64
+	Storages map[string]StorageData
+}
+
+type StorageData struct {
 	Values map[string]float64
 }
 
+// StorageCheck is the result of the storage check under the backup path of the job
+type StorageCheck struct {
+	Storage string
+	Job     string
+	Path    string
+	Values  map[string]float64
+}
+
 type DataOpts struct {
 	Project             string
 	Server              string
 	MetricsFile         string
 	NewVersionAvailable float64
 	Enabled             bool
+	// Push is nil if metrics aren't pushed
+	Push *PushOpts
 }
 
 // InitData initializes the metrics data by
@@ -64,6 +98,7 @@ func InitData(opts DataOpts) *Data {
 		Enabled:             opts.Enabled,
 		Job:                 make(map[string]JobData),
 		metricsFile:         opts.MetricsFile,
+		push:                opts.Push,
 	}
 }
 
@@ -76,13 +111,52 @@ func (md *Data) RegisterJob(jd JobData) *Data {
 	return md
 }
 
+// SetStorageValues sets metrics of the target on the specific storage
+func (md *Data) SetStorageValues(jobName, ofs, storageName string, values map[string]float64) {
+	td, ok := md.Job[jobName].TargetMetrics[ofs]
+	if !ok {
+		return
+	}
+	if td.Storages == nil {
+		td.Storages = make(map[string]StorageData)
+	}
+	sd, ok := td.Storages[storageName]
+	if !ok {
+		sd = StorageData{Values: make(map[string]float64)}
+	}
+	for m, v := range values {
+		sd.Values[m] = v
+	}
+	td.Storages[storageName] = sd
+	md.Job[jobName].TargetMetrics[ofs] = td
+}
+
+// LastBackupSize returns the total size of the job backups made by the previous run, 0 if it's unknown
+func (md *Data) LastBackupSize(jobName string) int64 {
+	// the file is updated only if metrics are enabled
+	if !md.Enabled {
+		return 0
+	}
+
+	od, err := ReadFile(md.metricsFile)
+	if err != nil {
+		return 0
+	}
+
+	var size float64
+	for _, td := range od.Job[jobName].TargetMetrics {
+		size += td.Values[BackupSize]
+	}
+	return int64(size)
+}
+
 func (md *Data) SaveFile() error {
 	//skip if metrics disabled
 	if !md.Enabled {
 		return nil
 	}
 
-	od, err := readFile(md.metricsFile)
+	od, err := ReadFile(md.metricsFile)
 	if err != nil {
 		return err
 	}
@@ -91,6 +165,8 @@ func (md *Data) SaveFile() error {
 	for jobName, job := range od.Job {
 		if _, ok := md.Job[jobName]; !ok {
 			md.Job[jobName] = job
+		} else {
+			md.mergeJob(job)
 		}
 	}
 
@@ -104,7 +180,57 @@ func (md *Data) SaveFile() error {
 	return enc.Encode(md)
 }
 
-func readFile(path string) (*Data, error) {
+// mergeJob keeps the last success timestamps of the previous runs and accumulates the counters
+func (md *Data) mergeJob(old JobData) {
+	for ofs, otd := range old.TargetMetrics {
+		td, ok := md.Job[old.JobName].TargetMetrics[ofs]
+		if !ok {
+			continue
+		}
+		mergeValues(td.Values, otd.Values)
+
+		for stName, osd := range otd.Storages {
+			if td.Storages == nil {
+				td.Storages = make(map[string]StorageData)
+			}
+			sd, ok := td.Storages[stName]
+			if !ok {
+				sd = StorageData{Values: make(map[string]float64)}
+			}
+			mergeValues(sd.Values, osd.Values)
+			td.Storages[stName] = sd
+		}
+		md.Job[old.JobName].TargetMetrics[ofs] = td
+	}
+}
+
+func mergeValues(values, old map[string]float64) {
+	if values == nil {
+		return
+	}
+	if v, ok := old[LastSuccess]; ok {
+		if _, set := values[LastSuccess]; !set {
+			values[LastSuccess] = v
+		}
+	}
+	for _, c := range []string{RotatedTotal, DeletedTotal} {
+		if v, ok := old[c]; ok {
+			values[c] += v
+		}
+	}
+	// usage isn't collected if the job failed before the listing of backups, the backup size isn't set
+	// if the job was aborted before the dump and is kept to estimate the size of the next backup
+	for _, u := range []string{StorageBackups, StorageUsage, BackupSize} {
+		if v, ok := old[u]; ok {
+			if _, set := values[u]; !set {
+				values[u] = v
+			}
+		}
+	}
+}
+
+// ReadFile reads the metrics saved by backup runs
+func ReadFile(path string) (*Data, error) {
 	var (
 		f   *os.File
 		d   Data
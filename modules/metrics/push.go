@@ -0,0 +1,349 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/nixys/nxs-backup/misc"
+)
+
+const (
+	PushGateway = "pushgateway"
+	RemoteWrite = "remote_write"
+	OTLP        = "otlp"
+)
+
+// PushOpts defines where the metrics of the backup run are pushed to
+type PushOpts struct {
+	Type string
+	URL  string
+	// Protocol is the OTLP protocol: grpc or http
+	Protocol    string
+	Username    string
+	Password    string
+	Headers     map[string]string
+	InsecureTLS bool
+	Timeout     time.Duration
+}
+
+func (o PushOpts) Validate() error {
+	switch o.Type {
+	case PushGateway, RemoteWrite:
+	case OTLP:
+		if o.Protocol != "grpc" && o.Protocol != "http" {
+			return fmt.Errorf("unknown OTLP protocol \"%s\", available protocols: 'grpc', 'http'", o.Protocol)
+		}
+	default:
+		return fmt.Errorf("unknown metrics push type \"%s\", available types: '%s', '%s', '%s'", o.Type, PushGateway, RemoteWrite, OTLP)
+	}
+	if _, err := url.ParseRequestURI(o.URL); err != nil {
+		return fmt.Errorf("wrong metrics push URL: %w", err)
+	}
+	return nil
+}
+
+// jobsCollector collects metrics of the given jobs
+type jobsCollector struct {
+	descs      descs
+	instValues []string
+	jobs       []JobData
+}
+
+func (c *jobsCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.descs.describe(ch)
+}
+
+func (c *jobsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, j := range c.jobs {
+		_ = c.descs.collectJob(ch, c.instValues, j)
+	}
+}
+
+// Push sends metrics of the jobs run since the start time
+func (md *Data) Push(started time.Time) error {
+	if !md.Enabled || md.push == nil {
+		return nil
+	}
+
+	var jobs []JobData
+	for _, jd := range md.Job {
+		for _, td := range jd.TargetMetrics {
+			if ts, ok := td.Values[BackupTimestamp]; ok && int64(ts) >= started.Unix() {
+				jobs = append(jobs, jd)
+				break
+			}
+		}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), md.push.Timeout)
+	defer cancel()
+
+	switch md.push.Type {
+	case PushGateway:
+		return md.pushGateway(ctx, jobs)
+	case RemoteWrite:
+		return md.remoteWrite(ctx, jobs)
+	default:
+		return md.pushOTLP(ctx, jobs)
+	}
+}
+
+func (md *Data) httpClient() *http.Client {
+	return &http.Client{
+		Timeout: md.push.Timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: md.push.InsecureTLS},
+		},
+	}
+}
+
+// pushGateway replaces metrics of each job in the group identified by the project, server and job
+func (md *Data) pushGateway(ctx context.Context, jobs []JobData) error {
+	var errs *multierror.Error
+
+	header := make(http.Header)
+	for k, v := range md.push.Headers {
+		header.Set(k, v)
+	}
+
+	for _, jd := range jobs {
+		p := push.New(md.push.URL, jd.JobName).
+			Grouping("project", md.Project).
+			Grouping("server", md.Server).
+			Collector(&jobsCollector{descs: newDescs(nil), jobs: []JobData{jd}}).
+			Client(md.httpClient()).
+			Header(header)
+		if md.push.Username != "" {
+			p = p.BasicAuth(md.push.Username, md.push.Password)
+		}
+		if err := p.PushContext(ctx); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to push metrics of job `%s`: %w", jd.JobName, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (md *Data) gather(jobs []JobData) ([]*dto.MetricFamily, error) {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(&jobsCollector{
+		descs:      newDescs(instanceLabels),
+		instValues: []string{md.Project, md.Server},
+		jobs:       jobs,
+	}); err != nil {
+		return nil, err
+	}
+	return reg.Gather()
+}
+
+func metricValue(m *dto.Metric) float64 {
+	if m.GetCounter() != nil {
+		return m.GetCounter().GetValue()
+	}
+	return m.GetGauge().GetValue()
+}
+
+// remoteWrite sends metrics with the Prometheus remote write protocol v1
+func (md *Data) remoteWrite(ctx context.Context, jobs []JobData) error {
+	mfs, err := md.gather(jobs)
+	if err != nil {
+		return err
+	}
+
+	ts := time.Now().UnixMilli()
+	var wr []byte
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{"__name__": mf.GetName()}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			wr = appendTimeSeries(wr, labels, metricValue(m), ts)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.push.URL, bytes.NewReader(snappy.Encode(nil, wr)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "nxs-backup/"+misc.VERSION)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range md.push.Headers {
+		req.Header.Set(k, v)
+	}
+	if md.push.Username != "" {
+		req.SetBasicAuth(md.push.Username, md.push.Password)
+	}
+
+	resp, err := md.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send metrics: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to send metrics: unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// appendTimeSeries appends the TimeSeries message with one sample to the encoded WriteRequest
+func appendTimeSeries(b []byte, labels map[string]string, v float64, ts int64) []byte {
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	// labels must be sorted by name
+	sort.Strings(names)
+
+	var series []byte
+	for _, n := range names {
+		var l []byte
+		l = protowire.AppendTag(l, 1, protowire.BytesType)
+		l = protowire.AppendString(l, n)
+		l = protowire.AppendTag(l, 2, protowire.BytesType)
+		l = protowire.AppendString(l, labels[n])
+
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, l)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(v))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(ts))
+
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, series)
+}
+
+// pushOTLP exports metrics once to the OTLP collector, counters are exported as cumulative sums
+func (md *Data) pushOTLP(ctx context.Context, jobs []JobData) error {
+	mfs, err := md.gather(jobs)
+	if err != nil {
+		return err
+	}
+
+	headers := make(map[string]string, len(md.push.Headers)+1)
+	for k, v := range md.push.Headers {
+		headers[k] = v
+	}
+	if md.push.Username != "" {
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(md.push.Username+":"+md.push.Password))
+	}
+
+	var exporter sdkmetric.Exporter
+	if md.push.Protocol == "grpc" {
+		opts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpointURL(md.push.URL),
+			otlpmetricgrpc.WithHeaders(headers),
+			otlpmetricgrpc.WithTimeout(md.push.Timeout),
+		}
+		if md.push.InsecureTLS {
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})))
+		}
+		exporter, err = otlpmetricgrpc.New(ctx, opts...)
+	} else {
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpointURL(md.push.URL),
+			otlpmetrichttp.WithHeaders(headers),
+			otlpmetrichttp.WithTimeout(md.push.Timeout),
+		}
+		if md.push.InsecureTLS {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(&tls.Config{InsecureSkipVerify: true}))
+		}
+		exporter, err = otlpmetrichttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP metrics exporter: %w", err)
+	}
+	defer func() { _ = exporter.Shutdown(context.Background()) }()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName("nxs-backup"),
+			semconv.ServiceVersion(misc.VERSION),
+			semconv.ServiceNamespace(md.Project),
+			semconv.HostName(md.Server),
+		)),
+	)
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+
+	meter := provider.Meter("github.com/nixys/nxs-backup")
+	for _, mf := range mfs {
+		observe := func(o metric.Float64Observer) {
+			for _, m := range mf.GetMetric() {
+				attrs := make([]attribute.KeyValue, 0, len(m.GetLabel()))
+				for _, l := range m.GetLabel() {
+					attrs = append(attrs, attribute.String(l.GetName(), l.GetValue()))
+				}
+				o.Observe(metricValue(m), metric.WithAttributes(attrs...))
+			}
+		}
+		if mf.GetType() == dto.MetricType_COUNTER {
+			_, err = meter.Float64ObservableCounter(mf.GetName(), metric.WithDescription(mf.GetHelp()),
+				metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+					observe(o)
+					return nil
+				}),
+			)
+		} else {
+			_, err = meter.Float64ObservableGauge(mf.GetName(), metric.WithDescription(mf.GetHelp()),
+				metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+					observe(o)
+					return nil
+				}),
+			)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err = reader.Collect(ctx, &rm); err != nil {
+		return err
+	}
+	if err = exporter.Export(ctx, &rm); err != nil {
+		return fmt.Errorf("failed to send metrics: %w", err)
+	}
+	return nil
+}
@@ -3,35 +3,57 @@ package mailer
 import (
 	"bytes"
 	"fmt"
+	htmltemplate "html/template"
 	"io"
 	"os/exec"
+	"strings"
+	texttemplate "text/template"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/gomail.v2"
 
 	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/notifier/outbox"
+	"github.com/nixys/nxs-backup/modules/notifier/templates"
+	"github.com/nixys/nxs-backup/modules/report"
 )
 
 type Opts struct {
-	From         string
-	SmtpServer   string
-	SmtpPort     int
-	SmtpUser     string
-	SmtpPassword string
-	SmtpTimeout  string
-	Recipients   []string
-	MessageLevel logrus.Level
-	ProjectName  string
-	ServerName   string
+	From            string
+	SmtpServer      string
+	SmtpPort        int
+	SmtpUser        string
+	SmtpPassword    string
+	SmtpTimeout     string
+	Recipients      []string
+	MessageLevel    logrus.Level
+	Mode            report.Mode
+	SubjectTemplate string
+	BodyTemplate    string
+	ProjectName     string
+	ServerName      string
 }
 
 type mailer struct {
-	opts Opts
+	opts           Opts
+	eventSubject   *texttemplate.Template
+	eventBody      *htmltemplate.Template
+	summarySubject *texttemplate.Template
+	summaryBody    *htmltemplate.Template
 }
 
 func Init(mailCfg Opts) (*mailer, error) {
+	var err error
+
 	m := &mailer{opts: mailCfg}
 
+	if m.eventSubject, m.summarySubject, err = parseSubjects(mailCfg.SubjectTemplate); err != nil {
+		return m, fmt.Errorf("Failed to parse email subject template. Error: %v ", err)
+	}
+	if m.eventBody, m.summaryBody, err = parseBodies(mailCfg.BodyTemplate); err != nil {
+		return m, fmt.Errorf("Failed to parse email body template. Error: %v ", err)
+	}
+
 	if mailCfg.SmtpServer != "" {
 		d := gomail.NewDialer(mailCfg.SmtpServer, mailCfg.SmtpPort, mailCfg.SmtpUser, mailCfg.SmtpPassword)
 		sc, err := d.Dial()
@@ -44,74 +66,72 @@ func Init(mailCfg Opts) (*mailer, error) {
 	return m, nil
 }
 
+func (m *mailer) GetName() string {
+	return outbox.NotifierName("mail", append([]string{m.opts.SmtpServer, string(m.opts.Mode)}, m.opts.Recipients...)...)
+}
+
 // Send sends notification via Email
-func (m *mailer) Send(log *logrus.Logger, n logger.LogRecord) {
-	if n.Level > m.opts.MessageLevel {
-		return
+func (m *mailer) Send(_ *logrus.Logger, n logger.LogRecord) error {
+	if !m.opts.Mode.PerEvent() || n.Level > m.opts.MessageLevel {
+		return nil
+	}
+
+	return m.render(m.eventSubject, m.eventBody, templates.EventData(n, m.opts.ProjectName, m.opts.ServerName))
+}
+
+// SendReport sends summary of the backup run via Email
+func (m *mailer) SendReport(_ *logrus.Logger, rep *report.Report) error {
+	if !m.opts.Mode.Summary() || rep.Level > m.opts.MessageLevel {
+		return nil
 	}
 
+	data := templates.ReportData(rep)
+	data.Project = m.opts.ProjectName
+	data.Server = m.opts.ServerName
+
+	return m.render(m.summarySubject, m.summaryBody, data)
+}
+
+func (m *mailer) render(subjTmpl *texttemplate.Template, bodyTmpl *htmltemplate.Template, data templates.Data) error {
+	var subj, body bytes.Buffer
+
+	if err := subjTmpl.Execute(&subj, data); err != nil {
+		return outbox.Permanent(fmt.Errorf("failed to render email subject: %v", err))
+	}
+	if err := bodyTmpl.Execute(&body, data); err != nil {
+		return outbox.Permanent(fmt.Errorf("failed to render email body: %v", err))
+	}
+
+	return m.send(strings.TrimSpace(subj.String()), body.String())
+}
+
+func (m *mailer) send(subject, body string) error {
 	var (
 		sc  gomail.SendCloser
 		err error
 	)
-	defer func() { _ = sc.Close() }()
 
 	msg := gomail.NewMessage()
 	msg.SetHeader("From", m.opts.From)
 	msg.SetHeader("To", m.opts.Recipients...)
-
-	subjStr := fmt.Sprintf("[%s] Nxs-backup notification: server %q", n.Level, m.opts.ServerName)
-	if m.opts.ProjectName != "" {
-		subjStr += fmt.Sprintf(" of project %q", m.opts.ProjectName)
-	}
-	msg.SetHeader("Subject", subjStr)
-
-	msg.SetBody("text/html", m.getMailBody(n))
+	msg.SetHeader("Subject", subject)
+	msg.SetBody("text/html", body)
 
 	if m.opts.SmtpServer != "" {
 		d := gomail.NewDialer(m.opts.SmtpServer, m.opts.SmtpPort, m.opts.SmtpUser, m.opts.SmtpPassword)
 		sc, err = d.Dial()
 		if err != nil {
-			log.Errorf("Failed to dial SMTP server. Error: %v", err)
-			return
+			return fmt.Errorf("failed to dial SMTP server: %v", err)
 		}
 	} else {
 		sc = localMail{}
 	}
+	defer func() { _ = sc.Close() }()
 
 	if err = gomail.Send(sc, msg); err != nil {
-		log.Errorf("Could not send email: %v", err)
-	}
-}
-
-func (m *mailer) getMailBody(n logger.LogRecord) (b string) {
-	switch n.Level {
-	case logrus.DebugLevel:
-		b += "[DEBUG]:\n\n"
-	case logrus.InfoLevel:
-		b += "[INFO]:\n\n"
-	case logrus.WarnLevel:
-		b += "[WARNING]:\n\n"
-	case logrus.ErrorLevel:
-		b += "[ERROR]:\n\n"
+		return fmt.Errorf("could not send email: %v", err)
 	}
-
-	if m.opts.ProjectName != "" {
-		b += fmt.Sprintf("project: %s\n", m.opts.ProjectName)
-	}
-	if m.opts.ServerName != "" {
-		b += fmt.Sprintf("Server: %s\n\n", m.opts.ServerName)
-	}
-
-	if n.JobName != "" {
-		b += fmt.Sprintf("Job: %s\n", n.JobName)
-	}
-	if n.StorageName != "" {
-		b += fmt.Sprintf("Storage: %s\n", n.StorageName)
-	}
-	b += fmt.Sprintf("Message: %s\n", n.Message)
-
-	return
+	return nil
 }
 
 type localMail struct {
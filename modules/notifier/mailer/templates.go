@@ -0,0 +1,112 @@
+package mailer
+
+import (
+	htmltemplate "html/template"
+	texttemplate "text/template"
+
+	"github.com/nixys/nxs-backup/modules/notifier/templates"
+)
+
+const (
+	defaultEventSubject = `[{{ .Level }}] Nxs-backup notification: server {{ printf "%q" .Server }}{{ if .Project }} of project {{ printf "%q" .Project }}{{ end }}`
+
+	defaultSummarySubject = `[{{ .Report.Status }}] Nxs-backup summary: server {{ printf "%q" .Server }}{{ if .Project }} of project {{ printf "%q" .Project }}{{ end }}`
+
+	defaultEventBody = `[{{ upper .Level }}]:
+
+{{ if .Project }}project: {{ .Project }}
+{{ end }}{{ if .Server }}Server: {{ .Server }}
+
+{{ end }}{{ if .Job }}Job: {{ .Job }}
+{{ end }}{{ if .Storage }}Storage: {{ .Storage }}
+{{ end }}{{ if .Target }}Target: {{ .Target }}
+{{ end }}Message: {{ .Message }}
+`
+
+	defaultSummaryBody = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; font-size: 14px;">
+{{- with .Report }}
+<h2>Backup run <span style="color: {{ statusColor .Status }};">{{ .Status }}</span></h2>
+{{- end }}
+<p>
+{{- if .Project }}Project: <b>{{ .Project }}</b><br>{{ end }}
+{{- if .Server }}Server: <b>{{ .Server }}</b><br>{{ end }}
+{{- with .Report }}
+Started: {{ .Started.Format "2006-01-02 15:04:05" }}<br>
+Duration: {{ .Duration }}
+</p>
+{{- range .Jobs }}
+<h3>{{ .Name }}{{ if .Type }} ({{ .Type }}){{ end }} &mdash; <span style="color: {{ statusColor .Status }};">{{ .Status }}</span></h3>
+{{- if .Targets }}
+<table cellpadding="4" cellspacing="0" border="1" style="border-collapse: collapse;">
+<tr><th>Target</th><th>Status</th><th>Size</th><th>Backup time</th><th>Storage</th><th>Delivery</th><th>Delivery time</th><th>Rotated</th></tr>
+{{- range .Targets }}
+{{- $t := . }}
+{{- range $i, $s := .Storages }}
+<tr>
+{{- if eq $i 0 }}
+<td rowspan="{{ len $t.Storages }}">{{ $t.Name }}</td>
+<td rowspan="{{ len $t.Storages }}" style="color: {{ statusColor $t.Status }};">{{ $t.Status }}</td>
+<td rowspan="{{ len $t.Storages }}">{{ humanSize $t.Size }}</td>
+<td rowspan="{{ len $t.Storages }}">{{ $t.BackupTime }}</td>
+{{- end }}
+<td>{{ $s.Name }}</td>
+<td style="color: {{ statusColor $s.Delivery }};">{{ $s.Delivery }}</td>
+<td>{{ $s.DeliveryTime }}</td>
+<td>{{ $s.Rotated }}</td>
+</tr>
+{{- else }}
+<tr><td>{{ $t.Name }}</td><td style="color: {{ statusColor $t.Status }};">{{ $t.Status }}</td><td>{{ humanSize $t.Size }}</td><td>{{ $t.BackupTime }}</td><td colspan="4"></td></tr>
+{{- end }}
+{{- end }}
+</table>
+{{- end }}
+{{- if .Errors }}
+<p><b>Errors:</b></p>
+<ul>{{ range .Errors }}<li>{{ . }}</li>{{ end }}</ul>
+{{- end }}
+{{- if .Warnings }}
+<p><b>Warnings:</b></p>
+<ul>{{ range .Warnings }}<li>{{ . }}</li>{{ end }}</ul>
+{{- end }}
+{{- end }}
+{{- if .Errors }}
+<h3>Errors</h3>
+<ul>{{ range .Errors }}<li>{{ . }}</li>{{ end }}</ul>
+{{- end }}
+{{- if .Warnings }}
+<h3>Warnings</h3>
+<ul>{{ range .Warnings }}<li>{{ . }}</li>{{ end }}</ul>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`
+)
+
+// parseSubjects returns event and summary subject templates. A custom template is used for both of them
+func parseSubjects(custom string) (event, summary *texttemplate.Template, err error) {
+	if custom != "" {
+		event, err = templates.NewText("subject", custom)
+		return event, event, err
+	}
+	if event, err = templates.NewText("subject", defaultEventSubject); err != nil {
+		return
+	}
+	summary, err = templates.NewText("summary_subject", defaultSummarySubject)
+	return
+}
+
+// parseBodies returns event and summary body templates. A custom template is used for both of them
+func parseBodies(custom string) (event, summary *htmltemplate.Template, err error) {
+	if custom != "" {
+		event, err = templates.NewHTML("body", custom)
+		return event, event, err
+	}
+	if event, err = templates.NewHTML("body", defaultEventBody); err != nil {
+		return
+	}
+	summary, err = templates.NewHTML("summary_body", defaultSummaryBody)
+	return
+}
@@ -0,0 +1,139 @@
+package mattermost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/notifier/outbox"
+	"github.com/nixys/nxs-backup/modules/notifier/templates"
+	"github.com/nixys/nxs-backup/modules/notifier/transport"
+	"github.com/nixys/nxs-backup/modules/report"
+)
+
+// Mattermost post is limited by 16383 characters, escaping may make the text longer
+const messageLimit = 8000
+
+// Opts contains Mattermost incoming webhook options
+type Opts struct {
+	WebhookURL      string
+	Channel         string
+	Username        string
+	IconURL         string
+	InsecureTLS     bool
+	MessageLevel    logrus.Level
+	Mode            report.Mode
+	MessageTemplate string
+	ProjectName     string
+	ServerName      string
+}
+
+type mattermost struct {
+	opts           Opts
+	client         *transport.Client
+	eventMessage   *template.Template
+	summaryMessage *template.Template
+}
+
+type message struct {
+	Channel     string       `json:"channel,omitempty"`
+	Username    string       `json:"username,omitempty"`
+	IconURL     string       `json:"icon_url,omitempty"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type attachment struct {
+	Fallback string `json:"fallback"`
+	Color    string `json:"color"`
+	Text     string `json:"text"`
+	Footer   string `json:"footer,omitempty"`
+}
+
+func Init(opts Opts) (*mattermost, error) {
+	var err error
+
+	m := &mattermost{
+		opts:   opts,
+		client: transport.New(opts.InsecureTLS),
+	}
+
+	if _, err = url.ParseRequestURI(opts.WebhookURL); err != nil {
+		return m, fmt.Errorf("Mattermost init fail. Wrong webhook URL. Error: %v ", err)
+	}
+
+	if m.eventMessage, m.summaryMessage, err = templates.ParseMessages(opts.MessageTemplate); err != nil {
+		return m, fmt.Errorf("Failed to parse Mattermost message template. Error: %v ", err)
+	}
+
+	return m, nil
+}
+
+func (m *mattermost) GetName() string {
+	return outbox.NotifierName("mattermost", m.opts.WebhookURL, m.opts.Channel, string(m.opts.Mode))
+}
+
+func (m *mattermost) Send(log *logrus.Logger, n logger.LogRecord) error {
+	if !m.opts.Mode.PerEvent() || n.Level > m.opts.MessageLevel {
+		return nil
+	}
+
+	return m.send(log, m.eventMessage, templates.EventData(n, m.opts.ProjectName, m.opts.ServerName))
+}
+
+func (m *mattermost) SendReport(log *logrus.Logger, rep *report.Report) error {
+	if !m.opts.Mode.Summary() || rep.Level > m.opts.MessageLevel {
+		return nil
+	}
+
+	data := templates.ReportData(rep)
+	data.Project = m.opts.ProjectName
+	data.Server = m.opts.ServerName
+
+	return m.send(log, m.summaryMessage, data)
+}
+
+func (m *mattermost) send(log *logrus.Logger, tmpl *template.Template, data templates.Data) error {
+	var b bytes.Buffer
+
+	if err := tmpl.Execute(&b, data); err != nil {
+		return outbox.Permanent(fmt.Errorf("failed to render Mattermost message: %v", err))
+	}
+
+	return m.client.PostParts(m.opts.WebhookURL, transport.Split(strings.TrimSpace(b.String()), messageLimit), func(part string, i, n int) ([]byte, error) {
+		att := attachment{
+			Fallback: strings.SplitN(part, "\n", 2)[0],
+			Color:    templates.LevelColor(data.Level),
+			Text:     escape(part),
+		}
+		if n > 1 {
+			att.Footer = fmt.Sprintf("part %d of %d", i+1, n)
+		}
+
+		payload, err := json.Marshal(message{
+			Channel:     m.opts.Channel,
+			Username:    m.opts.Username,
+			IconURL:     m.opts.IconURL,
+			Attachments: []attachment{att},
+		})
+		if err != nil {
+			return nil, outbox.Permanent(fmt.Errorf("can't marshal json for Mattermost request: %v", err))
+		}
+		return payload, nil
+	})
+}
+
+var escaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "~", `\~`, "#", `\#`,
+	"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "|", `\|`, "@", "@\u200b",
+)
+
+// escape escapes the Markdown syntax and breaks mentions with the zero width space
+func escape(s string) string {
+	return escaper.Replace(s)
+}
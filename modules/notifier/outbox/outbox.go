@@ -0,0 +1,332 @@
+package outbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nightlyone/lockfile"
+	"github.com/sirupsen/logrus"
+
+	"github.com/nixys/nxs-backup/misc"
+	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/report"
+)
+
+const (
+	msgExt    = ".json"
+	FailedDir = "failed"
+	// lockName is the lock file of the flush shared by the nxs-backup processes using the outbox
+	lockName = "flush.lck"
+)
+
+// Notifier sends notifications about events and run summaries
+type Notifier interface {
+	GetName() string
+	Send(log *logrus.Logger, rec logger.LogRecord) error
+	SendReport(log *logrus.Logger, rep *report.Report) error
+}
+
+// Policy defines how failed notifications are retried
+type Policy struct {
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+type Opts struct {
+	Enabled bool
+	Path    string
+	MaxAge  time.Duration
+	Policy  Policy
+}
+
+// Outbox delivers notifications with retries and keeps undeliverable ones on disk until the next flush
+type Outbox struct {
+	enabled bool
+	dir     string
+	maxAge  time.Duration
+	policy  Policy
+	mu      sync.Mutex
+}
+
+// Message is a notification persisted in the outbox
+type Message struct {
+	Notifier string            `json:"notifier"`
+	Created  time.Time         `json:"created"`
+	Attempts int               `json:"attempts"`
+	Event    *logger.LogRecord `json:"event,omitempty"`
+	Report   *report.Report    `json:"report,omitempty"`
+}
+
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// Permanent marks the error as the one that can't be fixed by retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent reports whether the error is marked as the one that can't be fixed by retrying
+func IsPermanent(err error) bool {
+	var pErr permanentError
+	return errors.As(err, &pErr)
+}
+
+type retryAfterError struct {
+	error
+	delay time.Duration
+}
+
+func (e retryAfterError) Unwrap() error { return e.error }
+
+// RetryAfter marks the error with the delay requested by the receiver
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return retryAfterError{err, delay}
+}
+
+// NotifierName returns the name of notifier which is stable between runs and doesn't disclose its secrets
+func NotifierName(kind string, params ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(params, "\x00")))
+	return kind + "-" + hex.EncodeToString(h[:4])
+}
+
+func Init(o Opts) *Outbox {
+	return &Outbox{
+		enabled: o.Enabled,
+		dir:     o.Path,
+		maxAge:  o.MaxAge,
+		policy:  o.Policy,
+	}
+}
+
+// Deliver sends the message with retries. The message that is still not sent is saved to the outbox
+func (o *Outbox) Deliver(log *logrus.Logger, n Notifier, msg Message) {
+	msg.Notifier = n.GetName()
+	msg.Created = time.Now()
+
+	delay := o.policy.InitialDelay
+	for {
+		msg.Attempts++
+		err := send(log, n, msg)
+		if err == nil {
+			return
+		}
+
+		var pErr permanentError
+		if errors.As(err, &pErr) {
+			log.Errorf("Failed to send notification via %s: %v", msg.Notifier, err)
+			o.save(log, msg, true)
+			return
+		}
+		if msg.Attempts >= o.policy.Attempts {
+			log.Errorf("Failed to send notification via %s after %d attempts: %v", msg.Notifier, msg.Attempts, err)
+			o.save(log, msg, false)
+			return
+		}
+
+		wait := delay
+		var raErr retryAfterError
+		if errors.As(err, &raErr) && raErr.delay > wait {
+			wait = raErr.delay
+		}
+		log.Debugf("Failed to send notification via %s: %v. Retrying in %s", msg.Notifier, err, wait)
+		time.Sleep(wait)
+
+		delay *= 2
+		if o.policy.MaxDelay > 0 && delay > o.policy.MaxDelay {
+			delay = o.policy.MaxDelay
+		}
+	}
+}
+
+// Flush tries to send the messages kept in the outbox once
+func (o *Outbox) Flush(log *logrus.Logger, notifiers []Notifier) {
+	// the previous flush is still in progress
+	if !o.enabled || !o.mu.TryLock() {
+		return
+	}
+	defer o.mu.Unlock()
+
+	unlock, err := o.lock()
+	if err != nil {
+		if !errors.Is(err, lockfile.ErrBusy) && !errors.Is(err, os.ErrNotExist) {
+			log.Errorf("Failed to lock notifications outbox: %v", err)
+		}
+		return
+	}
+	defer unlock()
+
+	files, err := listMessages(o.dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Errorf("Failed to read notifications outbox: %v", err)
+		}
+		return
+	}
+
+	ns := make(map[string]Notifier)
+	for _, n := range notifiers {
+		ns[n.GetName()] = n
+	}
+
+	for _, f := range files {
+		fp := path.Join(o.dir, f)
+		msg, err := readMessage(fp)
+		if errors.Is(err, os.ErrNotExist) {
+			// already sent by another nxs-backup process
+			continue
+		}
+		if err != nil {
+			log.Errorf("Failed to read queued notification '%s': %v", fp, err)
+			o.move(log, fp, path.Join(o.dir, FailedDir, f))
+			continue
+		}
+
+		n, ok := ns[msg.Notifier]
+		if ok {
+			msg.Attempts++
+			err = send(log, n, msg)
+			if err == nil {
+				log.Infof("Queued notification '%s' sent via %s", f, msg.Notifier)
+				_ = os.Remove(fp)
+				continue
+			}
+			log.Warnf("Failed to send queued notification '%s' via %s: %v", f, msg.Notifier, err)
+		}
+
+		var pErr permanentError
+		if errors.As(err, &pErr) || (o.maxAge > 0 && time.Since(msg.Created) > o.maxAge) {
+			log.Errorf("Queued notification '%s' can't be delivered and is moved to the failed ones", f)
+			o.move(log, fp, path.Join(o.dir, FailedDir, f))
+			continue
+		}
+		if ok {
+			if err = writeMessage(fp, msg); err != nil {
+				log.Errorf("Failed to update queued notification '%s': %v", fp, err)
+			}
+		}
+	}
+}
+
+// lock locks the outbox for the flush by another nxs-backup process
+func (o *Outbox) lock() (func(), error) {
+	dir, err := filepath.Abs(o.dir)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := lockfile.New(path.Join(dir, lockName))
+	if err != nil {
+		return nil, err
+	}
+	if err = lock.TryLock(); err != nil {
+		return nil, err
+	}
+	return func() { _ = lock.Unlock() }, nil
+}
+
+// Count returns the numbers of queued and failed messages in the outbox
+func (o *Outbox) Count() (queued, failed int) {
+	q, _ := listMessages(o.dir)
+	f, _ := listMessages(path.Join(o.dir, FailedDir))
+	return len(q), len(f)
+}
+
+func send(log *logrus.Logger, n Notifier, msg Message) error {
+	switch {
+	case msg.Event != nil:
+		return n.Send(log, *msg.Event)
+	case msg.Report != nil:
+		return n.SendReport(log, msg.Report)
+	}
+	return Permanent(fmt.Errorf("empty message"))
+}
+
+func (o *Outbox) save(log *logrus.Logger, msg Message, failed bool) {
+	if !o.enabled {
+		return
+	}
+
+	dir := o.dir
+	if failed {
+		dir = path.Join(o.dir, FailedDir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Errorf("Failed to create notifications outbox: %v", err)
+		return
+	}
+
+	fp := path.Join(dir, fmt.Sprintf("%s_%s_%s%s", msg.Created.Format("20060102T150405.000000000"), msg.Notifier, misc.RandString(6), msgExt))
+	if err := writeMessage(fp, msg); err != nil {
+		log.Errorf("Failed to save notification to the outbox: %v", err)
+		return
+	}
+	if !failed {
+		log.Infof("Notification via %s is queued to '%s'", msg.Notifier, fp)
+	}
+}
+
+func (o *Outbox) move(log *logrus.Logger, src, dst string) {
+	if err := os.MkdirAll(path.Dir(dst), 0700); err != nil {
+		log.Errorf("Failed to create directory for failed notifications: %v", err)
+		return
+	}
+	if err := os.Rename(src, dst); err != nil {
+		log.Errorf("Failed to move notification '%s': %v", src, err)
+	}
+}
+
+func listMessages(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), msgExt) {
+			files = append(files, e.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func readMessage(fp string) (msg Message, err error) {
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &msg)
+	return
+}
+
+// writeMessage writes the message atomically, so that a partially written file is never read by a flush
+func writeMessage(fp string, msg Message) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	tmp := fp + ".tmp"
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fp)
+}
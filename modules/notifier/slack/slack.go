@@ -0,0 +1,165 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/notifier/outbox"
+	"github.com/nixys/nxs-backup/modules/notifier/templates"
+	"github.com/nixys/nxs-backup/modules/notifier/transport"
+	"github.com/nixys/nxs-backup/modules/report"
+)
+
+// Slack section block text is limited by 3000 characters, escaping may make the text longer
+const sectionLimit = 2500
+
+// Opts contains Slack incoming webhook options
+type Opts struct {
+	WebhookURL      string
+	Channel         string
+	Username        string
+	IconEmoji       string
+	InsecureTLS     bool
+	MessageLevel    logrus.Level
+	Mode            report.Mode
+	MessageTemplate string
+	ProjectName     string
+	ServerName      string
+}
+
+type slack struct {
+	opts           Opts
+	client         *transport.Client
+	eventMessage   *template.Template
+	summaryMessage *template.Template
+}
+
+type message struct {
+	Channel     string       `json:"channel,omitempty"`
+	Username    string       `json:"username,omitempty"`
+	IconEmoji   string       `json:"icon_emoji,omitempty"`
+	Text        string       `json:"text"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type attachment struct {
+	Color  string  `json:"color"`
+	Blocks []block `json:"blocks"`
+}
+
+type block struct {
+	Type     string `json:"type"`
+	Text     *text  `json:"text,omitempty"`
+	Elements []text `json:"elements,omitempty"`
+}
+
+type text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func Init(opts Opts) (*slack, error) {
+	var err error
+
+	s := &slack{
+		opts:   opts,
+		client: transport.New(opts.InsecureTLS),
+	}
+
+	if _, err = url.ParseRequestURI(opts.WebhookURL); err != nil {
+		return s, fmt.Errorf("Slack init fail. Wrong webhook URL. Error: %v ", err)
+	}
+
+	if s.eventMessage, s.summaryMessage, err = templates.ParseMessages(opts.MessageTemplate); err != nil {
+		return s, fmt.Errorf("Failed to parse Slack message template. Error: %v ", err)
+	}
+
+	return s, nil
+}
+
+func (s *slack) GetName() string {
+	return outbox.NotifierName("slack", s.opts.WebhookURL, s.opts.Channel, string(s.opts.Mode))
+}
+
+func (s *slack) Send(log *logrus.Logger, n logger.LogRecord) error {
+	if !s.opts.Mode.PerEvent() || n.Level > s.opts.MessageLevel {
+		return nil
+	}
+
+	return s.send(log, s.eventMessage, templates.EventData(n, s.opts.ProjectName, s.opts.ServerName))
+}
+
+func (s *slack) SendReport(log *logrus.Logger, rep *report.Report) error {
+	if !s.opts.Mode.Summary() || rep.Level > s.opts.MessageLevel {
+		return nil
+	}
+
+	data := templates.ReportData(rep)
+	data.Project = s.opts.ProjectName
+	data.Server = s.opts.ServerName
+
+	return s.send(log, s.summaryMessage, data)
+}
+
+func (s *slack) send(log *logrus.Logger, tmpl *template.Template, data templates.Data) error {
+	var b bytes.Buffer
+
+	if err := tmpl.Execute(&b, data); err != nil {
+		return outbox.Permanent(fmt.Errorf("failed to render Slack message: %v", err))
+	}
+
+	// the limit applies to the escaped text
+	parts := transport.SplitFunc(strings.TrimSpace(b.String()), sectionLimit, escapedSize)
+
+	return s.client.PostParts(s.opts.WebhookURL, parts, func(part string, i, n int) ([]byte, error) {
+		msg := message{
+			Channel:   s.opts.Channel,
+			Username:  s.opts.Username,
+			IconEmoji: s.opts.IconEmoji,
+			// used in notifications where blocks can't be shown
+			Text: escape(strings.SplitN(part, "\n", 2)[0]),
+			Attachments: []attachment{{
+				Color: templates.LevelColor(data.Level),
+				Blocks: []block{{
+					Type: "section",
+					Text: &text{Type: "mrkdwn", Text: escape(part)},
+				}},
+			}},
+		}
+		if n > 1 {
+			msg.Attachments[0].Blocks = append(msg.Attachments[0].Blocks, block{
+				Type:     "context",
+				Elements: []text{{Type: "mrkdwn", Text: fmt.Sprintf("part %d of %d", i+1, n)}},
+			})
+		}
+
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return nil, outbox.Permanent(fmt.Errorf("can't marshal json for Slack request: %v", err))
+		}
+		return payload, nil
+	})
+}
+
+// escapedSize returns the length of the rune escaped for the Slack mrkdwn format
+func escapedSize(r rune) int {
+	switch r {
+	case '&':
+		return len("&amp;")
+	case '<', '>':
+		return len("&lt;")
+	}
+	return 1
+}
+
+// escape escapes control characters of the Slack mrkdwn format
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,129 @@
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/notifier/outbox"
+	"github.com/nixys/nxs-backup/modules/notifier/templates"
+	"github.com/nixys/nxs-backup/modules/notifier/transport"
+	"github.com/nixys/nxs-backup/modules/report"
+)
+
+// Telegram message text is limited by 4096 characters
+const messageLimit = 4000
+
+// Opts contains Telegram bot options
+type Opts struct {
+	APIURL          string
+	BotToken        string
+	ChatID          string
+	ThreadID        int
+	InsecureTLS     bool
+	MessageLevel    logrus.Level
+	Mode            report.Mode
+	MessageTemplate string
+	ProjectName     string
+	ServerName      string
+}
+
+type telegram struct {
+	opts           Opts
+	url            string
+	client         *transport.Client
+	eventMessage   *template.Template
+	summaryMessage *template.Template
+}
+
+type message struct {
+	ChatID          string `json:"chat_id"`
+	MessageThreadID int    `json:"message_thread_id,omitempty"`
+	Text            string `json:"text"`
+	ParseMode       string `json:"parse_mode"`
+}
+
+func Init(opts Opts) (*telegram, error) {
+	var err error
+
+	t := &telegram{
+		opts:   opts,
+		client: transport.New(opts.InsecureTLS),
+	}
+
+	if opts.BotToken == "" || opts.ChatID == "" {
+		return t, fmt.Errorf("Telegram init fail. `bot_token` and `chat_id` are required ")
+	}
+	if t.url, err = url.JoinPath(opts.APIURL, "bot"+opts.BotToken, "sendMessage"); err != nil {
+		return t, fmt.Errorf("Telegram init fail. Wrong API URL. Error: %v ", err)
+	}
+
+	if t.eventMessage, t.summaryMessage, err = templates.ParseMessages(opts.MessageTemplate); err != nil {
+		return t, fmt.Errorf("Failed to parse Telegram message template. Error: %v ", err)
+	}
+
+	return t, nil
+}
+
+func (t *telegram) GetName() string {
+	return outbox.NotifierName("telegram", t.opts.BotToken, t.opts.ChatID, strconv.Itoa(t.opts.ThreadID), string(t.opts.Mode))
+}
+
+func (t *telegram) Send(log *logrus.Logger, n logger.LogRecord) error {
+	if !t.opts.Mode.PerEvent() || n.Level > t.opts.MessageLevel {
+		return nil
+	}
+
+	return t.send(log, t.eventMessage, templates.EventData(n, t.opts.ProjectName, t.opts.ServerName))
+}
+
+func (t *telegram) SendReport(log *logrus.Logger, rep *report.Report) error {
+	if !t.opts.Mode.Summary() || rep.Level > t.opts.MessageLevel {
+		return nil
+	}
+
+	data := templates.ReportData(rep)
+	data.Project = t.opts.ProjectName
+	data.Server = t.opts.ServerName
+
+	return t.send(log, t.summaryMessage, data)
+}
+
+func (t *telegram) send(log *logrus.Logger, tmpl *template.Template, data templates.Data) error {
+	var b bytes.Buffer
+
+	if err := tmpl.Execute(&b, data); err != nil {
+		return outbox.Permanent(fmt.Errorf("failed to render Telegram message: %v", err))
+	}
+
+	return t.client.PostParts(t.url, transport.Split(strings.TrimSpace(b.String()), messageLimit), func(part string, i, _ int) ([]byte, error) {
+		txt := escape(part)
+		if i == 0 {
+			// the first line is a header
+			h, rest, _ := strings.Cut(txt, "\n")
+			txt = "<b>" + h + "</b>\n" + rest
+		}
+		payload, err := json.Marshal(message{
+			ChatID:          t.opts.ChatID,
+			MessageThreadID: t.opts.ThreadID,
+			Text:            txt,
+			ParseMode:       "HTML",
+		})
+		if err != nil {
+			return nil, outbox.Permanent(fmt.Errorf("can't marshal json for Telegram request: %v", err))
+		}
+		return payload, nil
+	})
+}
+
+// escape escapes the text for the Telegram HTML parse mode
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,138 @@
+package templates
+
+import (
+	"encoding/json"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+
+	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/report"
+)
+
+// Data is passed to notification templates
+type Data struct {
+	Level   string
+	Job     string
+	Storage string
+	Target  string
+	Project string
+	Server  string
+	Message string
+	// Text is the rendered message template, it is set for webhook payload templates only
+	Text string
+	// Report contains the run statistics and is set for summaries only
+	Report *report.Report
+}
+
+const (
+	// DefaultEventText is the default plain text message about an event
+	DefaultEventText = `{{ if eq .Level "warning" }}⚠️[WARNING]⚠️{{ else if eq .Level "error" }}‼️[ERROR]‼️{{ else }}[{{ upper .Level }}]{{ end }}
+
+{{ if .Project }}project: {{ .Project }}
+{{ end }}{{ if .Server }}Server: {{ .Server }}
+
+{{ end }}{{ if .Job }}Job: {{ .Job }}
+{{ end }}{{ if .Storage }}Storage: {{ .Storage }}
+{{ end }}{{ if .Target }}Target: {{ .Target }}
+{{ end }}
+Message: {{ .Message }}
+`
+	// DefaultSummaryText is the default plain text message about a backup run
+	DefaultSummaryText = `{{ .Message }}`
+)
+
+var funcs = map[string]any{
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"trim":      strings.TrimSpace,
+	"join":      strings.Join,
+	"humanSize": func(s int64) string { return units.HumanSize(float64(s)) },
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"statusColor": StatusColor,
+	"levelColor":  LevelColor,
+}
+
+// StatusColor returns the colour of the report status
+func StatusColor(status string) string {
+	switch status {
+	case report.StatusOk:
+		return "#2e7d32"
+	case report.StatusWarning, report.StatusSkipped:
+		return "#ef6c00"
+	}
+	return "#c62828"
+}
+
+// LevelColor returns the colour of the message level
+func LevelColor(level string) string {
+	switch level {
+	case "error", "fatal", "panic":
+		return "#c62828"
+	case "warning":
+		return "#ef6c00"
+	case "info":
+		return "#2e7d32"
+	}
+	return "#9e9e9e"
+}
+
+// NewText parses plain text template with the notification functions
+func NewText(name, text string) (*texttemplate.Template, error) {
+	return texttemplate.New(name).Funcs(funcs).Parse(text)
+}
+
+// ParseMessages returns event and summary plain text templates. A custom template is used for both of them
+func ParseMessages(custom string) (event, summary *texttemplate.Template, err error) {
+	if custom != "" {
+		event, err = NewText("message", custom)
+		return event, event, err
+	}
+	if event, err = NewText("message", DefaultEventText); err != nil {
+		return
+	}
+	summary, err = NewText("summary_message", DefaultSummaryText)
+	return
+}
+
+// NewHTML parses HTML template with the notification functions
+func NewHTML(name, text string) (*htmltemplate.Template, error) {
+	return htmltemplate.New(name).Funcs(funcs).Parse(text)
+}
+
+// EventData returns template data of the log record
+func EventData(rec logger.LogRecord, project, server string) Data {
+	return Data{
+		Level:   levelName(rec.Level),
+		Job:     rec.JobName,
+		Storage: rec.StorageName,
+		Target:  rec.Target,
+		Project: project,
+		Server:  server,
+		Message: rec.Message,
+	}
+}
+
+// ReportData returns template data of the run summary
+func ReportData(rep *report.Report) Data {
+	return Data{
+		Level:   levelName(rep.Level),
+		Project: rep.Project,
+		Server:  rep.Server,
+		Message: rep.String(),
+		Report:  rep,
+	}
+}
+
+func levelName(l logrus.Level) string {
+	if l == logrus.WarnLevel {
+		return "warning"
+	}
+	return l.String()
+}
@@ -0,0 +1,186 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nixys/nxs-backup/modules/notifier/outbox"
+)
+
+// Client sends JSON requests to chat APIs
+type Client struct {
+	hc *http.Client
+	mu sync.Mutex
+	// sent is the number of delivered parts of the split texts which failed to be sent completely
+	sent map[[sha256.Size]byte]int
+}
+
+func New(insecureTLS bool) *Client {
+	d := &net.Dialer{
+		Timeout: 5 * time.Second,
+	}
+	return &Client{
+		hc: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: d.DialContext,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: insecureTLS,
+				},
+			},
+		},
+		sent: make(map[[sha256.Size]byte]int),
+	}
+}
+
+// PostJSON posts the payload to the url. Errors of requests that can't succeed on retry are marked as permanent
+func (c *Client) PostJSON(url string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return outbox.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		// URLs of chat APIs contain secrets and must not be logged
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("request failed: %w", urlErr.Err)
+		}
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	return ResponseError(resp, body)
+}
+
+// PostParts posts the parts of the split text to the url one by one.
+// The parts delivered before the failed one are remembered, so the retry of the same text starts from the failed part
+func (c *Client) PostParts(url string, parts []string, payload func(part string, i, n int) ([]byte, error)) error {
+	key := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+
+	c.mu.Lock()
+	start := c.sent[key]
+	c.mu.Unlock()
+
+	for i := start; i < len(parts); i++ {
+		b, err := payload(parts[i], i, len(parts))
+		if err == nil {
+			err = c.PostJSON(url, b)
+		}
+		if err != nil {
+			c.mu.Lock()
+			if i > 0 && !outbox.IsPermanent(err) {
+				c.sent[key] = i
+			} else {
+				delete(c.sent, key)
+			}
+			c.mu.Unlock()
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	delete(c.sent, key)
+	c.mu.Unlock()
+	return nil
+}
+
+// ResponseError returns the error of unsuccessful response classified for retries
+func ResponseError(resp *http.Response, body []byte) error {
+	err := fmt.Errorf("unexpected HTTP response code: %d, body: %s", resp.StatusCode, string(body))
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if s, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && s > 0 {
+			return outbox.RetryAfter(err, time.Duration(s)*time.Second)
+		}
+		// Telegram reports the delay in the response body
+		var tgResp struct {
+			Parameters struct {
+				RetryAfter int `json:"retry_after"`
+			} `json:"parameters"`
+		}
+		if json.Unmarshal(body, &tgResp) == nil && tgResp.Parameters.RetryAfter > 0 {
+			return outbox.RetryAfter(err, time.Duration(tgResp.Parameters.RetryAfter)*time.Second)
+		}
+		return err
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusRequestTimeout:
+		return err
+	}
+	return outbox.Permanent(err)
+}
+
+// Split splits the text into parts no longer than limit runes, preferably by lines
+func Split(text string, limit int) []string {
+	return SplitFunc(text, limit, func(rune) int { return 1 })
+}
+
+// SplitFunc splits the text into parts no longer than limit, preferably by lines.
+// The length of the part is the sum of sizes of its runes
+func SplitFunc(text string, limit int, size func(r rune) int) []string {
+	length := func(s string) (l int) {
+		for _, r := range s {
+			l += size(r)
+		}
+		return
+	}
+
+	var (
+		parts []string
+		sb    strings.Builder
+		n     int
+	)
+
+	flush := func() {
+		if sb.Len() > 0 {
+			parts = append(parts, sb.String())
+			sb.Reset()
+			n = 0
+		}
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		l := length(line)
+		if n+l > limit {
+			flush()
+		}
+		// too long line is split by runes
+		for l > limit {
+			cut, cl := 0, 0
+			for i, r := range line {
+				if cl+size(r) > limit && i > 0 {
+					break
+				}
+				cut, cl = i+utf8.RuneLen(r), cl+size(r)
+			}
+			parts = append(parts, line[:cut])
+			line = line[cut:]
+			l -= cl
+		}
+		sb.WriteString(line)
+		n += l
+	}
+	flush()
+
+	return parts
+}
@@ -4,14 +4,20 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"text/template"
 	"time"
 
-	"github.com/nixys/nxs-backup/misc"
 	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/notifier/outbox"
+	"github.com/nixys/nxs-backup/modules/notifier/templates"
+	"github.com/nixys/nxs-backup/modules/notifier/transport"
+	"github.com/nixys/nxs-backup/modules/report"
 	"github.com/sirupsen/logrus"
 )
 
@@ -23,13 +29,19 @@ type Opts struct {
 	ExtraPayload      map[string]interface{}
 	ExtraHeaders      map[string]string
 	MessageLevel      logrus.Level
+	Mode              report.Mode
+	MessageTemplate   string
+	PayloadTemplate   string
 	ProjectName       string
 	ServerName        string
 }
 
 type webhook struct {
-	opts Opts
-	hc   *http.Client
+	opts           Opts
+	hc             *http.Client
+	eventMessage   *template.Template
+	summaryMessage *template.Template
+	payload        *template.Template
 }
 
 func Init(opts Opts) (*webhook, error) {
@@ -43,6 +55,18 @@ func Init(opts Opts) (*webhook, error) {
 		return wh, err
 	}
 
+	if opts.PayloadTemplate != "" {
+		if wh.payload, err = templates.NewText("payload", opts.PayloadTemplate); err != nil {
+			return wh, fmt.Errorf("Failed to parse webhook payload template. Error: %v ", err)
+		}
+	} else if opts.PayloadMessageKey == "" {
+		return wh, fmt.Errorf("Webhook init fail. Either `payload_message_key` or `payload_template` is required ")
+	}
+
+	if wh.eventMessage, wh.summaryMessage, err = templates.ParseMessages(opts.MessageTemplate); err != nil {
+		return wh, fmt.Errorf("Failed to parse webhook message template. Error: %v ", err)
+	}
+
 	d := &net.Dialer{
 		Timeout: 5 * time.Second,
 	}
@@ -59,15 +83,62 @@ func Init(opts Opts) (*webhook, error) {
 	return wh, nil
 }
 
-func (wh *webhook) Send(log *logrus.Logger, n logger.LogRecord) {
-	if n.Level > wh.opts.MessageLevel {
-		return
+func (wh *webhook) GetName() string {
+	return outbox.NotifierName("webhook", wh.opts.WebhookURL, string(wh.opts.Mode), wh.opts.PayloadMessageKey, wh.opts.MessageTemplate, wh.opts.PayloadTemplate)
+}
+
+func (wh *webhook) Send(log *logrus.Logger, n logger.LogRecord) error {
+	if !wh.opts.Mode.PerEvent() || n.Level > wh.opts.MessageLevel {
+		return nil
 	}
 
-	req, err := http.NewRequest(http.MethodPost, wh.opts.WebhookURL, bytes.NewBuffer(wh.getJsonData(log, n)))
+	return wh.render(log, wh.eventMessage, templates.EventData(n, wh.opts.ProjectName, wh.opts.ServerName))
+}
+
+// SendReport sends summary of the backup run. Without payload template the text summary is placed
+// under the payload message key and the structured one under the `report` key
+func (wh *webhook) SendReport(log *logrus.Logger, rep *report.Report) error {
+	if !wh.opts.Mode.Summary() || rep.Level > wh.opts.MessageLevel {
+		return nil
+	}
+
+	data := templates.ReportData(rep)
+	data.Project = wh.opts.ProjectName
+	data.Server = wh.opts.ServerName
+
+	return wh.render(log, wh.summaryMessage, data)
+}
+
+func (wh *webhook) render(log *logrus.Logger, msgTmpl *template.Template, data templates.Data) error {
+	var msg bytes.Buffer
+
+	if err := msgTmpl.Execute(&msg, data); err != nil {
+		return outbox.Permanent(fmt.Errorf("failed to render webhook message: %v", err))
+	}
+	data.Text = msg.String()
+
+	if wh.payload == nil {
+		jsonData, err := wh.getJsonData(data.Text, data.Report)
+		if err != nil {
+			return outbox.Permanent(err)
+		}
+		return wh.post(log, jsonData)
+	}
+
+	var payload bytes.Buffer
+	if err := wh.payload.Execute(&payload, data); err != nil {
+		return outbox.Permanent(fmt.Errorf("failed to render webhook payload: %v", err))
+	}
+	if !json.Valid(payload.Bytes()) {
+		return outbox.Permanent(fmt.Errorf("webhook payload rendered by template is not a valid JSON: %s", payload.String()))
+	}
+	return wh.post(log, payload.Bytes())
+}
+
+func (wh *webhook) post(log *logrus.Logger, jsonData []byte) error {
+	req, err := http.NewRequest(http.MethodPost, wh.opts.WebhookURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		log.Errorf("Can't create webhook request: %v", err)
-		return
+		return outbox.Permanent(fmt.Errorf("can't create webhook request: %v", err))
 	}
 	req.Header.Add("Content-Type", "application/json")
 
@@ -83,8 +154,12 @@ func (wh *webhook) Send(log *logrus.Logger, n logger.LogRecord) {
 
 	resp, err := wh.hc.Do(req)
 	if err != nil {
-		log.Errorf("Request error: %v", err)
-		return
+		// URL may contain secrets and must not be logged
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("request error: %v", urlErr.Err)
+		}
+		return fmt.Errorf("request error: %v", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
@@ -92,23 +167,26 @@ func (wh *webhook) Send(log *logrus.Logger, n logger.LogRecord) {
 	log.Tracef("HTTP response code: %d, body: %v", resp.StatusCode, string(body))
 
 	if resp.StatusCode != 200 {
-		log.Errorf("Unexpected HTTP response code: %d, body: %v", resp.StatusCode, string(body))
+		return transport.ResponseError(resp, body)
 	}
+	return nil
 }
 
-func (wh *webhook) getJsonData(log *logrus.Logger, n logger.LogRecord) []byte {
+func (wh *webhook) getJsonData(msg string, rep *report.Report) ([]byte, error) {
 	data := make(map[string]interface{})
 
-	data[wh.opts.PayloadMessageKey] = misc.GetMessage(n, wh.opts.ProjectName, wh.opts.ServerName)
+	data[wh.opts.PayloadMessageKey] = msg
+	if rep != nil {
+		data["report"] = rep
+	}
 	for k, v := range wh.opts.ExtraPayload {
 		data[k] = v
 	}
 
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		log.Errorf("Can't marshal json for webhook request: %v", err)
-		return nil
+		return nil, fmt.Errorf("can't marshal json for webhook request: %v", err)
 	}
 
-	return jsonData
+	return jsonData, nil
 }
@@ -0,0 +1,341 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+
+	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/metrics"
+)
+
+const (
+	StatusOk      = "ok"
+	StatusWarning = "warning"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// Mode defines which notifications are sent by a notifier
+type Mode string
+
+const (
+	ModePerEvent Mode = "per_event"
+	ModeSummary  Mode = "summary"
+	ModeBoth     Mode = "both"
+)
+
+func (m Mode) IsValid() bool {
+	switch m {
+	case ModePerEvent, ModeSummary, ModeBoth:
+		return true
+	}
+	return false
+}
+
+// PerEvent reports whether a notification has to be sent for each log record
+func (m Mode) PerEvent() bool { return m == ModePerEvent || m == ModeBoth }
+
+// Summary reports whether a summary has to be sent at the end of the run
+func (m Mode) Summary() bool { return m == ModeSummary || m == ModeBoth }
+
+// Duration is marshalled into a human-readable string
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).Round(time.Millisecond).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Report is a summary of the backup run
+type Report struct {
+	Project  string       `json:"project,omitempty"`
+	Server   string       `json:"server,omitempty"`
+	Status   string       `json:"status"`
+	Level    logrus.Level `json:"level"`
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	Duration Duration     `json:"duration"`
+	Jobs     []Job        `json:"jobs"`
+	Errors   []string     `json:"errors,omitempty"`
+	Warnings []string     `json:"warnings,omitempty"`
+}
+
+type Job struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Status   string   `json:"status"`
+	Targets  []Target `json:"targets"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type Target struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	Size       int64     `json:"size"`
+	BackupTime Duration  `json:"backup_time"`
+	Storages   []Storage `json:"storages"`
+}
+
+type Storage struct {
+	Name         string   `json:"name"`
+	Delivery     string   `json:"delivery"`
+	DeliveryTime Duration `json:"delivery_time"`
+	Rotated      int      `json:"rotated"`
+}
+
+// New creates a report of the run started at the specified time from the collected metrics
+func New(md *metrics.Data, started time.Time) *Report {
+	r := &Report{
+		Project:  md.Project,
+		Server:   md.Server,
+		Started:  started,
+		Finished: time.Now(),
+	}
+	r.Duration = Duration(r.Finished.Sub(r.Started))
+
+	jobNames := make([]string, 0, len(md.Job))
+	for name := range md.Job {
+		jobNames = append(jobNames, name)
+	}
+	sort.Strings(jobNames)
+
+	for _, name := range jobNames {
+		jd := md.Job[name]
+		j := Job{
+			Name: jd.JobName,
+			Type: string(jd.JobType),
+		}
+
+		ofsList := make([]string, 0, len(jd.TargetMetrics))
+		for ofs, td := range jd.TargetMetrics {
+			// skip targets that were not backed up during the run
+			if ts, ok := td.Values[metrics.BackupTimestamp]; !ok || int64(ts) < started.Unix() {
+				continue
+			}
+			ofsList = append(ofsList, ofs)
+		}
+		if len(ofsList) == 0 {
+			continue
+		}
+		sort.Strings(ofsList)
+
+		for _, ofs := range ofsList {
+			td := jd.TargetMetrics[ofs]
+			t := Target{
+				Name:       ofs,
+				Status:     StatusOk,
+				Size:       int64(td.Values[metrics.BackupSize]),
+				BackupTime: msDuration(td.Values[metrics.BackupTime]),
+			}
+			if td.Values[metrics.BackupOk] != 1 || td.Values[metrics.DeliveryOk] != 1 {
+				t.Status = StatusFailed
+			}
+
+			stNames := make([]string, 0, len(td.Storages))
+			for st := range td.Storages {
+				stNames = append(stNames, st)
+			}
+			sort.Strings(stNames)
+			for _, st := range stNames {
+				sd := td.Storages[st]
+				s := Storage{
+					Name:         st,
+					Delivery:     StatusSkipped,
+					DeliveryTime: msDuration(sd.Values[metrics.DeliveryTime]),
+					Rotated:      int(sd.Values[metrics.RotatedCount]),
+				}
+				if ok, exist := sd.Values[metrics.DeliveryOk]; exist {
+					s.Delivery = StatusFailed
+					if ok == 1 {
+						s.Delivery = StatusOk
+					}
+				}
+				t.Storages = append(t.Storages, s)
+			}
+			j.Targets = append(j.Targets, t)
+		}
+		r.Jobs = append(r.Jobs, j)
+	}
+
+	return r
+}
+
+func msDuration(ms float64) Duration {
+	return Duration(time.Duration(ms) * time.Millisecond)
+}
+
+// Collector accumulates errors and warnings logged during the run
+// It is not thread safe and has to be used by the single routine
+type Collector struct {
+	jobs     map[string]*messages
+	messages messages
+}
+
+type messages struct {
+	errors   []string
+	warnings []string
+}
+
+func NewCollector() *Collector {
+	return &Collector{jobs: make(map[string]*messages)}
+}
+
+func (c *Collector) Collect(rec logger.LogRecord) {
+	if rec.Level > logrus.WarnLevel {
+		return
+	}
+
+	m := &c.messages
+	if rec.JobName != "" {
+		jm, ok := c.jobs[rec.JobName]
+		if !ok {
+			jm = &messages{}
+			c.jobs[rec.JobName] = jm
+		}
+		m = jm
+	}
+
+	msg := rec.Message
+	if rec.StorageName != "" {
+		msg = fmt.Sprintf("%s: %s", rec.StorageName, rec.Message)
+	}
+
+	if rec.Level == logrus.WarnLevel {
+		m.warnings = append(m.warnings, msg)
+	} else {
+		m.errors = append(m.errors, msg)
+	}
+}
+
+// Complete adds collected messages to the report, sets its statuses and resets the collector
+func (c *Collector) Complete(r *Report) {
+	r.Errors = c.messages.errors
+	r.Warnings = c.messages.warnings
+
+	// jobs which failed before any target was processed
+	var extra []string
+	for name := range c.jobs {
+		found := false
+		for _, j := range r.Jobs {
+			if j.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		r.Jobs = append(r.Jobs, Job{Name: name})
+	}
+
+	for i := range r.Jobs {
+		j := &r.Jobs[i]
+		if m, ok := c.jobs[j.Name]; ok {
+			j.Errors = m.errors
+			j.Warnings = m.warnings
+		}
+		j.Status = getStatus(len(j.Errors), len(j.Warnings))
+		for _, t := range j.Targets {
+			if t.Status == StatusFailed {
+				j.Status = StatusFailed
+			}
+		}
+	}
+
+	r.Status = getStatus(len(r.Errors), len(r.Warnings))
+	for _, j := range r.Jobs {
+		if j.Status == StatusFailed || (j.Status == StatusWarning && r.Status == StatusOk) {
+			r.Status = j.Status
+		}
+	}
+
+	switch r.Status {
+	case StatusFailed:
+		r.Level = logrus.ErrorLevel
+	case StatusWarning:
+		r.Level = logrus.WarnLevel
+	default:
+		r.Level = logrus.InfoLevel
+	}
+
+	c.jobs = make(map[string]*messages)
+	c.messages = messages{}
+}
+
+func getStatus(errs, warns int) string {
+	switch {
+	case errs > 0:
+		return StatusFailed
+	case warns > 0:
+		return StatusWarning
+	}
+	return StatusOk
+}
+
+// String returns plain text representation of the report
+func (r *Report) String() string {
+	var sb strings.Builder
+
+	_, _ = fmt.Fprintf(&sb, "Backup run %s\n\n", strings.ToUpper(r.Status))
+	if r.Project != "" {
+		_, _ = fmt.Fprintf(&sb, "Project: %s\n", r.Project)
+	}
+	if r.Server != "" {
+		_, _ = fmt.Fprintf(&sb, "Server: %s\n", r.Server)
+	}
+	_, _ = fmt.Fprintf(&sb, "Started: %s\n", r.Started.Format(time.DateTime))
+	_, _ = fmt.Fprintf(&sb, "Duration: %s\n", r.Duration)
+
+	for _, j := range r.Jobs {
+		_, _ = fmt.Fprintf(&sb, "\nJob: %s (%s) - %s\n", j.Name, j.Type, j.Status)
+		for _, t := range j.Targets {
+			_, _ = fmt.Fprintf(&sb, "  %s - %s, size %s, backup time %s\n", t.Name, t.Status, units.HumanSize(float64(t.Size)), t.BackupTime)
+			for _, st := range t.Storages {
+				delivery := "delivery " + st.Delivery
+				if st.Delivery == StatusOk {
+					delivery = "delivered in " + st.DeliveryTime.String()
+				}
+				_, _ = fmt.Fprintf(&sb, "    %s: %s, rotated %d\n", st.Name, delivery, st.Rotated)
+			}
+		}
+		for _, e := range j.Errors {
+			_, _ = fmt.Fprintf(&sb, "  error: %s\n", e)
+		}
+		for _, w := range j.Warnings {
+			_, _ = fmt.Fprintf(&sb, "  warning: %s\n", w)
+		}
+	}
+
+	if len(r.Errors) > 0 || len(r.Warnings) > 0 {
+		sb.WriteString("\n")
+	}
+	for _, e := range r.Errors {
+		_, _ = fmt.Fprintf(&sb, "error: %s\n", e)
+	}
+	for _, w := range r.Warnings {
+		_, _ = fmt.Fprintf(&sb, "warning: %s\n", w)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,192 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// refRx matches value references like `${env:VAR}`, `${file:/run/secrets/x}` and `${vault:kv/data/backup#key}`
+var refRx = regexp.MustCompile(`\$\{(env|file|vault):([^}]+)}`)
+
+// secretFieldRx matches names of the config fields holding secrets, only their values are masked in logs
+var secretFieldRx = regexp.MustCompile(`(?i)(password|passphrase|token|secret|access_key|webhook_url)`)
+
+// Resolver replaces secret references in strings with their values
+type Resolver struct {
+	vault  *vaultClient
+	values map[string]struct{}
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{values: make(map[string]struct{})}
+}
+
+// SetVault enables resolving of the Vault references
+func (r *Resolver) SetVault(o VaultOpts) error {
+	vc, err := newVaultClient(o)
+	if err != nil {
+		return err
+	}
+	r.vault = vc
+	return nil
+}
+
+// Values returns the resolved values of the secret fields
+func (r *Resolver) Values() []string {
+	vals := make([]string, 0, len(r.values))
+	for v := range r.values {
+		vals = append(vals, v)
+	}
+	return vals
+}
+
+// ResolveString replaces all references in the string
+func (r *Resolver) ResolveString(s string) (string, error) {
+	return r.resolve(s, false)
+}
+
+// resolve replaces all references in the string, the values are remembered for masking if they are secret
+func (r *Resolver) resolve(s string, secret bool) (string, error) {
+	var errs []string
+
+	res := refRx.ReplaceAllStringFunc(s, func(ref string) string {
+		m := refRx.FindStringSubmatch(ref)
+		v, err := r.lookup(m[1], m[2])
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("failed to resolve `%s`: %v", ref, err))
+			return ref
+		}
+		if secret && v != "" {
+			r.values[v] = struct{}{}
+		}
+		return v
+	})
+
+	if len(errs) > 0 {
+		return s, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return res, nil
+}
+
+func (r *Resolver) lookup(kind, ref string) (string, error) {
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("environment variable is not set")
+		}
+		return v, nil
+	case "file":
+		b, err := os.ReadFile(ref)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	default:
+		if r.vault == nil {
+			return "", fmt.Errorf("vault isn't configured")
+		}
+		p, key, ok := strings.Cut(ref, "#")
+		if !ok || key == "" {
+			return "", fmt.Errorf("vault reference must be in format `path#key`")
+		}
+		return r.vault.get(p, key)
+	}
+}
+
+// Resolve replaces references in all string fields of the struct pointed by v, including nested structs,
+// slices and maps. The errors contain the `conf` tag path of the failed fields
+func (r *Resolver) Resolve(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("secrets: pointer expected, got %T", v)
+	}
+	return r.walk(rv.Elem(), "")
+}
+
+func (r *Resolver) walk(v reflect.Value, fieldPath string) error {
+	var errs *multierror.Error
+
+	switch v.Kind() {
+	case reflect.String:
+		if !refRx.MatchString(v.String()) {
+			return nil
+		}
+		s, err := r.resolve(v.String(), isSecretField(fieldPath))
+		if err != nil {
+			return fmt.Errorf("%s: %w", fieldPath, err)
+		}
+		v.SetString(s)
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return r.walk(v.Elem(), fieldPath)
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		// values stored in interfaces aren't addressable
+		nv := reflect.New(v.Elem().Type()).Elem()
+		nv.Set(v.Elem())
+		if err := r.walk(nv, fieldPath); err != nil {
+			return err
+		}
+		v.Set(nv)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Field(i).CanSet() {
+				continue
+			}
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("conf"), ",")
+			if name == "" {
+				name = t.Field(i).Name
+			}
+			if fieldPath != "" {
+				name = fieldPath + "." + name
+			}
+			if err := r.walk(v.Field(i), name); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.walk(v.Index(i), fieldPath+"["+strconv.Itoa(i)+"]"); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// map values aren't addressable
+			nv := reflect.New(iter.Value().Type()).Elem()
+			nv.Set(iter.Value())
+			if err := r.walk(nv, fmt.Sprintf("%s.%v", fieldPath, iter.Key())); err != nil {
+				errs = multierror.Append(errs, err)
+				continue
+			}
+			v.SetMapIndex(iter.Key(), nv)
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// isSecretField reports if the field holds a secret by its name. Values of headers are secret
+// as they usually carry credentials
+func isSecretField(fieldPath string) bool {
+	parts := strings.Split(fieldPath, ".")
+	for i := range parts {
+		parts[i], _, _ = strings.Cut(parts[i], "[")
+	}
+	if len(parts) > 1 && strings.HasSuffix(parts[len(parts)-2], "headers") {
+		return true
+	}
+	return secretFieldRx.MatchString(parts[len(parts)-1])
+}
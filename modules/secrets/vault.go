@@ -0,0 +1,160 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultOpts defines the Vault connection. The token auth is used if the token is set, AppRole auth otherwise
+type VaultOpts struct {
+	Address     string
+	Namespace   string
+	Token       string
+	RoleID      string
+	SecretID    string
+	AuthMount   string
+	InsecureTLS bool
+	Timeout     time.Duration
+}
+
+type vaultClient struct {
+	opts   VaultOpts
+	client *http.Client
+	token  string
+	// secrets read by path
+	cache map[string]map[string]any
+}
+
+func newVaultClient(o VaultOpts) (*vaultClient, error) {
+	if o.Address == "" {
+		return nil, fmt.Errorf("vault address isn't set")
+	}
+	if o.AuthMount == "" {
+		o.AuthMount = "approle"
+	}
+
+	return &vaultClient{
+		opts: o,
+		client: &http.Client{
+			Timeout: o.Timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: o.InsecureTLS},
+			},
+		},
+		token: o.Token,
+		cache: make(map[string]map[string]any),
+	}, nil
+}
+
+type vaultResponse struct {
+	Data   map[string]any `json:"data"`
+	Auth   *vaultAuth     `json:"auth"`
+	Errors []string       `json:"errors"`
+}
+
+type vaultAuth struct {
+	ClientToken string `json:"client_token"`
+}
+
+func (vc *vaultClient) do(method, p string, body any) (*vaultResponse, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(vc.opts.Address, "/")+"/v1/"+strings.TrimPrefix(p, "/"), r)
+	if err != nil {
+		return nil, err
+	}
+	if vc.token != "" {
+		req.Header.Set("X-Vault-Token", vc.token)
+	}
+	if vc.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", vc.opts.Namespace)
+	}
+
+	resp, err := vc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var vr vaultResponse
+	if err = json.NewDecoder(resp.Body).Decode(&vr); err != nil && resp.StatusCode/100 == 2 {
+		return nil, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		if len(vr.Errors) > 0 {
+			return nil, fmt.Errorf("vault responded %s: %s", resp.Status, strings.Join(vr.Errors, "; "))
+		}
+		return nil, fmt.Errorf("vault responded %s", resp.Status)
+	}
+	return &vr, nil
+}
+
+func (vc *vaultClient) login() error {
+	if vc.opts.RoleID == "" || vc.opts.SecretID == "" {
+		return fmt.Errorf("vault requires a token or an AppRole role_id and secret_id")
+	}
+	vr, err := vc.do(http.MethodPost, "auth/"+vc.opts.AuthMount+"/login", map[string]string{
+		"role_id":   vc.opts.RoleID,
+		"secret_id": vc.opts.SecretID,
+	})
+	if err != nil {
+		return fmt.Errorf("vault AppRole login failed: %w", err)
+	}
+	if vr.Auth == nil || vr.Auth.ClientToken == "" {
+		return fmt.Errorf("vault AppRole login failed: no client token in response")
+	}
+	vc.token = vr.Auth.ClientToken
+	return nil
+}
+
+// get returns the key of the secret, both KV v1 and KV v2 engines are supported
+func (vc *vaultClient) get(p, key string) (string, error) {
+	data, ok := vc.cache[p]
+	if !ok {
+		if vc.token == "" {
+			if err := vc.login(); err != nil {
+				return "", err
+			}
+		}
+		vr, err := vc.do(http.MethodGet, p, nil)
+		if err != nil {
+			return "", err
+		}
+		data = vr.Data
+		// KV v2 wraps the secret data with its metadata
+		if d, ok := data["data"].(map[string]any); ok {
+			if _, ok = data["metadata"]; ok {
+				data = d
+			}
+		}
+		vc.cache[p] = data
+	}
+
+	v, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key `%s` not found in secret `%s`", key, p)
+	}
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case nil:
+		return "", nil
+	default:
+		b, err := json.Marshal(val)
+		return string(b), err
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"path"
+	"regexp"
+	"time"
+)
+
+// Retention tiers of incremental backups
+const (
+	IncYear   = "year"
+	IncMonth  = "month"
+	IncDecade = "decade"
+)
+
+var (
+	decadeDirRx = regexp.MustCompile(`^day_\d\d$`)
+	monthDirRx  = regexp.MustCompile(`^month_\d\d$`)
+)
+
+// BackupFile describes a backup file found on a storage
+type BackupFile struct {
+	Path        string     `json:"path" yaml:"path"`
+	Size        int64      `json:"size" yaml:"size"`
+	ModTime     time.Time  `json:"mod_time" yaml:"mod_time"`
+	Tier        string     `json:"tier,omitempty" yaml:"tier,omitempty"`
+	LockedUntil *time.Time `json:"locked_until,omitempty" yaml:"locked_until,omitempty"`
+	// Volumes is the number of volumes of the backup split by size
+	Volumes int `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+}
+
+func NewBackupFile(p string, size int64, modTime time.Time) BackupFile {
+	return BackupFile{
+		Path:    p,
+		Size:    size,
+		ModTime: modTime,
+		Tier:    GetBackupTier(p),
+	}
+}
+
+// GetBackupTier returns the retention tier of the backup by the directory it is stored in
+func GetBackupTier(p string) string {
+	dir := path.Base(path.Dir(p))
+
+	// the monthly inc backups are stored in `<year>/month_XX/monthly`, the name matches the desc monthly period
+	if dir == "monthly" && monthDirRx.MatchString(path.Base(path.Dir(path.Dir(p)))) {
+		return IncMonth
+	}
+	for _, rp := range RetentionPeriodsList {
+		if dir == rp.String() {
+			return dir
+		}
+	}
+	switch {
+	case dir == "year":
+		return IncYear
+	case decadeDirRx.MatchString(dir):
+		return IncDecade
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// probeSize is the size of the object written by the storage check
+const probeSize = 4 << 20
+
+// SpaceReporter is implemented by storages able to report the free space available for backups
+type SpaceReporter interface {
+	FreeSpace(path string) (int64, error)
+}
+
+// BackupPather is implemented by storages that normalize the backup path on configuring
+type BackupPather interface {
+	BackupPath() string
+}
+
+// CheckResult is the result of the storage check under the backup path of the job
+type CheckResult struct {
+	Storage     string
+	Job         string
+	Path        string
+	ConnectTime time.Duration
+	// Latency is the time of the single metadata request
+	Latency time.Duration
+	// WriteSpeed and ReadSpeed are in bytes per second
+	WriteSpeed float64
+	ReadSpeed  float64
+	// FreeSpace is -1 if the storage doesn't report it
+	FreeSpace int64
+	// Step is the failed step of the check
+	Step string
+	Err  error
+}
+
+func (r CheckResult) Ok() bool {
+	return r.Err == nil
+}
+
+// Probe checks writing, reading, listing and deleting of the probe object in the directory
+func Probe(d Driver, dir string) (r CheckResult) {
+	r.Path = dir
+	r.FreeSpace = -1
+
+	fail := func(step string, err error) CheckResult {
+		r.Step, r.Err = step, err
+		return r
+	}
+
+	data := make([]byte, probeSize)
+	if _, err := rand.Read(data); err != nil {
+		return fail("write", err)
+	}
+	name := make([]byte, 8)
+	_, _ = rand.Read(name)
+	probePath := path.Join(dir, ".nxs-backup-probe-"+hex.EncodeToString(name))
+
+	start := time.Now()
+	if _, err := d.Stat(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fail("stat", err)
+	}
+	r.Latency = time.Since(start)
+
+	start = time.Now()
+	if err := d.Put(probePath, bytes.NewReader(data), probeSize); err != nil {
+		_ = d.Remove(probePath)
+		return fail("write", err)
+	}
+	r.WriteSpeed = speed(probeSize, time.Since(start))
+
+	// the probe object is deleted even if the next steps fail
+	removed := false
+	defer func() {
+		if !removed {
+			_ = d.Remove(probePath)
+		}
+	}()
+
+	start = time.Now()
+	rc, err := d.Open(probePath)
+	if err != nil {
+		return fail("read", err)
+	}
+	got, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		return fail("read", err)
+	}
+	r.ReadSpeed = speed(int64(len(got)), time.Since(start))
+	if !bytes.Equal(got, data) {
+		return fail("read", fmt.Errorf("read data differs from written, got %d bytes of %d", len(got), probeSize))
+	}
+
+	list, err := d.ReadDir(dir)
+	if err != nil {
+		return fail("list", err)
+	}
+	found := false
+	for _, fi := range list {
+		if fi.Name() == path.Base(probePath) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fail("list", fmt.Errorf("probe object '%s' not found in the listing", probePath))
+	}
+
+	removed = true
+	if err = d.Remove(probePath); err != nil {
+		return fail("delete", err)
+	}
+
+	if sr, ok := d.(SpaceReporter); ok {
+		if free, err := sr.FreeSpace(dir); err == nil {
+			r.FreeSpace = free
+		}
+	}
+	return r
+}
+
+func speed(size int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(size) / d.Seconds()
+}
@@ -15,25 +15,38 @@ import (
 type retentionPeriod string
 
 const (
+	Hourly  retentionPeriod = "hourly"
 	Daily   retentionPeriod = "daily"
 	Weekly  retentionPeriod = "weekly"
 	Monthly retentionPeriod = "monthly"
+	Yearly  retentionPeriod = "yearly"
 )
 
-var RetentionPeriodsList = []retentionPeriod{Monthly, Weekly, Daily}
+// RetentionPeriodsList is ordered from the longest period to the shortest one
+var RetentionPeriodsList = []retentionPeriod{Yearly, Monthly, Weekly, Daily, Hourly}
 
 type Params struct {
 	RateLimit     int64
 	BackupPath    string
+	VolumeSize    int64
 	RotateEnabled bool
 	Retention
 }
 
 type Retention struct {
+	Hours    int
 	Days     int
 	Weeks    int
 	Months   int
+	Years    int
 	UseCount bool
+	// anchors define when a backup gets into daily, weekly, monthly and yearly periods
+	DailyHour  int
+	WeeklyDay  int
+	MonthlyDay int
+	// LastDaily is the time of the last daily backup of the target,
+	// the first backup at or after the daily hour gets into daily and longer periods
+	LastDaily time.Time
 }
 
 func (p retentionPeriod) String() string {
@@ -41,9 +54,38 @@ func (p retentionPeriod) String() string {
 }
 
 func GetRetention(p retentionPeriod, r Retention) (retentionCount int, retentionDate time.Time) {
-	curDate := time.Now().Round(24 * time.Hour)
+	now := time.Now()
 
 	switch p {
+	case Weekly:
+		if !r.isWeeklyDay(now) {
+			return
+		}
+	case Monthly:
+		if !r.isMonthlyDay(now) {
+			return
+		}
+	case Yearly:
+		if !r.isYearlyDay(now) {
+			return
+		}
+	}
+	return GetRetentionLimits(p, r)
+}
+
+// GetRetentionLimits returns the number of backups kept in the period and the date they are kept from
+// regardless of the day the period is rotated on. Both are zero if the period is disabled
+func GetRetentionLimits(p retentionPeriod, r Retention) (retentionCount int, retentionDate time.Time) {
+	now := time.Now()
+	curDate := now.Round(24 * time.Hour)
+
+	switch p {
+	case Hourly:
+		if r.Hours == 0 {
+			return
+		}
+		retentionCount = r.Hours
+		retentionDate = now.Truncate(time.Hour).Add(-time.Duration(r.Hours-1) * time.Hour)
 	case Daily:
 		if r.Days == 0 {
 			return
@@ -51,29 +93,92 @@ func GetRetention(p retentionPeriod, r Retention) (retentionCount int, retention
 		retentionCount = r.Days
 		retentionDate = curDate.AddDate(0, 0, -r.Days+1)
 	case Weekly:
-		if misc.GetDateTimeNow("dow") != misc.WeeklyBackupDay || r.Weeks == 0 {
+		if r.Weeks == 0 {
 			return
 		}
 		retentionCount = r.Weeks
 		retentionDate = curDate.AddDate(0, 0, -r.Weeks*7+1)
 	case Monthly:
-		if misc.GetDateTimeNow("dom") != misc.MonthlyBackupDay || r.Months == 0 {
+		if r.Months == 0 {
 			return
 		}
 		retentionCount = r.Months
 		retentionDate = curDate.AddDate(0, -r.Months, 1)
+	case Yearly:
+		if r.Years == 0 {
+			return
+		}
+		retentionCount = r.Years
+		retentionDate = curDate.AddDate(-r.Years, 0, 1)
+	}
+	return
+}
+
+// GetDescBackupPeriods returns retention periods a backup made now belongs to
+func GetDescBackupPeriods(r Retention) (periods []retentionPeriod) {
+	now := time.Now()
+
+	// when hourly backups are enabled, only the first backup made at or after the daily hour
+	// gets into daily and longer periods
+	dailyAnchor := r.Hours == 0 || r.isDailyRun(now)
+
+	if dailyAnchor && r.Years > 0 && r.isYearlyDay(now) {
+		periods = append(periods, Yearly)
+	}
+	if dailyAnchor && r.Months > 0 && r.isMonthlyDay(now) {
+		periods = append(periods, Monthly)
+	}
+	if dailyAnchor && r.Weeks > 0 && r.isWeeklyDay(now) {
+		periods = append(periods, Weekly)
 	}
+	if dailyAnchor && r.Days > 0 {
+		periods = append(periods, Daily)
+	}
+	if r.Hours > 0 {
+		periods = append(periods, Hourly)
+	}
+
 	return
 }
 
-func IsNeedToBackup(day, week, month int) bool {
-	if day > 0 ||
-		(week > 0 && misc.GetDateTimeNow("dow") == misc.WeeklyBackupDay) ||
-		(month > 0 && misc.GetDateTimeNow("dom") == misc.MonthlyBackupDay) {
-		return true
+func IsNeedToBackup(r Retention) bool {
+	return len(GetDescBackupPeriods(r)) > 0
+}
+
+func (r Retention) isDailyRun(t time.Time) bool {
+	anchor := time.Date(t.Year(), t.Month(), t.Day(), r.DailyHour, 0, 0, 0, t.Location())
+	return !t.Before(anchor) && r.LastDaily.Before(anchor)
+}
+
+// WithLastDaily returns the retention with the time of the last daily backup found in the daily dir
+// of the target. It's needed only if hourly backups are enabled
+func (r Retention) WithLastDaily(d Driver, ofsPath string) Retention {
+	if r.Hours == 0 {
+		return r
+	}
+
+	fl, err := d.ReadDir(path.Join(ofsPath, Daily.String()))
+	if err != nil {
+		return r
+	}
+	for _, fi := range fl {
+		if !IsPartial(fi.Name()) && fi.ModTime().After(r.LastDaily) {
+			r.LastDaily = fi.ModTime()
+		}
 	}
+	return r
+}
+
+func (r Retention) isWeeklyDay(t time.Time) bool {
+	return int(t.Weekday()) == r.WeeklyDay
+}
 
-	return false
+func (r Retention) isMonthlyDay(t time.Time) bool {
+	return t.Day() == r.MonthlyDay
+}
+
+func (r Retention) isYearlyDay(t time.Time) bool {
+	return t.Month() == time.January && r.isMonthlyDay(t)
 }
 
 func GetDescBackupDstAndLinks(tmpBackupFile, ofs, bakPath string, retention Retention) (dst string, links map[string]string, err error) {
@@ -83,32 +188,17 @@ func GetDescBackupDstAndLinks(tmpBackupFile, ofs, bakPath string, retention Rete
 
 	bakFileName := path.Base(tmpBackupFile)
 
-	if misc.GetDateTimeNow("dom") == misc.MonthlyBackupDay && retention.Months > 0 {
-		dst = path.Join(bakPath, ofs, "monthly", bakFileName)
-	}
-	if misc.GetDateTimeNow("dow") == misc.WeeklyBackupDay && retention.Weeks > 0 {
-		dstPath := path.Join(bakPath, ofs, "weekly")
-		if dst != "" {
-			relative, err = filepath.Rel(dstPath, dst)
-			if err != nil {
-				return
-			}
-			links[path.Join(dstPath, bakFileName)] = relative
-		} else {
+	for _, p := range GetDescBackupPeriods(retention) {
+		dstPath := path.Join(bakPath, ofs, p.String())
+		if dst == "" {
 			dst = path.Join(dstPath, bakFileName)
+			continue
 		}
-	}
-	if retention.Days > 0 {
-		dstPath := path.Join(bakPath, ofs, "daily")
-		if dst != "" {
-			relative, err = filepath.Rel(dstPath, dst)
-			if err != nil {
-				return
-			}
-			links[path.Join(dstPath, bakFileName)] = relative
-		} else {
-			dst = path.Join(dstPath, bakFileName)
+		relative, err = filepath.Rel(dstPath, dst)
+		if err != nil {
+			return
 		}
+		links[path.Join(dstPath, bakFileName)] = relative
 	}
 
 	return
@@ -193,14 +283,8 @@ func GetDescBackupDstList(tmpBackupFile, ofs, bakPath string, retention Retentio
 	bakFile := path.Base(tmpBackupFile)
 	basePath := path.Join(bakPath, ofs)
 
-	if misc.GetDateTimeNow("dom") == misc.MonthlyBackupDay && retention.Months > 0 {
-		dst = append(dst, path.Join(basePath, "monthly", bakFile))
-	}
-	if misc.GetDateTimeNow("dow") == misc.WeeklyBackupDay && retention.Weeks > 0 {
-		dst = append(dst, path.Join(basePath, "weekly", bakFile))
-	}
-	if retention.Days > 0 {
-		dst = append(dst, path.Join(basePath, "daily", bakFile))
+	for _, p := range GetDescBackupPeriods(retention) {
+		dst = append(dst, path.Join(basePath, p.String(), bakFile))
 	}
 
 	return
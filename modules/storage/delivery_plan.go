@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-units"
+
+	"github.com/nixys/nxs-backup/misc"
+)
+
+// DeliveryPlan describes where a backup is going to be placed on a storage
+type DeliveryPlan struct {
+	StorageName string
+	Files       []string
+	Metadata    []string
+	// symlinks to the backup and metadata files, link path -> target
+	Links map[string]string
+	// VolumeSize is the size of volumes the backup files are split into
+	VolumeSize int64
+}
+
+func (p *DeliveryPlan) String() string {
+	var sb strings.Builder
+
+	for _, f := range p.Files {
+		if p.VolumeSize > 0 {
+			_, _ = fmt.Fprintf(&sb, "upload '%s' split into volumes of %s\n", f, units.BytesSize(float64(p.VolumeSize)))
+			continue
+		}
+		_, _ = fmt.Fprintf(&sb, "upload '%s'\n", f)
+	}
+	for _, m := range p.Metadata {
+		_, _ = fmt.Fprintf(&sb, "upload metadata '%s'\n", m)
+	}
+
+	links := make([]string, 0, len(p.Links))
+	for l := range p.Links {
+		links = append(links, l)
+	}
+	sort.Strings(links)
+	for _, l := range links {
+		_, _ = fmt.Fprintf(&sb, "symlink '%s' -> '%s'\n", l, p.Links[l])
+	}
+
+	return sb.String()
+}
+
+// GetLinksDeliveryPlan returns the plan for storages that keep one copy of a backup and symlinks to it
+func GetLinksDeliveryPlan(storageName, tmpBackupFile, ofs, bakType, bakPath string, retention Retention, volumeSize int64) (*DeliveryPlan, error) {
+	var (
+		bakDst, mtdDst string
+		err            error
+	)
+
+	p := &DeliveryPlan{StorageName: storageName, VolumeSize: volumeSize}
+
+	if bakType == string(misc.IncFiles) {
+		bakDst, mtdDst, p.Links, err = GetIncBackupDstAndLinks(tmpBackupFile, ofs, bakPath)
+	} else {
+		bakDst, p.Links, err = GetDescBackupDstAndLinks(tmpBackupFile, ofs, bakPath, retention)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bakDst != "" {
+		p.Files = append(p.Files, bakDst)
+	}
+	if mtdDst != "" {
+		p.Metadata = append(p.Metadata, mtdDst)
+	}
+
+	return p, nil
+}
+
+// GetCopiesDeliveryPlan returns the plan for storages that keep a separate copy of a backup for each period
+func GetCopiesDeliveryPlan(storageName, tmpBackupFile, ofs, bakType, bakPath string, retention Retention, volumeSize int64) *DeliveryPlan {
+	p := &DeliveryPlan{StorageName: storageName, VolumeSize: volumeSize}
+
+	if bakType == string(misc.IncFiles) {
+		p.Files, p.Metadata = GetIncBackupDstList(tmpBackupFile, ofs, bakPath)
+	} else {
+		p.Files = GetDescBackupDstList(tmpBackupFile, ofs, bakPath, retention)
+	}
+
+	return p
+}
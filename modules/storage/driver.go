@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Driver is a minimal set of file operations provided by every storage.
+// All paths are storage paths, i.e. already joined with the backup path.
+// Missing files must be reported with an error matching fs.ErrNotExist.
+type Driver interface {
+	Stat(path string) (fs.FileInfo, error)
+	ReadDir(path string) ([]fs.FileInfo, error)
+	Open(path string) (io.ReadCloser, error)
+	Put(path string, r io.Reader, size int64) error
+	Remove(path string) error
+	RemoveAll(path string) error
+}
+
+type fileInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+	isDir bool
+}
+
+// NewFileInfo returns fs.FileInfo for storages that have no native file info type
+func NewFileInfo(name string, size int64, mtime time.Time, isDir bool) fs.FileInfo {
+	return &fileInfo{
+		name:  name,
+		size:  size,
+		mtime: mtime,
+		isDir: isDir,
+	}
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.isDir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return fi.mtime
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return fi.isDir
+}
+
+func (fi *fileInfo) Sys() interface{} {
+	return nil
+}
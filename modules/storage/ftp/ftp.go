@@ -7,14 +7,10 @@ import (
 	"io"
 	"io/fs"
 	"net/textproto"
+	"os"
 	"path"
-	"regexp"
-	"sort"
-	"strconv"
-	"strings"
 	"time"
 
-	"github.com/hashicorp/go-multierror"
 	"github.com/jlaffaye/ftp"
 
 	"github.com/nixys/nxs-backup/interfaces"
@@ -26,9 +22,11 @@ import (
 
 type FTP struct {
 	conn          *ftp.ServerConn
+	retry         RetryPolicy
 	name          string
 	backupPath    string
 	rateLimit     int64
+	volumeSize    int64
 	rotateEnabled bool
 	opts          Opts
 	Retention
@@ -43,11 +41,12 @@ type Opts struct {
 	ConnectionTimeout time.Duration
 }
 
-func Init(name string, opts Opts, rl int64) (s *FTP, err error) {
+func Init(name string, opts Opts, rl int64, retry RetryPolicy) (s *FTP, err error) {
 
 	s = &FTP{
 		name:      name,
 		opts:      opts,
+		retry:     retry,
 		rateLimit: rl,
 	}
 
@@ -62,6 +61,7 @@ func Init(name string, opts Opts, rl int64) (s *FTP, err error) {
 func (f *FTP) Configure(p Params) {
 	f.backupPath = p.BackupPath
 	f.rateLimit = p.RateLimit
+	f.volumeSize = p.VolumeSize
 	f.rotateEnabled = p.RotateEnabled
 	f.Retention = p.Retention
 }
@@ -94,214 +94,135 @@ func (f *FTP) updateConn() error {
 	return err
 }
 
+// reconnect drops the current connection and dials the new one
+func (f *FTP) reconnect() error {
+	if f.conn != nil {
+		_ = f.conn.Quit()
+		f.conn = nil
+	}
+	return f.updateConn()
+}
+
 func (f *FTP) IsLocal() int { return 0 }
 
+func (f *FTP) VolumeSize() int64 { return f.volumeSize }
+
 func (f *FTP) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFile, ofs string, bakType string) error {
+	deliveryLog := logger.Log(jobName, f.name).WithTarget(ofs).WithPhase(logger.PhaseDeliver)
+
 	var bakRemPaths, mtdRemPaths []string
 
 	if bakType == string(misc.IncFiles) {
 		bakRemPaths, mtdRemPaths = GetIncBackupDstList(tmpBackupFile, ofs, f.backupPath)
 	} else {
-		bakRemPaths = GetDescBackupDstList(tmpBackupFile, ofs, f.backupPath, f.Retention)
+		bakRemPaths = GetDescBackupDstList(tmpBackupFile, ofs, f.backupPath, f.Retention.WithLastDaily(f, path.Join(f.backupPath, ofs)))
 	}
 
 	if len(mtdRemPaths) > 0 {
 		for _, dstPath := range mtdRemPaths {
-			if err := f.copy(logCh, jobName, dstPath, tmpBackupFile+".inc"); err != nil {
+			if err := f.copy(logCh, deliveryLog, dstPath, tmpBackupFile+".inc"); err != nil {
 				return err
 			}
 		}
 	}
 
+	volumes, err := SplitVolumes(tmpBackupFile, f.volumeSize)
+	if err != nil {
+		logCh <- deliveryLog.Errorf("Unable to split backup into volumes: %s", err)
+		return err
+	}
+
 	for _, dstPath := range bakRemPaths {
-		if err := f.copy(logCh, jobName, dstPath, tmpBackupFile); err != nil {
-			return err
+		for _, vol := range volumes {
+			if err = f.copy(logCh, deliveryLog, VolumePath(dstPath, vol), vol); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-func (f *FTP) copy(logCh chan logger.LogRecord, job, dst, src string) error {
-
-	// Make remote directories
-	dstDir := path.Dir(dst)
-	if err := f.mkDir(dstDir); err != nil {
-		logCh <- logger.Log(job, f.name).Errorf("Unable to create remote directory '%s': '%s'", dstDir, err)
-		return err
-	}
-
-	srcFile, err := files.GetLimitedFileReader(src, f.rateLimit)
+func (f *FTP) copy(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, dst, src string) error {
+	srcStat, err := os.Stat(src)
 	if err != nil {
-		logCh <- logger.Log(job, f.name).Errorf("Unable to open file: '%s'", err)
+		logCh <- deliveryLog.Errorf("Unable to open file: '%s'", err)
 		return err
 	}
-	defer func() { _ = srcFile.Close() }()
 
-	if err = f.updateConn(); err != nil {
-		return err
+	partPath := PartialPath(dst)
+	err = Retry(logCh, deliveryLog, f.retry, f.reconnect, func(attempt int) error {
+		return f.upload(logCh, deliveryLog, partPath, src, attempt > 1)
+	})
+	if err == nil {
+		err = Retry(logCh, deliveryLog, f.retry, f.reconnect, func(int) error {
+			return CommitPartial(f, partPath, dst, srcStat.Size())
+		})
 	}
-	err = f.conn.Stor(dst, srcFile)
 	if err != nil {
-		logCh <- logger.Log(job, f.name).Errorf("Unable to upload file '%s'. Err: %s", dst, err)
+		logCh <- deliveryLog.Errorf("Unable to upload file '%s'. Err: %s", dst, err)
 		return err
 	}
 
-	logCh <- logger.Log(job, f.name).Infof("Successfully uploaded file '%s'", dst)
+	logCh <- deliveryLog.Infof("Successfully uploaded file '%s'", dst)
 	return nil
 }
 
-func (f *FTP) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) error {
-	if !f.rotateEnabled {
-		logCh <- logger.Log(job.GetName(), f.name).Debugf("Backup rotate skipped by config.")
-		return nil
+// upload stores the file, the interrupted upload is resumed with the REST command from the size of the uploaded part
+func (f *FTP) upload(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, dst, src string, resume bool) error {
+	// Make remote directories
+	dstDir := path.Dir(dst)
+	if err := f.mkDir(dstDir); err != nil {
+		return fmt.Errorf("unable to create remote directory '%s': %w", dstDir, err)
 	}
 
-	if err := f.updateConn(); err != nil {
+	srcFile, err := files.GetLimitedFileReader(src, f.rateLimit)
+	if err != nil {
 		return err
 	}
+	defer func() { _ = srcFile.Close() }()
 
-	if job.GetType() == misc.IncFiles {
-		return f.deleteIncBackup(logCh, job.GetName(), ofsPart, full)
-	} else {
-		return f.deleteDescBackup(logCh, job.GetName(), ofsPart, job.IsBackupSafety())
+	srcStat, err := os.Stat(src)
+	if err != nil {
+		return err
 	}
-}
 
-func (f *FTP) deleteDescBackup(logCh chan logger.LogRecord, job, ofsPart string, safety bool) error {
-	var errs *multierror.Error
-
-	for _, p := range RetentionPeriodsList {
-		retentionCount, retentionDate := GetRetention(p, f.Retention)
-		if retentionCount == 0 && retentionDate.IsZero() {
-			continue
-		}
-
-		bakDir := path.Join(f.backupPath, ofsPart, p.String())
-		if err := f.updateConn(); err != nil {
-			return err
-		}
-		fptFiles, err := f.conn.List(bakDir)
-		if err != nil {
-			var protoErr *textproto.Error
-			errors.As(err, &protoErr)
-			if protoErr.Code == 550 {
-				continue
-			}
-			logCh <- logger.Log(job, f.name).Errorf("Failed to read files in remote directory '%s' with next error: %s", bakDir, err)
-			return err
-		}
-
-		if f.Retention.UseCount {
-			sort.Slice(fptFiles, func(i, j int) bool {
-				return fptFiles[i].Time.Before(fptFiles[j].Time)
-			})
-			if !safety {
-				retentionCount--
-			}
-			if retentionCount <= len(fptFiles) {
-				fptFiles = fptFiles[:len(fptFiles)-retentionCount]
-			} else {
-				fptFiles = fptFiles[:0]
-			}
-		} else {
-			i := 0
-			for _, file := range fptFiles {
-				if file.Time.Location() != retentionDate.Location() {
-					retentionDate = retentionDate.In(file.Time.Location())
-				}
-
-				if file.Time.Before(retentionDate) {
-					fptFiles[i] = file
-					i++
-				}
-			}
-			fptFiles = fptFiles[:i]
-		}
-
-		for _, file := range fptFiles {
-			if file.Name == ".." || file.Name == "." {
-				continue
-			}
-
-			if err = f.updateConn(); err != nil {
+	if resume {
+		if size, err := f.conn.FileSize(dst); err == nil && size > 0 && size <= srcStat.Size() {
+			if _, err = srcFile.Seek(size, io.SeekStart); err != nil {
 				return err
 			}
-			err = f.conn.Delete(path.Join(bakDir, file.Name))
-			if err != nil {
-				logCh <- logger.Log(job, f.name).Errorf("Failed to delete file '%s' in remote directory '%s' with next error: %s",
-					file.Name, bakDir, err)
-				errs = multierror.Append(errs, err)
-			} else {
-				logCh <- logger.Log(job, f.name).Infof("Deleted old backup file '%s' in remote directory '%s'", file.Name, bakDir)
-			}
+			logCh <- deliveryLog.Infof("Resuming upload of '%s' from %d bytes", dst, size)
+			return f.conn.StorFrom(dst, srcFile, uint64(size))
 		}
 	}
-
-	return errs.ErrorOrNil()
+	return f.conn.Stor(dst, srcFile)
 }
 
-func (f *FTP) deleteIncBackup(logCh chan logger.LogRecord, job, ofsPart string, full bool) error {
-	var errs *multierror.Error
-
-	if err := f.updateConn(); err != nil {
-		return err
-	}
-	if full {
-		backupDir := path.Join(f.backupPath, ofsPart)
-
-		if err := f.conn.ChangeDir(backupDir); err != nil {
-			protoErr := err.(*textproto.Error)
-			if protoErr.Code == 550 {
-				return nil
-			} else {
-				logCh <- logger.Log(job, f.name).Errorf("Failed to get access to directory '%s' with next error: %v", backupDir, err)
-				return err
-			}
-		}
-
-		if err := f.conn.RemoveDirRecur(backupDir); err != nil {
-			logCh <- logger.Log(job, f.name).Errorf("Failed to delete '%s' with next error: %s", backupDir, err)
-			errs = multierror.Append(errs, err)
-		}
-	} else {
-		intMoy, _ := strconv.Atoi(misc.GetDateTimeNow("moy"))
-		lastMonth := intMoy - f.Months
+func (f *FTP) GetDeliveryPlan(tmpBackupFile, ofs, bakType string) (*DeliveryPlan, error) {
+	return GetCopiesDeliveryPlan(f.GetName(), tmpBackupFile, ofs, bakType, f.backupPath, f.Retention.WithLastDaily(f, path.Join(f.backupPath, ofs)), f.volumeSize), nil
+}
 
-		var year string
-		if lastMonth > 0 {
-			year = misc.GetDateTimeNow("year")
-		} else {
-			year = misc.GetDateTimeNow("previous_year")
-			lastMonth += 12
-		}
+func (f *FTP) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) (RotationStats, error) {
+	return DeleteOldBackups(logCh, f, f.rotationOpts(ofsPart, job, full))
+}
 
-		backupDir := path.Join(f.backupPath, ofsPart, year)
+func (f *FTP) GetRotationPlan(ofsPart string, job interfaces.Job, full bool) (*RotationPlan, error) {
+	return PlanRotation(f, f.rotationOpts(ofsPart, job, full))
+}
 
-		dirs, err := f.conn.List(backupDir)
-		if err != nil {
-			logCh <- logger.Log(job, f.name).Errorf("Failed to get access to directory '%s' with next error: %v", backupDir, err)
-			return err
-		}
-		rx := regexp.MustCompile(`month_\d\d`)
-		for _, dir := range dirs {
-			if rx.MatchString(dir.Name) {
-				dirParts := strings.Split(dir.Name, "_")
-				dirMonth, _ := strconv.Atoi(dirParts[1])
-				if dirMonth < lastMonth {
-					if err = f.conn.RemoveDirRecur(path.Join(backupDir, dir.Name)); err != nil {
-						logCh <- logger.Log(job, f.name).Errorf("Failed to delete '%s' in dir '%s' with next error: %s",
-							dir.Name, backupDir, err)
-						errs = multierror.Append(errs, err)
-					} else {
-						logCh <- logger.Log(job, f.name).Infof("Deleted old backup '%s' in directory '%s'", dir.Name, backupDir)
-					}
-				}
-			}
-		}
+func (f *FTP) rotationOpts(ofsPart string, job interfaces.Job, full bool) RotationOpts {
+	return RotationOpts{
+		JobName:     job.GetName(),
+		StorageName: f.GetName(),
+		BackupPath:  f.backupPath,
+		Ofs:         ofsPart,
+		Enabled:     f.rotateEnabled,
+		Retention:   f.Retention,
+		IncBackup:   job.GetType() == misc.IncFiles,
+		Full:        full,
+		Safety:      job.IsBackupSafety(),
 	}
-
-	return errs.ErrorOrNil()
 }
 
 func (f *FTP) mkDir(dstPath string) error {
@@ -336,6 +257,10 @@ func (f *FTP) GetFileReader(ofsPath string) (io.Reader, error) {
 		return nil, err
 	}
 
+	if r, err := ReadVolumes(f, path.Join(f.backupPath, ofsPath)); !errors.Is(err, fs.ErrNotExist) {
+		return r, err
+	}
+
 	// return fs.ErrNotExist if entry not available
 	if _, err := f.conn.GetEntry(path.Join(f.backupPath, ofsPath)); err != nil {
 		var protoErr *textproto.Error
@@ -365,7 +290,7 @@ func (f *FTP) GetFileReader(ofsPath string) (io.Reader, error) {
 	return bytes.NewReader(buf), nil
 }
 
-func (f *FTP) ListBackups(ofsPath string) ([]string, error) {
+func (f *FTP) ListBackups(ofsPath string) ([]BackupFile, error) {
 	bPath := path.Join(f.backupPath, ofsPath)
 
 	fl, err := f.listFiles(bPath)
@@ -373,7 +298,12 @@ func (f *FTP) ListBackups(ofsPath string) ([]string, error) {
 		return nil, err
 	}
 
-	return f.listPaths(bPath, fl)
+	list, err := f.listPaths(bPath, fl)
+	if err != nil {
+		return nil, err
+	}
+
+	return GroupVolumes(list), nil
 }
 
 func (f *FTP) listFiles(dstPath string) ([]*ftp.Entry, error) {
@@ -387,9 +317,8 @@ func (f *FTP) listFiles(dstPath string) ([]*ftp.Entry, error) {
 	}
 	ftpEntries, err := f.conn.List(dstPath)
 	if err != nil {
-		errors.As(err, &protoErr)
-		if protoErr.Code == 550 {
-			err = fmt.Errorf("%s: %v", dstPath, fs.ErrNotExist)
+		if errors.As(err, &protoErr) && protoErr.Code == 550 {
+			err = fmt.Errorf("%s: %w", dstPath, fs.ErrNotExist)
 		}
 		return nil, err
 	}
@@ -404,13 +333,13 @@ func (f *FTP) listFiles(dstPath string) ([]*ftp.Entry, error) {
 	return ftpFiles, nil
 }
 
-func (f *FTP) listPaths(base string, fList []*ftp.Entry) ([]string, error) {
-	var paths []string
+func (f *FTP) listPaths(base string, fList []*ftp.Entry) ([]BackupFile, error) {
+	var paths []BackupFile
 
 	for _, file := range fList {
 		if file.Type != ftp.EntryTypeFolder {
 			fp := path.Join(base, file.Name)
-			paths = append(paths, fp)
+			paths = append(paths, NewBackupFile(fp, int64(file.Size), file.Time))
 		} else {
 			subDir := path.Join(base, file.Name)
 			subDirFiles, err := f.listFiles(subDir)
@@ -428,6 +357,74 @@ func (f *FTP) listPaths(base string, fList []*ftp.Entry) ([]string, error) {
 	return paths, nil
 }
 
+func (f *FTP) Stat(p string) (fs.FileInfo, error) {
+	if err := f.updateConn(); err != nil {
+		return nil, err
+	}
+
+	e, err := f.conn.GetEntry(p)
+	if err != nil {
+		return nil, convertErr(p, err)
+	}
+	return NewFileInfo(path.Base(p), int64(e.Size), e.Time, e.Type == ftp.EntryTypeFolder), nil
+}
+
+func (f *FTP) ReadDir(p string) ([]fs.FileInfo, error) {
+	entries, err := f.listFiles(p)
+	if err != nil {
+		return nil, err
+	}
+
+	fl := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fl = append(fl, NewFileInfo(e.Name, int64(e.Size), e.Time, e.Type == ftp.EntryTypeFolder))
+	}
+	return fl, nil
+}
+
+func (f *FTP) Open(p string) (io.ReadCloser, error) {
+	if _, err := f.Stat(p); err != nil {
+		return nil, err
+	}
+	return f.conn.Retr(p)
+}
+
+func (f *FTP) Put(p string, r io.Reader, _ int64) error {
+	if err := f.mkDir(path.Dir(p)); err != nil {
+		return err
+	}
+	return f.conn.Stor(p, files.GetLimitedReader(r, f.rateLimit))
+}
+
+func (f *FTP) Rename(oldpath, newpath string) error {
+	if err := f.updateConn(); err != nil {
+		return err
+	}
+	return f.conn.Rename(oldpath, newpath)
+}
+
+func (f *FTP) Remove(p string) error {
+	if err := f.updateConn(); err != nil {
+		return err
+	}
+	return convertErr(p, f.conn.Delete(p))
+}
+
+func (f *FTP) RemoveAll(p string) error {
+	if err := f.updateConn(); err != nil {
+		return err
+	}
+	return convertErr(p, f.conn.RemoveDirRecur(p))
+}
+
+func convertErr(p string, err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code == 550 {
+		return &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+	}
+	return err
+}
+
 func (f *FTP) Close() error {
 	return f.conn.Quit()
 }
@@ -437,6 +434,10 @@ func (f *FTP) Clone() interfaces.Storage {
 	return &cl
 }
 
+func (f *FTP) BackupPath() string {
+	return f.backupPath
+}
+
 func (f *FTP) GetName() string {
 	return f.name
 }
@@ -2,18 +2,11 @@ package local
 
 import (
 	"errors"
-	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
-	"regexp"
-	"sort"
-	"strconv"
-	"strings"
-
-	"github.com/hashicorp/go-multierror"
 
 	"github.com/nixys/nxs-backup/interfaces"
 	"github.com/nixys/nxs-backup/misc"
@@ -25,6 +18,7 @@ import (
 type Local struct {
 	backupPath    string
 	rateLimit     int64
+	volumeSize    int64
 	rotateEnabled bool
 	Retention
 }
@@ -38,13 +32,18 @@ func Init(rl int64) *Local {
 func (l *Local) Configure(p Params) {
 	l.backupPath = p.BackupPath
 	l.rateLimit = p.RateLimit
+	l.volumeSize = p.VolumeSize
 	l.rotateEnabled = p.RotateEnabled
 	l.Retention = p.Retention
 }
 
 func (l *Local) IsLocal() int { return 1 }
 
+func (l *Local) VolumeSize() int64 { return l.volumeSize }
+
 func (l *Local) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFile, ofs, bakType string) (err error) {
+	deliveryLog := logger.Log(jobName, l.GetName()).WithTarget(ofs).WithPhase(logger.PhaseDeliver)
+
 	var (
 		bakDstPath, mtdDstPath string
 		links                  map[string]string
@@ -53,79 +52,105 @@ func (l *Local) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFi
 	if bakType == string(misc.IncFiles) {
 		bakDstPath, mtdDstPath, links, err = GetIncBackupDstAndLinks(tmpBackupFile, ofs, l.backupPath)
 	} else {
-		bakDstPath, links, err = GetDescBackupDstAndLinks(tmpBackupFile, ofs, l.backupPath, l.Retention)
+		bakDstPath, links, err = GetDescBackupDstAndLinks(tmpBackupFile, ofs, l.backupPath, l.Retention.WithLastDaily(l, path.Join(l.backupPath, ofs)))
 	}
 	if err != nil {
-		logCh <- logger.Log(jobName, l.GetName()).Errorf("Unable to get destination path and links: '%s'", err)
+		logCh <- deliveryLog.Errorf("Unable to get destination path and links: '%s'", err)
 		return
 	}
 
 	if mtdDstPath != "" {
-		if err = l.deliveryBackupMetadata(logCh, jobName, tmpBackupFile, mtdDstPath); err != nil {
+		if err = l.deliveryBackupMetadata(logCh, deliveryLog, tmpBackupFile, mtdDstPath); err != nil {
 			return
 		}
 	}
 
 	err = os.MkdirAll(path.Dir(bakDstPath), os.ModePerm)
 	if err != nil {
-		logCh <- logger.Log(jobName, l.GetName()).Errorf("Unable to create directory: '%s'", err)
+		logCh <- deliveryLog.Errorf("Unable to create directory: '%s'", err)
 		return err
 	}
 
-	if err = os.Rename(tmpBackupFile, bakDstPath); err != nil {
-		logCh <- logger.Log(jobName, l.GetName()).Debugf("Unable to move temp backup: %s", err)
-		err = nil
-		bakDst, err := os.Create(bakDstPath)
-		if err != nil {
-			return err
-		}
-		defer func() { _ = bakDst.Close() }()
-
-		bakSrc, err := files.GetLimitedFileReader(tmpBackupFile, l.rateLimit)
-		if err != nil {
-			return err
-		}
-		defer func() { _ = bakSrc.Close() }()
+	volumes, err := SplitVolumes(tmpBackupFile, l.volumeSize)
+	if err != nil {
+		logCh <- deliveryLog.Errorf("Unable to split backup into volumes: %s", err)
+		return err
+	}
 
-		_, err = io.Copy(bakDst, bakSrc)
-		if err != nil {
-			logCh <- logger.Log(jobName, l.GetName()).Errorf("Unable to make copy: %s", err)
-			return err
+	for _, vol := range volumes {
+		volDst := VolumePath(bakDstPath, vol)
+		if err = os.Rename(vol, volDst); err != nil {
+			logCh <- deliveryLog.Debugf("Unable to move temp backup: %s", err)
+			if err = l.copy(vol, volDst); err != nil {
+				logCh <- deliveryLog.Errorf("Unable to make copy: %s", err)
+				return err
+			}
+			logCh <- deliveryLog.Infof("Successfully copied temp backup to %s", volDst)
+		} else {
+			logCh <- deliveryLog.Infof("Successfully moved temp backup to %s", volDst)
 		}
-		logCh <- logger.Log(jobName, l.GetName()).Infof("Successfully copied temp backup to %s", bakDstPath)
-	} else {
-		logCh <- logger.Log(jobName, l.GetName()).Infof("Successfully moved temp backup to %s", bakDstPath)
 	}
 
-	for dst, src := range links {
+	for dst, src := range VolumeLinks(links, tmpBackupFile, volumes) {
 		err = os.MkdirAll(path.Dir(dst), os.ModePerm)
 		if err != nil {
-			logCh <- logger.Log(jobName, l.GetName()).Errorf("Unable to create directory: '%s'", err)
+			logCh <- deliveryLog.Errorf("Unable to create directory: '%s'", err)
 			return err
 		}
 		_ = os.Remove(dst)
 		if err = os.Symlink(src, dst); err != nil {
 			return err
 		}
-		logCh <- logger.Log(jobName, l.GetName()).Infof("Successfully created symlink %s", dst)
+		logCh <- deliveryLog.Infof("Successfully created symlink %s", dst)
 	}
 
 	return
 }
 
-func (l *Local) deliveryBackupMetadata(logCh chan logger.LogRecord, jobName, tmpBackupFile, mtdDstPath string) error {
+// copy copies the file to the partial file and renames it after the complete copying
+func (l *Local) copy(srcPath, dstPath string) error {
+	srcStat, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+
+	partPath := PartialPath(dstPath)
+	dst, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+
+	src, err := files.GetLimitedFileReader(srcPath, l.rateLimit)
+	if err != nil {
+		_ = dst.Close()
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	_, err = io.Copy(dst, src)
+	if cErr := dst.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return CommitPartial(l, partPath, dstPath, srcStat.Size())
+}
+
+func (l *Local) deliveryBackupMetadata(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, tmpBackupFile, mtdDstPath string) error {
 	mtdSrcPath := tmpBackupFile + ".inc"
 
 	err := os.MkdirAll(path.Dir(mtdDstPath), os.ModePerm)
 	if err != nil {
-		logCh <- logger.Log(jobName, l.GetName()).Errorf("Unable to create directory: '%s'", err)
+		logCh <- deliveryLog.Errorf("Unable to create directory: '%s'", err)
 		return err
 	}
 
 	_ = os.Remove(mtdDstPath)
 
 	if err = os.Rename(mtdSrcPath, mtdDstPath); err != nil {
-		logCh <- logger.Log(jobName, l.GetName()).Debugf("Unable to move temp backup: %s", err)
+		logCh <- deliveryLog.Debugf("Unable to move temp backup: %s", err)
 
 		mtdDst, err := os.Create(mtdDstPath)
 		if err != nil {
@@ -141,265 +166,141 @@ func (l *Local) deliveryBackupMetadata(logCh chan logger.LogRecord, jobName, tmp
 
 		_, err = io.Copy(mtdDst, mtdSrc)
 		if err != nil {
-			logCh <- logger.Log(jobName, l.GetName()).Errorf("Unable to make copy: %s", err)
+			logCh <- deliveryLog.Errorf("Unable to make copy: %s", err)
 			return err
 		}
-		logCh <- logger.Log(jobName, l.GetName()).Infof("Successfully copied metadata to %s", mtdDstPath)
+		logCh <- deliveryLog.Infof("Successfully copied metadata to %s", mtdDstPath)
 	} else {
-		logCh <- logger.Log(jobName, l.GetName()).Infof("Successfully moved metadata to %s", mtdDstPath)
+		logCh <- deliveryLog.Infof("Successfully moved metadata to %s", mtdDstPath)
 	}
 	return nil
 }
 
-func (l *Local) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) error {
-	if !l.rotateEnabled {
-		logCh <- logger.Log(job.GetName(), l.GetName()).Debugf("Backup rotate skipped by config.")
-		return nil
-	}
+func (l *Local) GetDeliveryPlan(tmpBackupFile, ofs, bakType string) (*DeliveryPlan, error) {
+	return GetLinksDeliveryPlan(l.GetName(), tmpBackupFile, ofs, bakType, l.backupPath, l.Retention.WithLastDaily(l, path.Join(l.backupPath, ofs)), l.volumeSize)
+}
 
-	if job.GetType() == misc.IncFiles {
-		return l.deleteIncBackup(logCh, job.GetName(), ofsPart, full)
-	} else {
-		return l.deleteDescBackup(logCh, job.GetName(), ofsPart, job.IsBackupSafety())
+func (l *Local) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) (RotationStats, error) {
+	return DeleteOldBackups(logCh, l, l.rotationOpts(ofsPart, job, full))
+}
+
+func (l *Local) GetRotationPlan(ofsPart string, job interfaces.Job, full bool) (*RotationPlan, error) {
+	return PlanRotation(l, l.rotationOpts(ofsPart, job, full))
+}
+
+func (l *Local) rotationOpts(ofsPart string, job interfaces.Job, full bool) RotationOpts {
+	return RotationOpts{
+		JobName:     job.GetName(),
+		StorageName: l.GetName(),
+		BackupPath:  l.backupPath,
+		Ofs:         ofsPart,
+		Enabled:     l.rotateEnabled,
+		Retention:   l.Retention,
+		IncBackup:   job.GetType() == misc.IncFiles,
+		Full:        full,
+		Safety:      job.IsBackupSafety(),
 	}
 }
 
-func (l *Local) deleteDescBackup(logCh chan logger.LogRecord, jobName, ofsPart string, safety bool) error {
-	type fileLinks struct {
-		wLink string
-		dLink string
+func (l *Local) GetFileReader(filePath string) (io.Reader, error) {
+	if r, err := ReadVolumes(l, path.Join(l.backupPath, filePath)); !errors.Is(err, fs.ErrNotExist) {
+		return r, err
 	}
-	var errs *multierror.Error
-	filesMap := make(map[string]*fileLinks, 64)
-	filesToDeleteMap := make(map[string]*fileLinks, 64)
-
-	for _, p := range RetentionPeriodsList {
-		retentionCount, retentionDate := GetRetention(p, l.Retention)
-		if retentionCount == 0 && retentionDate.IsZero() {
-			continue
-		}
 
-		bakDir := path.Join(l.backupPath, ofsPart, p.String())
+	fp, err := filepath.EvalSymlinks(path.Join(l.backupPath, filePath))
+	if err != nil {
+		return nil, err
+	}
+	return files.GetLimitedFileReader(fp, l.rateLimit)
+}
 
-		dir, err := os.Open(bakDir)
+func (l *Local) ListBackups(ofsPart string) ([]BackupFile, error) {
+	backups := make([]BackupFile, 0)
+	err := filepath.WalkDir(path.Join(l.backupPath, ofsPart), func(path string, d os.DirEntry, err error) error {
 		if err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				logCh <- logger.Log(jobName, l.GetName()).Debugf("Backups directory `%s` not found. Continue.", bakDir)
-				continue
-			}
-			logCh <- logger.Log(jobName, l.GetName()).Errorf("Failed to open directory '%s' with next error: %s", bakDir, err)
 			return err
 		}
-
-		lFiles, err := dir.ReadDir(-1)
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
 		if err != nil {
-			logCh <- logger.Log(jobName, l.GetName()).Errorf("Failed to read files in directory '%s' with next error: %s", bakDir, err)
 			return err
 		}
+		backups = append(backups, NewBackupFile(path, fi.Size(), fi.ModTime()))
+		return nil
+	})
+	return GroupVolumes(backups), err
+}
 
-		for _, file := range lFiles {
-			fPath := path.Join(bakDir, file.Name())
-			filesMap[fPath] = &fileLinks{}
-			if file.Type()&fs.ModeSymlink != 0 {
-				link, err := os.Readlink(fPath)
-				if err != nil {
-					logCh <- logger.Log(jobName, l.GetName()).Errorf("Failed to read a symlink for file '%s': %s",
-						file, err)
-					errs = multierror.Append(errs, err)
-					continue
-				}
-				linkPath := filepath.Join(bakDir, link)
-
-				if fl, ok := filesMap[linkPath]; ok {
-					switch p {
-					case Weekly:
-						fl.wLink = fPath
-					case Daily:
-						fl.dLink = fPath
-					}
-					filesMap[linkPath] = fl
-				}
-			}
-		}
-
-		if l.Retention.UseCount {
-			sort.Slice(lFiles, func(i, j int) bool {
-				iInfo, _ := lFiles[i].Info()
-				jInfo, _ := lFiles[j].Info()
-				return iInfo.ModTime().Before(jInfo.ModTime())
-			})
-
-			if !safety {
-				retentionCount--
-			}
+func (l *Local) Stat(p string) (fs.FileInfo, error) {
+	return os.Lstat(p)
+}
 
-			if retentionCount <= len(lFiles) {
-				lFiles = lFiles[:len(lFiles)-retentionCount]
-			} else {
-				lFiles = lFiles[:0]
-			}
-		} else {
-			i := 0
-			for _, file := range lFiles {
-				fileInfo, _ := file.Info()
-				if fileInfo.ModTime().Location() != retentionDate.Location() {
-					retentionDate = retentionDate.In(fileInfo.ModTime().Location())
-				}
-
-				if fileInfo.ModTime().Before(retentionDate) {
-					lFiles[i] = file
-					i++
-				}
-			}
-			lFiles = lFiles[:i]
-		}
+func (l *Local) ReadDir(p string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
 
-		for _, file := range lFiles {
-			if file.IsDir() {
-				logCh <- logger.Log(jobName, l.GetName()).Warnf("`%s` is directory in %s. Please check and remove it.", file.Name(), bakDir)
-				continue
-			}
-			fPath := path.Join(bakDir, file.Name())
-			filesToDeleteMap[fPath] = filesMap[fPath]
+	fl := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
 		}
+		fl = append(fl, fi)
 	}
+	return fl, nil
+}
 
-	for file, fl := range filesToDeleteMap {
-		delFile := true
-		moved := false
-		if fl.wLink != "" {
-			if _, toDel := filesToDeleteMap[fl.wLink]; !toDel {
-				delFile = false
-				if err := moveFile(file, fl.wLink); err != nil {
-					logCh <- logger.Log(jobName, l.GetName()).Error(err)
-					errs = multierror.Append(errs, err)
-				} else {
-					logCh <- logger.Log(jobName, l.GetName()).Debugf("Successfully moved old backup to %s", fl.wLink)
-					moved = true
-				}
-				if _, toDel = filesToDeleteMap[fl.dLink]; !toDel {
-					if err := os.Remove(fl.dLink); err != nil {
-						logCh <- logger.Log(jobName, l.GetName()).Error(err)
-						errs = multierror.Append(errs, err)
-						break
-					}
-					relative, _ := filepath.Rel(filepath.Dir(fl.dLink), fl.wLink)
-					if err := os.Symlink(relative, fl.dLink); err != nil {
-						logCh <- logger.Log(jobName, l.GetName()).Error(err)
-						errs = multierror.Append(errs, err)
-					} else {
-						logCh <- logger.Log(jobName, l.GetName()).Debugf("Successfully changed symlink %s", fl.dLink)
-					}
-				}
-			}
-		}
-		if fl.dLink != "" && !moved {
-			if _, toDel := filesToDeleteMap[fl.dLink]; !toDel {
-				delFile = false
-				if err := moveFile(file, fl.dLink); err != nil {
-					logCh <- logger.Log(jobName, l.GetName()).Error(err)
-					errs = multierror.Append(errs, err)
-				} else {
-					logCh <- logger.Log(jobName, l.GetName()).Debugf("Successfully moved old backup to %s", fl.dLink)
-				}
-			}
-		}
+func (l *Local) Open(p string) (io.ReadCloser, error) {
+	return files.GetLimitedFileReader(p, l.rateLimit)
+}
 
-		if delFile {
-			if err := os.Remove(file); err != nil {
-				logCh <- logger.Log(jobName, l.GetName()).Errorf("Failed to delete file '%s' with next error: %s",
-					file, err)
-				errs = multierror.Append(errs, err)
-			} else {
-				logCh <- logger.Log(jobName, l.GetName()).Infof("Deleted old backup file '%s'", file)
-			}
-		}
+func (l *Local) Put(p string, r io.Reader, _ int64) error {
+	if err := os.MkdirAll(path.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+
+	dst, err := files.GetLimitedFileWriter(p, l.rateLimit)
+	if err != nil {
+		return err
 	}
 
-	return errs.ErrorOrNil()
+	if _, err = io.Copy(dst, r); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
 }
 
-func (l *Local) deleteIncBackup(logCh chan logger.LogRecord, jobName, ofsPart string, full bool) error {
-	var errs *multierror.Error
-
-	if full {
-		backupDir := path.Join(l.backupPath, ofsPart)
-		if err := os.RemoveAll(backupDir); err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				logCh <- logger.Log(jobName, l.GetName()).Debugf("Directory '%s' not exist. Skipping delete.", backupDir)
-				return nil
-			} else {
-				logCh <- logger.Log(jobName, l.GetName()).Errorf("Failed to delete '%s' with next error: %s", backupDir, err)
-				errs = multierror.Append(errs, err)
-			}
-		}
-	} else {
-		intMoy, _ := strconv.Atoi(misc.GetDateTimeNow("moy"))
-		lastMonth := intMoy - l.Months
+func (l *Local) Remove(p string) error {
+	return os.Remove(p)
+}
 
-		var year string
-		if lastMonth > 0 {
-			year = misc.GetDateTimeNow("year")
-		} else {
-			year = misc.GetDateTimeNow("previous_year")
-			lastMonth += 12
-		}
+func (l *Local) RemoveAll(p string) error {
+	return os.RemoveAll(p)
+}
 
-		backupDir := path.Join(l.backupPath, ofsPart, year)
+func (l *Local) Readlink(p string) (string, error) {
+	return os.Readlink(p)
+}
 
-		dirs, err := os.ReadDir(backupDir)
-		if err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				logCh <- logger.Log(jobName, l.GetName()).Debugf("Directory '%s' not exist. Skipping rotate.", backupDir)
-				return nil
-			} else {
-				logCh <- logger.Log(jobName, l.GetName()).Errorf("Failed to get access to directory '%s' with next error: %v", backupDir, err)
-				return err
-			}
-		}
-		rx := regexp.MustCompile(`month_\d\d`)
-		for _, dir := range dirs {
-			dirName := dir.Name()
-			if rx.MatchString(dirName) {
-				dirParts := strings.Split(dirName, "_")
-				dirMonth, _ := strconv.Atoi(dirParts[1])
-				if dirMonth < lastMonth {
-					if err = os.RemoveAll(path.Join(backupDir, dirName)); err != nil {
-						logCh <- logger.Log(jobName, l.GetName()).Errorf("Failed to delete '%s' in dir '%s' with next error: %s",
-							dirName, backupDir, err)
-						errs = multierror.Append(errs, err)
-					} else {
-						logCh <- logger.Log(jobName, l.GetName()).Infof("Deleted old backup '%s' in directory '%s'", dirName, backupDir)
-					}
-				}
-			}
-		}
-	}
+func (l *Local) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
 
-	return errs.ErrorOrNil()
+func (l *Local) FreeSpace(p string) (int64, error) {
+	return files.FreeSpace(p)
 }
 
-func (l *Local) GetFileReader(filePath string) (io.Reader, error) {
-	fp, err := filepath.EvalSymlinks(path.Join(l.backupPath, filePath))
-	if err != nil {
-		return nil, err
-	}
-	return files.GetLimitedFileReader(fp, l.rateLimit)
+func (l *Local) BackupPath() string {
+	return l.backupPath
 }
 
-func (l *Local) ListBackups(ofsPart string) ([]string, error) {
-	backups := make([]string, 0)
-	err := filepath.WalkDir(path.Join(l.backupPath, ofsPart), func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		backups = append(backups, path)
-		return nil
-	})
-	return backups, err
+func (l *Local) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
 }
 
 func (l *Local) Close() error {
@@ -414,13 +315,3 @@ func (l *Local) Clone() interfaces.Storage {
 func (l *Local) GetName() string {
 	return "local"
 }
-
-func moveFile(oldPath, newPath string) error {
-	if err := os.Remove(newPath); err != nil {
-		return fmt.Errorf("Failed to delete file '%s' with next error: %s ", oldPath, err)
-	}
-	if err := os.Rename(oldPath, newPath); err != nil {
-		return fmt.Errorf("Failed to move file '%s' with next error: %s ", oldPath, err)
-	}
-	return nil
-}
@@ -8,15 +8,10 @@ import (
 	"io/fs"
 	"os"
 	"path"
-	"regexp"
-	"sort"
-	"strconv"
-	"strings"
 
-	"github.com/hashicorp/go-multierror"
-	"github.com/sirupsen/logrus"
 	"github.com/vmware/go-nfs-client/nfs"
 	"github.com/vmware/go-nfs-client/nfs/rpc"
+	"github.com/vmware/go-nfs-client/nfs/xdr"
 
 	"github.com/nixys/nxs-backup/interfaces"
 	"github.com/nixys/nxs-backup/misc"
@@ -27,9 +22,13 @@ import (
 
 type NFS struct {
 	target        *nfs.Target
+	auth          rpc.Auth
+	opts          Opts
+	retry         RetryPolicy
 	name          string
 	backupPath    string
 	rateLimit     int64
+	volumeSize    int64
 	rotateEnabled bool
 	Retention
 }
@@ -41,257 +40,210 @@ type Opts struct {
 	GID    uint32
 }
 
-func Init(name string, params Opts, rl int64) (*NFS, error) {
-	mount, err := nfs.DialMount(params.Host)
+func Init(name string, params Opts, rl int64, retry RetryPolicy) (*NFS, error) {
+	n := &NFS{
+		name:      name,
+		opts:      params,
+		retry:     retry,
+		rateLimit: rl,
+	}
+
+	if err := n.connect(); err != nil {
+		return nil, fmt.Errorf("Failed to init '%s' NFS storage. %v ", name, err)
+	}
+
+	if _, err := n.target.ReadDirPlus("/"); err != nil {
+		return nil, fmt.Errorf("Failed to init '%s' NFS storage. Get files error: %v ", name, err)
+	}
+
+	return n, nil
+}
+
+func (n *NFS) connect() error {
+	mount, err := nfs.DialMount(n.opts.Host)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to init '%s' NFS storage. Dial MOUNT service error: %v ", name, err)
+		return fmt.Errorf("Dial MOUNT service error: %v", err)
 	}
 
 	hostname, err := os.Hostname()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	auth := rpc.NewAuthUnix(hostname, params.UID, params.GID)
+	auth := rpc.NewAuthUnix(hostname, n.opts.UID, n.opts.GID)
 
-	target, err := mount.Mount(params.Target, auth.Auth())
+	target, err := mount.Mount(n.opts.Target, auth.Auth())
 	if err != nil {
-		return nil, fmt.Errorf("Failed to init '%s' NFS storage. Mount volume error: %v ", name, err)
+		return fmt.Errorf("Mount volume error: %v", err)
 	}
 
 	if _, err = target.FSInfo(); err != nil {
-		return nil, fmt.Errorf("Failed to init '%s' NFS storage. Get target status error: %v ", name, err)
+		_ = target.Close()
+		return fmt.Errorf("Get target status error: %v", err)
 	}
 
-	if _, err = target.ReadDirPlus("/"); err != nil {
-		return nil, fmt.Errorf("Failed to init '%s' NFS storage. Get files error: %v ", name, err)
-	}
+	n.target = target
+	n.auth = auth.Auth()
+	return nil
+}
 
-	return &NFS{
-		name:      name,
-		target:    target,
-		rateLimit: rl,
-	}, nil
+// reconnect drops the current mount and mounts the target again
+func (n *NFS) reconnect() error {
+	if n.target != nil {
+		_ = n.target.Close()
+	}
+	return n.connect()
 }
 
 func (n *NFS) Configure(p Params) {
 	n.backupPath = p.BackupPath
 	n.rateLimit = p.RateLimit
+	n.volumeSize = p.VolumeSize
 	n.rotateEnabled = p.RotateEnabled
 	n.Retention = p.Retention
 }
 
 func (n *NFS) IsLocal() int { return 0 }
 
+func (n *NFS) VolumeSize() int64 { return n.volumeSize }
+
 func (n *NFS) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFile, ofs, bakType string) error {
+	deliveryLog := logger.Log(jobName, n.name).WithTarget(ofs).WithPhase(logger.PhaseDeliver)
+
 	var bakRemPaths, mtdRemPaths []string
 
 	if bakType == string(misc.IncFiles) {
 		bakRemPaths, mtdRemPaths = GetIncBackupDstList(tmpBackupFile, ofs, n.backupPath)
 	} else {
-		bakRemPaths = GetDescBackupDstList(tmpBackupFile, ofs, n.backupPath, n.Retention)
+		bakRemPaths = GetDescBackupDstList(tmpBackupFile, ofs, n.backupPath, n.Retention.WithLastDaily(n, path.Join(n.backupPath, ofs)))
 	}
 
 	if len(mtdRemPaths) > 0 {
 		for _, dstPath := range mtdRemPaths {
-			if err := n.copy(logCh, jobName, dstPath, tmpBackupFile+".inc"); err != nil {
+			if err := n.copy(logCh, deliveryLog, dstPath, tmpBackupFile+".inc"); err != nil {
 				return err
 			}
 		}
 	}
 
+	volumes, err := SplitVolumes(tmpBackupFile, n.volumeSize)
+	if err != nil {
+		logCh <- deliveryLog.Errorf("Unable to split backup into volumes: %s", err)
+		return err
+	}
+
 	for _, dstPath := range bakRemPaths {
-		if err := n.copy(logCh, jobName, dstPath, tmpBackupFile); err != nil {
-			return err
+		for _, vol := range volumes {
+			if err = n.copy(logCh, deliveryLog, VolumePath(dstPath, vol), vol); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-func (n *NFS) copy(logCh chan logger.LogRecord, jobName, dst, src string) error {
-	srcFile, err := files.GetLimitedFileReader(src, n.rateLimit)
+func (n *NFS) copy(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, dst, src string) error {
+	srcStat, err := os.Stat(src)
 	if err != nil {
-		logCh <- logger.LogRecord{
-			Level:       logrus.ErrorLevel,
-			StorageName: n.name,
-			JobName:     jobName,
-			Message:     fmt.Sprintf("Unable to open file: '%s'", err),
-		}
+		logCh <- deliveryLog.Errorf("Unable to open file: '%s'", err)
 		return err
 	}
-	defer func() { _ = srcFile.Close() }()
 
-	// Make remote directories
-	dstDir := path.Dir(dst)
-	err = n.mkDir(dstDir)
+	partPath := PartialPath(dst)
+	err = Retry(logCh, deliveryLog, n.retry, n.reconnect, func(attempt int) error {
+		return n.upload(logCh, deliveryLog, partPath, src, attempt > 1)
+	})
+	if err == nil {
+		err = Retry(logCh, deliveryLog, n.retry, n.reconnect, func(int) error {
+			return CommitPartial(n, partPath, dst, srcStat.Size())
+		})
+	}
 	if err != nil {
-		logCh <- logger.LogRecord{
-			Level:       logrus.ErrorLevel,
-			StorageName: n.name,
-			JobName:     jobName,
-			Message:     fmt.Sprintf("Unable to create remote directory '%s': '%s'", dstDir, err),
-		}
+		logCh <- deliveryLog.Errorf("Unable to make copy '%s': '%s'", dst, err)
 		return err
 	}
+	logCh <- deliveryLog.Infof("Successfully copied temp backup to %s", dst)
 
-	destination, err := n.target.OpenFile(dst, 0666)
+	return nil
+}
+
+// upload writes the file, the interrupted upload is resumed from the size of the uploaded part
+func (n *NFS) upload(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, dst, src string, resume bool) error {
+	srcFile, err := files.GetLimitedFileReader(src, n.rateLimit)
 	if err != nil {
-		logCh <- logger.Log(jobName, n.name).Errorf("Unable to create destination file '%s': '%s'", dstDir, err)
 		return err
 	}
-	defer func() { _ = destination.Close() }()
+	defer func() { _ = srcFile.Close() }()
 
-	_, err = io.Copy(destination, srcFile)
+	srcStat, err := os.Stat(src)
 	if err != nil {
-		logCh <- logger.Log(jobName, n.name).Errorf("Unable to make copy '%s': '%s'", dstDir, err)
 		return err
 	}
-	logCh <- logger.Log(jobName, n.name).Infof("Successfully copied temp backup to %s", dst)
 
-	return nil
-}
-
-func (n *NFS) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) error {
-	if !n.rotateEnabled {
-		logCh <- logger.Log(job.GetName(), n.name).Debugf("Backup rotate skipped by config.")
-		return nil
+	// Make remote directories
+	dstDir := path.Dir(dst)
+	if err = n.mkDir(dstDir); err != nil {
+		return fmt.Errorf("unable to create remote directory '%s': %w", dstDir, err)
 	}
 
-	if job.GetType() == misc.IncFiles {
-		return n.deleteIncBackup(logCh, job.GetName(), ofsPart, full)
-	} else {
-		return n.deleteDescBackup(logCh, job.GetName(), ofsPart, job.IsBackupSafety())
+	var offset int64
+	if resume {
+		if fi, _, err := n.target.Lookup(dst); err == nil && fi.Size() <= srcStat.Size() {
+			offset = fi.Size()
+		}
+	}
+	if offset == 0 {
+		// the opened file isn't truncated
+		_ = n.target.Remove(dst)
 	}
-}
-
-func (n *NFS) deleteDescBackup(logCh chan logger.LogRecord, jobName, ofsPart string, safety bool) error {
-	var errs *multierror.Error
 
-	for _, p := range RetentionPeriodsList {
-		retentionCount, retentionDate := GetRetention(p, n.Retention)
-		if retentionCount == 0 && retentionDate.IsZero() {
-			continue
-		}
+	destination, err := n.target.OpenFile(dst, 0666)
+	if err != nil {
+		return fmt.Errorf("unable to create destination file: %w", err)
+	}
+	defer func() { _ = destination.Close() }()
 
-		bakDir := path.Join(n.backupPath, ofsPart, p.String())
-		nfsFilesPlus, err := n.target.ReadDirPlus(bakDir)
-		if err != nil {
-			if os.IsNotExist(err) {
-				logCh <- logger.Log(jobName, n.name).Debugf("Directory '%s' not exist. Skipping rotate.", bakDir)
-				continue
-			}
-			logCh <- logger.Log(jobName, n.name).Errorf("Failed to read files in remote directory '%s' with next error: %s", bakDir, err)
+	if offset > 0 {
+		logCh <- deliveryLog.Infof("Resuming upload of '%s' from %d bytes", dst, offset)
+		if _, err = destination.Seek(offset, io.SeekStart); err != nil {
 			return err
 		}
-
-		nfsFiles := make([]fs.FileInfo, 0, len(nfsFilesPlus))
-		for _, file := range nfsFilesPlus {
-			if file.Name() == ".." || file.Name() == "." {
-				continue
-			}
-			f, _, err := n.target.Lookup(path.Join(bakDir, file.Name()))
-			if err != nil {
-				logCh <- logger.Log(jobName, n.name).Errorf("Failed to read file '%s' with next error: %s", file.Name(), err)
-				return err
-			}
-			nfsFiles = append(nfsFiles, f)
-		}
-
-		if n.Retention.UseCount {
-			sort.Slice(nfsFiles, func(i, j int) bool {
-				return nfsFiles[i].ModTime().Before(nfsFiles[j].ModTime())
-			})
-
-			if !safety {
-				retentionCount--
-			}
-			if retentionCount <= len(nfsFiles) {
-				nfsFiles = nfsFiles[:len(nfsFiles)-retentionCount]
-			} else {
-				nfsFiles = nfsFiles[:0]
-			}
-		} else {
-			i := 0
-			for _, file := range nfsFiles {
-				if file.ModTime().Location() != retentionDate.Location() {
-					retentionDate = retentionDate.In(file.ModTime().Location())
-				}
-
-				if file.ModTime().Before(retentionDate) {
-					nfsFiles[i] = file
-					i++
-				}
-			}
-			nfsFiles = nfsFiles[:i]
-		}
-
-		for _, file := range nfsFiles {
-			err = n.target.Remove(path.Join(bakDir, file.Name()))
-			if err != nil {
-				logCh <- logger.Log(jobName, n.name).Errorf("Failed to delete file '%s' in remote directory '%s' with next error: %s",
-					file.Name(), bakDir, err)
-				errs = multierror.Append(errs, err)
-			} else {
-				logCh <- logger.Log(jobName, n.name).Infof("Deleted old backup file '%s' in remote directory '%s'", file.Name(), bakDir)
-			}
+		if _, err = srcFile.Seek(offset, io.SeekStart); err != nil {
+			return err
 		}
 	}
 
-	return errs
+	if _, err = io.Copy(destination, srcFile); err != nil {
+		return err
+	}
+	return destination.Close()
 }
 
-func (n *NFS) deleteIncBackup(logCh chan logger.LogRecord, jobName, ofsPart string, full bool) error {
-	var errs *multierror.Error
-
-	if full {
-		backupDir := path.Join(n.backupPath, ofsPart)
-
-		err := n.target.RemoveAll(backupDir)
-		if err != nil {
-			logCh <- logger.Log(jobName, n.name).Errorf("Failed to delete '%s' with next error: %s", backupDir, err)
-			errs = multierror.Append(errs, err)
-		}
-	} else {
-		intMoy, _ := strconv.Atoi(misc.GetDateTimeNow("moy"))
-		lastMonth := intMoy - n.Months
-
-		var year string
-		if lastMonth > 0 {
-			year = misc.GetDateTimeNow("year")
-		} else {
-			year = misc.GetDateTimeNow("previous_year")
-			lastMonth += 12
-		}
+func (n *NFS) GetDeliveryPlan(tmpBackupFile, ofs, bakType string) (*DeliveryPlan, error) {
+	return GetCopiesDeliveryPlan(n.GetName(), tmpBackupFile, ofs, bakType, n.backupPath, n.Retention.WithLastDaily(n, path.Join(n.backupPath, ofs)), n.volumeSize), nil
+}
 
-		backupDir := path.Join(n.backupPath, ofsPart, year)
+func (n *NFS) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) (RotationStats, error) {
+	return DeleteOldBackups(logCh, n, n.rotationOpts(ofsPart, job, full))
+}
 
-		dirs, err := n.target.ReadDirPlus(backupDir)
-		if err != nil {
-			logCh <- logger.Log(jobName, n.name).Errorf("Failed to get access to directory '%s' with next error: %v", backupDir, err)
-			return err
-		}
+func (n *NFS) GetRotationPlan(ofsPart string, job interfaces.Job, full bool) (*RotationPlan, error) {
+	return PlanRotation(n, n.rotationOpts(ofsPart, job, full))
+}
 
-		for _, dir := range dirs {
-			dirName := dir.Name()
-			rx := regexp.MustCompile(`month_\d\d`)
-			if rx.MatchString(dirName) {
-				dirParts := strings.Split(dirName, "_")
-				dirMonth, _ := strconv.Atoi(dirParts[1])
-				if dirMonth < lastMonth {
-					if err = n.target.RemoveAll(path.Join(backupDir, dirName)); err != nil {
-						logCh <- logger.Log(jobName, n.name).Errorf("Failed to delete '%s' in dir '%s' with next error: %s",
-							dir.Name(), backupDir, err)
-						errs = multierror.Append(errs, err)
-					} else {
-						logCh <- logger.Log(jobName, n.name).Infof("Deleted old backup '%s' in directory '%s'", dir.Name(), backupDir)
-					}
-				}
-			}
-		}
+func (n *NFS) rotationOpts(ofsPart string, job interfaces.Job, full bool) RotationOpts {
+	return RotationOpts{
+		JobName:     job.GetName(),
+		StorageName: n.GetName(),
+		BackupPath:  n.backupPath,
+		Ofs:         ofsPart,
+		Enabled:     n.rotateEnabled,
+		Retention:   n.Retention,
+		IncBackup:   job.GetType() == misc.IncFiles,
+		Full:        full,
+		Safety:      job.IsBackupSafety(),
 	}
-
-	return errs.ErrorOrNil()
 }
 
 func (n *NFS) mkDir(dstPath string) error {
@@ -324,6 +276,9 @@ func (n *NFS) mkDir(dstPath string) error {
 }
 
 func (n *NFS) GetFileReader(ofsPath string) (io.Reader, error) {
+	if r, err := ReadVolumes(n, path.Join(n.backupPath, ofsPath)); !errors.Is(err, fs.ErrNotExist) {
+		return r, err
+	}
 
 	file, err := n.target.Open(path.Join(n.backupPath, ofsPath))
 	if err != nil {
@@ -340,14 +295,19 @@ func (n *NFS) GetFileReader(ofsPath string) (io.Reader, error) {
 	return bytes.NewReader(buf), err
 }
 
-func (n *NFS) ListBackups(fPath string) ([]string, error) {
+func (n *NFS) ListBackups(fPath string) ([]BackupFile, error) {
 	bPath := path.Join(n.backupPath, fPath)
 	nfsFiles, err := n.listFiles(bPath)
 	if err != nil {
 		return nil, err
 	}
 
-	return n.listPaths(bPath, nfsFiles)
+	list, err := n.listPaths(bPath, nfsFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return GroupVolumes(list), nil
 }
 
 func (n *NFS) listFiles(dstPath string) ([]*nfs.EntryPlus, error) {
@@ -355,7 +315,7 @@ func (n *NFS) listFiles(dstPath string) ([]*nfs.EntryPlus, error) {
 	nfsEntries, err := n.target.ReadDirPlus(dstPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			err = fmt.Errorf("%s: %v", dstPath, err)
+			err = fmt.Errorf("%s: %w", dstPath, err)
 		}
 		return nil, err
 	}
@@ -377,12 +337,12 @@ func (n *NFS) listFiles(dstPath string) ([]*nfs.EntryPlus, error) {
 	return nfsFiles, nil
 }
 
-func (n *NFS) listPaths(base string, fList []*nfs.EntryPlus) ([]string, error) {
-	var paths []string
+func (n *NFS) listPaths(base string, fList []*nfs.EntryPlus) ([]BackupFile, error) {
+	var paths []BackupFile
 
 	for _, file := range fList {
 		if !file.IsDir() {
-			paths = append(paths, path.Join(base, file.Name()))
+			paths = append(paths, NewBackupFile(path.Join(base, file.Name()), file.Size(), file.ModTime()))
 		} else {
 			subDir := path.Join(base, file.Name())
 			subDirFiles, err := n.listFiles(subDir)
@@ -400,6 +360,95 @@ func (n *NFS) listPaths(base string, fList []*nfs.EntryPlus) ([]string, error) {
 	return paths, nil
 }
 
+func (n *NFS) Stat(p string) (fs.FileInfo, error) {
+	fi, _, err := n.target.Lookup(p)
+	return fi, err
+}
+
+func (n *NFS) ReadDir(p string) ([]fs.FileInfo, error) {
+	entries, err := n.listFiles(p)
+	if err != nil {
+		return nil, err
+	}
+
+	fl := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		fl = append(fl, e)
+	}
+	return fl, nil
+}
+
+func (n *NFS) Open(p string) (io.ReadCloser, error) {
+	return n.target.Open(p)
+}
+
+func (n *NFS) Put(p string, r io.Reader, _ int64) error {
+	if err := n.mkDir(path.Dir(p)); err != nil {
+		return err
+	}
+
+	dst, err := n.target.OpenFile(p, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(dst, files.GetLimitedReader(r, n.rateLimit)); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// nfsProc3Rename is the RENAME procedure of NFSv3 (RFC 1813), it isn't implemented by the client library
+const nfsProc3Rename = 14
+
+func (n *NFS) Rename(oldpath, newpath string) error {
+	_, fromFH, err := n.target.Lookup(path.Dir(oldpath))
+	if err != nil {
+		return err
+	}
+	_, toFH, err := n.target.Lookup(path.Dir(newpath))
+	if err != nil {
+		return err
+	}
+
+	type RenameArgs struct {
+		rpc.Header
+		From nfs.Diropargs3
+		To   nfs.Diropargs3
+	}
+
+	res, err := n.target.Call(&RenameArgs{
+		Header: rpc.Header{
+			Rpcvers: 2,
+			Prog:    nfs.Nfs3Prog,
+			Vers:    nfs.Nfs3Vers,
+			Proc:    nfsProc3Rename,
+			Cred:    n.auth,
+			Verf:    rpc.AuthNull,
+		},
+		From: nfs.Diropargs3{FH: fromFH, Filename: path.Base(oldpath)},
+		To:   nfs.Diropargs3{FH: toFH, Filename: path.Base(newpath)},
+	})
+	if err != nil {
+		return err
+	}
+
+	status, err := xdr.ReadUint32(res)
+	if err != nil {
+		return err
+	}
+	return nfs.NFS3Error(status)
+}
+
+func (n *NFS) Remove(p string) error {
+	return n.target.Remove(p)
+}
+
+func (n *NFS) RemoveAll(p string) error {
+	return n.target.RemoveAll(p)
+}
+
 func (n *NFS) Close() error {
 	return n.target.Close()
 }
@@ -409,6 +458,10 @@ func (n *NFS) Clone() interfaces.Storage {
 	return &cl
 }
 
+func (n *NFS) BackupPath() string {
+	return n.backupPath
+}
+
 func (n *NFS) GetName() string {
 	return n.name
 }
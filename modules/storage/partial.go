@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// PartialSuffix is added to the names of files being uploaded, the files get their names after the complete upload
+const PartialSuffix = ".partial"
+
+// Renamer is implemented by storages that are able to rename files. Backups are uploaded to such storages
+// with partial names, so an interrupted upload never looks like a valid backup
+type Renamer interface {
+	Rename(oldpath, newpath string) error
+}
+
+func PartialPath(p string) string {
+	return p + PartialSuffix
+}
+
+func IsPartial(p string) bool {
+	return strings.HasSuffix(p, PartialSuffix)
+}
+
+// DropPartials returns the list without the files of unfinished uploads
+func DropPartials(list []BackupFile) []BackupFile {
+	res := list[:0]
+	for _, f := range list {
+		if !IsPartial(f.Path) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// CommitPartial checks the size of the uploaded partial file and renames it to the destination path
+func CommitPartial(d Driver, partPath, dstPath string, size int64) error {
+	r, ok := d.(Renamer)
+	if !ok {
+		return fmt.Errorf("storage doesn't support renaming of files")
+	}
+
+	fi, err := d.Stat(partPath)
+	if err != nil {
+		return fmt.Errorf("unable to check uploaded file '%s': %w", partPath, err)
+	}
+	if fi.Size() != size {
+		_ = d.Remove(partPath)
+		return fmt.Errorf("size of uploaded file '%s' is %d bytes, expected %d", partPath, fi.Size(), size)
+	}
+
+	// the backup with the same name is replaced
+	_ = d.Remove(dstPath)
+	if err = r.Rename(partPath, dstPath); err != nil {
+		return fmt.Errorf("unable to rename uploaded file '%s': %w", partPath, err)
+	}
+	return nil
+}
+
+// findPartials returns the partial files left in the directory and its subdirectories by the interrupted uploads
+func findPartials(d Driver, dir string) ([]string, error) {
+	entries, err := d.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var partials []string
+	for _, e := range entries {
+		if e.Name() == "." || e.Name() == ".." || e.Mode()&fs.ModeSymlink != 0 {
+			continue
+		}
+		p := path.Join(dir, e.Name())
+		if e.IsDir() {
+			sub, err := findPartials(d, p)
+			if err != nil {
+				return partials, err
+			}
+			partials = append(partials, sub...)
+		} else if IsPartial(e.Name()) {
+			partials = append(partials, p)
+		}
+	}
+	return partials, nil
+}
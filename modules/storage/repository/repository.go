@@ -0,0 +1,693 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/nixys/nxs-backup/interfaces"
+	"github.com/nixys/nxs-backup/misc"
+	"github.com/nixys/nxs-backup/modules/backend/chunker"
+	"github.com/nixys/nxs-backup/modules/logger"
+	. "github.com/nixys/nxs-backup/modules/storage"
+)
+
+const (
+	chunksDir    = "chunks"
+	snapshotsDir = "snapshots"
+	locksDir     = "locks"
+	snapshotExt  = ".json"
+	lockExt      = ".lock"
+	pruneLockExt = ".prune"
+
+	// lockTTL limits how long the lock left by an interrupted process blocks others
+	lockTTL = 30 * time.Minute
+	// lockRefresh is how often the running process renews its lock
+	lockRefresh = 5 * time.Minute
+	// lockWait is the interval a delivery checks if the prune has finished
+	lockWait = 10 * time.Second
+	// pruneGrace protects the chunks uploaded right before the prune started
+	pruneGrace = time.Hour
+)
+
+// Repository stores backups as deduplicated content-defined chunks on top of any storage.
+// Layout inside the backup path:
+//
+//	chunks/<first two hex digits>/<sha256 of chunk>
+//	snapshots/<ofs>/<backup file name>.json
+//	locks/<id>.lock
+//	locks/<id>.prune
+//
+// Each delivery holds a lock while it uploads chunks and the snapshot, the prune holds an exclusive one.
+// Both save their lock first and check the locks of the other side afterwards, so at least one of them
+// sees the other: the prune is skipped while any delivery runs and a delivery waits for the prune to finish.
+// Chunks of snapshots not saved yet are never deleted this way.
+type Repository struct {
+	storage       interfaces.Storage
+	driver        Driver
+	avgChunkSize  int
+	backupPath    string
+	rotateEnabled bool
+	Retention
+}
+
+type Opts struct {
+	AvgChunkSize int
+}
+
+type snapshot struct {
+	Name    string    `json:"name"`
+	Time    time.Time `json:"time"`
+	Size    int64     `json:"size"`
+	Periods []string  `json:"periods"`
+	Chunks  []string  `json:"chunks"`
+}
+
+func Init(st interfaces.Storage, opts Opts) (*Repository, error) {
+	d, ok := st.(Driver)
+	if !ok {
+		return nil, fmt.Errorf("Storage '%s' doesn't support repository format ", st.GetName())
+	}
+
+	if opts.AvgChunkSize <= 0 {
+		opts.AvgChunkSize = chunker.DefaultAvgSize
+	}
+
+	return &Repository{
+		storage:      st,
+		driver:       d,
+		avgChunkSize: opts.AvgChunkSize,
+	}, nil
+}
+
+func (r *Repository) Configure(p Params) {
+	r.storage.Configure(p)
+	r.backupPath = p.BackupPath
+	r.rotateEnabled = p.RotateEnabled
+	r.Retention = p.Retention
+}
+
+func (r *Repository) IsLocal() int { return r.storage.IsLocal() }
+
+func (r *Repository) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFile, ofs, bakType string) error {
+	deliveryLog := logger.Log(jobName, r.GetName()).WithTarget(ofs).WithPhase(logger.PhaseDeliver)
+
+	if bakType == string(misc.IncFiles) {
+		return fmt.Errorf("Repository format doesn't support incremental backups ")
+	}
+
+	periods := GetDescBackupPeriods(r.retention(ofs))
+	if len(periods) == 0 {
+		logCh <- deliveryLog.Debugf("No retention periods for the backup. Skipping delivery.")
+		return nil
+	}
+
+	if strings.HasSuffix(tmpBackupFile, ".gz") {
+		logCh <- deliveryLog.Warnf("Backup '%s' is compressed, deduplication will be inefficient. Consider to disable gzip for the job.", path.Base(tmpBackupFile))
+	}
+
+	src, err := os.Open(tmpBackupFile)
+	if err != nil {
+		logCh <- deliveryLog.Errorf("Unable to open tmp backup: '%s'", err)
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	lk, err := r.lockShared(logCh, deliveryLog, jobName)
+	if err != nil {
+		logCh <- deliveryLog.Errorf("Failed to lock repository: '%s'", err)
+		return err
+	}
+	defer func() {
+		if err := lk.unlock(); err != nil {
+			logCh <- deliveryLog.Warnf("Failed to unlock repository: '%s'", err)
+		}
+	}()
+
+	snap := snapshot{
+		Name: path.Base(tmpBackupFile),
+		Time: time.Now(),
+	}
+	for _, p := range periods {
+		snap.Periods = append(snap.Periods, p.String())
+	}
+
+	var newChunks, newBytes int64
+	known := make(map[string]struct{})
+	ch := chunker.New(src, r.avgChunkSize)
+	for {
+		data, err := ch.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logCh <- deliveryLog.Errorf("Failed to read tmp backup: '%s'", err)
+			return err
+		}
+
+		if err = lk.refresh(); err != nil {
+			logCh <- deliveryLog.Errorf("Failed to refresh repository lock: '%s'", err)
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		id := hex.EncodeToString(sum[:])
+		snap.Chunks = append(snap.Chunks, id)
+		snap.Size += int64(len(data))
+
+		if _, ok := known[id]; ok {
+			continue
+		}
+		known[id] = struct{}{}
+
+		chunkPath := r.chunkPath(id)
+		if _, err = r.driver.Stat(chunkPath); err == nil {
+			continue
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			logCh <- deliveryLog.Errorf("Failed to check chunk '%s': '%s'", id, err)
+			return err
+		}
+
+		if err = r.driver.Put(chunkPath, bytes.NewReader(data), int64(len(data))); err != nil {
+			logCh <- deliveryLog.Errorf("Failed to upload chunk '%s': '%s'", id, err)
+			return err
+		}
+		newChunks++
+		newBytes += int64(len(data))
+	}
+
+	buf, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	snapPath := path.Join(r.backupPath, snapshotsDir, ofs, snap.Name+snapshotExt)
+	if err = r.driver.Put(snapPath, bytes.NewReader(buf), int64(len(buf))); err != nil {
+		logCh <- deliveryLog.Errorf("Failed to upload snapshot '%s': '%s'", snapPath, err)
+		return err
+	}
+
+	logCh <- deliveryLog.Infof(
+		"Successfully saved snapshot %s: %d chunks, %d new (%s of %s)",
+		snapPath, len(snap.Chunks), newChunks, units.BytesSize(float64(newBytes)), units.BytesSize(float64(snap.Size)),
+	)
+
+	return nil
+}
+
+// GetDeliveryPlan returns the snapshot to be saved, chunks are known only after the backup is made
+func (r *Repository) GetDeliveryPlan(tmpBackupFile, ofs, bakType string) (*DeliveryPlan, error) {
+	if bakType == string(misc.IncFiles) {
+		return nil, fmt.Errorf("Repository format doesn't support incremental backups ")
+	}
+
+	p := &DeliveryPlan{StorageName: r.GetName()}
+	if len(GetDescBackupPeriods(r.retention(ofs))) > 0 {
+		p.Files = append(p.Files, path.Join(r.backupPath, snapshotsDir, ofs, path.Base(tmpBackupFile)+snapshotExt))
+	}
+	return p, nil
+}
+
+// DeleteOldBackups forgets snapshots that are outdated in all their retention periods
+// and prunes chunks which are no longer referenced by any snapshot
+func (r *Repository) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) (RotationStats, error) {
+	if !r.rotateEnabled {
+		logCh <- logger.Log(job.GetName(), r.GetName()).WithTarget(ofsPart).WithPhase(logger.PhaseRotate).Debugf("Backup rotate skipped by config.")
+		return RotationStats{}, nil
+	}
+
+	plan, err := r.GetRotationPlan(ofsPart, job, full)
+	if err != nil {
+		logCh <- logger.Log(job.GetName(), r.GetName()).WithTarget(ofsPart).WithPhase(logger.PhaseRotate).Errorf("Failed to read snapshots with next error: %s", err)
+		return RotationStats{}, err
+	}
+	if plan.Len() == 0 {
+		return RotationStats{}, nil
+	}
+
+	var errs *multierror.Error
+	stats, err := plan.Apply(logCh, r.driver)
+	if err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err = r.prune(logCh, job.GetName()); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	return stats, errs.ErrorOrNil()
+}
+
+// GetRotationPlan returns snapshots to be forgotten. A snapshot is forgotten only when none of its periods
+// keeps it, a disabled period keeps nothing. Unreferenced chunks are pruned afterwards.
+func (r *Repository) GetRotationPlan(ofsPart string, job interfaces.Job, _ bool) (*RotationPlan, error) {
+	plan := &RotationPlan{
+		JobName:     job.GetName(),
+		StorageName: r.GetName(),
+		Ofs:         ofsPart,
+	}
+	if !r.rotateEnabled {
+		return plan, nil
+	}
+
+	snapDir := path.Join(r.backupPath, snapshotsDir, ofsPart)
+	snaps, err := r.readSnapshots(snapDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return plan, nil
+		}
+		return plan, err
+	}
+
+	// the backup made after the rotation takes a place in its periods
+	newPeriods := GetDescBackupPeriods(withLastDaily(r.Retention, snaps))
+
+	kept := make(map[string]bool)
+	for _, p := range RetentionPeriodsList {
+		// the snapshots of the longer periods are kept till their own date, not only on the rotation day
+		retentionCount, retentionDate := GetRetentionLimits(p, r.Retention)
+		if retentionCount == 0 {
+			continue
+		}
+
+		var pSnaps []string
+		for name, s := range snaps {
+			if misc.Contains(s.Periods, p.String()) {
+				pSnaps = append(pSnaps, name)
+			}
+		}
+		sort.Slice(pSnaps, func(i, j int) bool {
+			return snaps[pSnaps[i]].Time.Before(snaps[pSnaps[j]].Time)
+		})
+
+		if r.UseCount {
+			if !job.IsBackupSafety() && slices.Contains(newPeriods, p) {
+				retentionCount--
+			}
+			if retentionCount < len(pSnaps) {
+				pSnaps = pSnaps[len(pSnaps)-max(retentionCount, 0):]
+			}
+		} else {
+			i := 0
+			for _, name := range pSnaps {
+				if !snaps[name].Time.Before(retentionDate) {
+					pSnaps[i] = name
+					i++
+				}
+			}
+			pSnaps = pSnaps[:i]
+		}
+
+		for _, name := range pSnaps {
+			kept[name] = true
+		}
+	}
+
+	for name := range snaps {
+		if !kept[name] {
+			plan.Files = append(plan.Files, path.Join(snapDir, name))
+		}
+	}
+	sort.Strings(plan.Files)
+
+	return plan, nil
+}
+
+// prune deletes chunks that aren't referenced by any snapshot in the repository
+func (r *Repository) prune(logCh chan logger.LogRecord, jobName string) error {
+	var errs *multierror.Error
+
+	pruneLog := logger.Log(jobName, r.GetName()).WithPhase(logger.PhaseRotate)
+
+	lk, err := r.newLock(jobName, pruneLockExt)
+	if err != nil {
+		logCh <- pruneLog.Errorf("Failed to lock repository, prune skipped: %s", err)
+		return err
+	}
+	defer func() {
+		if err := lk.unlock(); err != nil {
+			logCh <- pruneLog.Warnf("Failed to unlock repository: '%s'", err)
+		}
+	}()
+
+	// the lock is saved before the check, so a delivery started after it waits for the prune
+	locks, err := r.activeLocks(lk.path)
+	if err != nil {
+		logCh <- pruneLog.Errorf("Failed to read repository locks, prune skipped: %s", err)
+		return err
+	}
+	if locks > 0 {
+		logCh <- pruneLog.Infof("Prune skipped, the repository is used by %d other processes", locks)
+		return nil
+	}
+
+	referenced := make(map[string]struct{})
+	if err := r.walkSnapshots(path.Join(r.backupPath, snapshotsDir), func(s snapshot) {
+		for _, id := range s.Chunks {
+			referenced[id] = struct{}{}
+		}
+	}); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logCh <- pruneLog.Errorf("Failed to collect referenced chunks, prune skipped: %s", err)
+		return err
+	}
+
+	chunksPath := path.Join(r.backupPath, chunksDir)
+	dirs, err := r.driver.ReadDir(chunksPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		logCh <- pruneLog.Errorf("Failed to read chunks directory '%s' with next error: %s", chunksPath, err)
+		return err
+	}
+
+	var deleted, freed int64
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		dirPath := path.Join(chunksPath, dir.Name())
+		chunks, err := r.driver.ReadDir(dirPath)
+		if err != nil {
+			logCh <- pruneLog.Errorf("Failed to read chunks directory '%s' with next error: %s", dirPath, err)
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		if err = lk.refresh(); err != nil {
+			logCh <- pruneLog.Errorf("Failed to refresh repository lock, prune stopped: %s", err)
+			return multierror.Append(errs, err)
+		}
+		for _, c := range chunks {
+			if _, ok := referenced[c.Name()]; ok || c.IsDir() || time.Since(c.ModTime()) < pruneGrace {
+				continue
+			}
+			if err = r.driver.Remove(path.Join(dirPath, c.Name())); err != nil {
+				logCh <- pruneLog.Errorf("Failed to delete chunk '%s' with next error: %s", c.Name(), err)
+				errs = multierror.Append(errs, err)
+				continue
+			}
+			deleted++
+			freed += c.Size()
+		}
+	}
+
+	logCh <- pruneLog.WithBytes(freed).Infof("Pruned %d unreferenced chunks (%s)", deleted, units.BytesSize(float64(freed)))
+
+	return errs.ErrorOrNil()
+}
+
+// retention returns the retention with the time of the last daily snapshot of the target
+func (r *Repository) retention(ofs string) Retention {
+	if r.Hours == 0 {
+		return r.Retention
+	}
+	snaps, err := r.readSnapshots(path.Join(r.backupPath, snapshotsDir, ofs))
+	if err != nil {
+		return r.Retention
+	}
+	return withLastDaily(r.Retention, snaps)
+}
+
+func withLastDaily(rt Retention, snaps map[string]snapshot) Retention {
+	for _, s := range snaps {
+		if slices.Contains(s.Periods, Daily.String()) && s.Time.After(rt.LastDaily) {
+			rt.LastDaily = s.Time
+		}
+	}
+	return rt
+}
+
+type repoLock struct {
+	driver    Driver
+	path      string
+	buf       []byte
+	refreshed time.Time
+}
+
+// newLock saves the lock of the process and returns it
+func (r *Repository) newLock(jobName, ext string) (*repoLock, error) {
+	host, _ := os.Hostname()
+	lk := &repoLock{
+		driver: r.driver,
+		path:   path.Join(r.backupPath, locksDir, uuid.NewString()+ext),
+		buf:    []byte(fmt.Sprintf("%s %s %d %s\n", host, jobName, os.Getpid(), time.Now().Format(time.RFC3339))),
+	}
+	return lk, lk.save()
+}
+
+func (l *repoLock) save() error {
+	l.refreshed = time.Now()
+	return l.driver.Put(l.path, bytes.NewReader(l.buf), int64(len(l.buf)))
+}
+
+// refresh renews the lock, so it isn't treated as stale while the process runs
+func (l *repoLock) refresh() error {
+	if time.Since(l.refreshed) < lockRefresh {
+		return nil
+	}
+	return l.save()
+}
+
+func (l *repoLock) unlock() error {
+	return l.driver.Remove(l.path)
+}
+
+// lockShared saves the lock of the delivery, waiting while the repository is pruned
+func (r *Repository) lockShared(logCh chan logger.LogRecord, log logger.LogRecord, jobName string) (*repoLock, error) {
+	deadline := time.Now().Add(lockTTL)
+	for {
+		lk, err := r.newLock(jobName, lockExt)
+		if err != nil {
+			return nil, err
+		}
+		prunes, err := r.countLocks(pruneLockExt, lk.path)
+		if err == nil && prunes == 0 {
+			return lk, nil
+		}
+		_ = lk.unlock()
+		if err != nil {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("the repository is pruned by another process")
+		}
+		logCh <- log.Debugf("The repository is pruned by another process, waiting.")
+		time.Sleep(lockWait)
+	}
+}
+
+// activeLocks returns the number of the locks of other deliveries and prunes
+func (r *Repository) activeLocks(own string) (int, error) {
+	n, err := r.countLocks(lockExt, own)
+	if err != nil {
+		return 0, err
+	}
+	p, err := r.countLocks(pruneLockExt, own)
+	return n + p, err
+}
+
+// countLocks returns the number of the locks with the extension except the own one, the stale locks are deleted
+func (r *Repository) countLocks(ext, own string) (int, error) {
+	dir := path.Join(r.backupPath, locksDir)
+	fl, err := r.driver.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	n := 0
+	for _, fi := range fl {
+		p := path.Join(dir, fi.Name())
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ext) || p == own {
+			continue
+		}
+		if time.Since(fi.ModTime()) > lockTTL {
+			_ = r.driver.Remove(p)
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (r *Repository) readSnapshots(dir string) (map[string]snapshot, error) {
+	fl, err := r.driver.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := make(map[string]snapshot, len(fl))
+	for _, fi := range fl {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), snapshotExt) {
+			continue
+		}
+		s, err := r.readSnapshot(path.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		snaps[fi.Name()] = s
+	}
+	return snaps, nil
+}
+
+func (r *Repository) walkSnapshots(dir string, fn func(s snapshot)) error {
+	fl, err := r.driver.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range fl {
+		p := path.Join(dir, fi.Name())
+		if fi.IsDir() {
+			if err = r.walkSnapshots(p, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasSuffix(fi.Name(), snapshotExt) {
+			continue
+		}
+		s, err := r.readSnapshot(p)
+		if err != nil {
+			return err
+		}
+		fn(s)
+	}
+	return nil
+}
+
+func (r *Repository) readSnapshot(p string) (s snapshot, err error) {
+	rc, err := r.driver.Open(p)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rc.Close() }()
+
+	if err = json.NewDecoder(rc).Decode(&s); err != nil {
+		err = fmt.Errorf("failed to decode snapshot '%s': %w", p, err)
+	}
+	return
+}
+
+func (r *Repository) readChunk(id string) ([]byte, error) {
+	rc, err := r.driver.Open(r.chunkPath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != id {
+		return nil, fmt.Errorf("chunk '%s' is corrupted", id)
+	}
+	return data, nil
+}
+
+func (r *Repository) chunkPath(id string) string {
+	return path.Join(r.backupPath, chunksDir, id[:2], id)
+}
+
+// GetFileReader restores a backup from the snapshot by its path relative to the backup path
+func (r *Repository) GetFileReader(ofsPath string) (io.Reader, error) {
+	p := path.Join(r.backupPath, ofsPath)
+	if !strings.HasSuffix(p, snapshotExt) {
+		p = path.Join(r.backupPath, snapshotsDir, ofsPath+snapshotExt)
+	}
+
+	s, err := r.readSnapshot(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshotReader{
+		repo:   r,
+		chunks: s.Chunks,
+	}, nil
+}
+
+func (r *Repository) ListBackups(ofsPart string) ([]BackupFile, error) {
+	snapDir := path.Join(r.backupPath, snapshotsDir, ofsPart)
+
+	fl, err := r.driver.ReadDir(snapDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []BackupFile
+	for _, fi := range fl {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), snapshotExt) {
+			continue
+		}
+		p := path.Join(snapDir, fi.Name())
+		s, err := r.readSnapshot(p)
+		if err != nil {
+			return nil, err
+		}
+		bf := BackupFile{Path: p, Size: s.Size, ModTime: s.Time}
+		// the snapshot is kept for the longest of its periods
+		for _, rp := range RetentionPeriodsList {
+			if slices.Contains(s.Periods, rp.String()) {
+				bf.Tier = rp.String()
+				break
+			}
+		}
+		backups = append(backups, bf)
+	}
+	return backups, nil
+}
+
+func (r *Repository) Close() error {
+	return r.storage.Close()
+}
+
+func (r *Repository) Clone() interfaces.Storage {
+	cl := *r
+	cl.storage = r.storage.Clone()
+	cl.driver = cl.storage.(Driver)
+	return &cl
+}
+
+func (r *Repository) GetName() string {
+	return r.storage.GetName()
+}
+
+type snapshotReader struct {
+	repo   *Repository
+	chunks []string
+	buf    *bytes.Reader
+}
+
+func (sr *snapshotReader) Read(p []byte) (int, error) {
+	for sr.buf == nil || sr.buf.Len() == 0 {
+		if len(sr.chunks) == 0 {
+			return 0, io.EOF
+		}
+		data, err := sr.repo.readChunk(sr.chunks[0])
+		if err != nil {
+			return 0, err
+		}
+		sr.chunks = sr.chunks[1:]
+		sr.buf = bytes.NewReader(data)
+	}
+	return sr.buf.Read(p)
+}
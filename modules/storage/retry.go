@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nixys/nxs-backup/modules/logger"
+)
+
+// Classes of the errors that can be retried
+const (
+	RetryOnNetwork = "network"
+	RetryOnTimeout = "timeout"
+	RetryOnServer  = "server"
+)
+
+var RetryOnAll = []string{RetryOnNetwork, RetryOnTimeout, RetryOnServer}
+
+// RetryPolicy defines how failed storage operations are retried
+type RetryPolicy struct {
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	RetryOn      []string
+}
+
+// ServerError is the error response of the server with the HTTP-like status code
+type ServerError struct {
+	Code int
+	Err  error
+}
+
+func (e *ServerError) Error() string { return e.Err.Error() }
+
+func (e *ServerError) Unwrap() error { return e.Err }
+
+func (p RetryPolicy) Validate() error {
+	for _, c := range p.RetryOn {
+		if !slices.Contains(RetryOnAll, c) {
+			return fmt.Errorf("unknown retryable errors class `%s`, allowed: %s", c, strings.Join(RetryOnAll, ", "))
+		}
+	}
+	return nil
+}
+
+// IsRetryable reports whether the error belongs to the classes the policy retries
+func (p RetryPolicy) IsRetryable(err error) bool {
+	retryOn := p.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = RetryOnAll
+	}
+	for _, c := range retryOn {
+		var ok bool
+		switch c {
+		case RetryOnNetwork:
+			ok = isNetworkErr(err)
+		case RetryOnTimeout:
+			ok = isTimeoutErr(err)
+		case RetryOnServer:
+			ok = isServerErr(err)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isTimeoutErr(err error) bool {
+	var nErr net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &nErr) && nErr.Timeout() ||
+		strings.Contains(err.Error(), "timeout")
+}
+
+func isNetworkErr(err error) bool {
+	if isTimeoutErr(err) {
+		return false
+	}
+	var (
+		nErr  net.Error
+		opErr *net.OpError
+	)
+	if errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.As(err, &opErr) ||
+		errors.As(err, &nErr) {
+		return true
+	}
+	// some clients don't wrap the errors of the lost connection
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"connection lost", "connection reset", "connection refused", "broken pipe", "closed network connection", "unexpected eof"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isServerErr(err error) bool {
+	var (
+		sErr  *ServerError
+		tpErr *textproto.Error
+	)
+	switch {
+	case errors.As(err, &sErr):
+		// 423 is replied by WebDAV servers while the interrupted upload still holds the lock
+		return sErr.Code >= 500 || sErr.Code == 429 || sErr.Code == 423 || sErr.Code == 408
+	case errors.As(err, &tpErr):
+		// FTP transient negative completion replies
+		return tpErr.Code >= 400 && tpErr.Code < 500
+	}
+	return false
+}
+
+// Retry calls fn until it succeeds, the error isn't retryable or the attempts are over. The connection is
+// re-established with reconnect before each next attempt, fn gets the number of the attempt starting from 1
+func Retry(logCh chan logger.LogRecord, log logger.LogRecord, p RetryPolicy, reconnect func() error, fn func(attempt int) error) error {
+	delay := p.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			return nil
+		}
+		if attempt >= p.Attempts || !p.IsRetryable(err) {
+			return err
+		}
+
+		logCh <- log.Warnf("Attempt %d of %d failed: %s. Retrying in %s", attempt, p.Attempts, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+
+		if reconnect != nil {
+			if rErr := reconnect(); rErr != nil {
+				logCh <- log.Warnf("Failed to reconnect: %s", rErr)
+			}
+		}
+	}
+}
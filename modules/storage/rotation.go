@@ -0,0 +1,507 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/nixys/nxs-backup/misc"
+	"github.com/nixys/nxs-backup/modules/logger"
+)
+
+// Linker is implemented by storages that keep backups of different retention periods as symlinks
+type Linker interface {
+	Readlink(path string) (string, error)
+	Symlink(oldname, newname string) error
+	Rename(oldpath, newpath string) error
+}
+
+// Locker is implemented by storages that are able to protect backups from deletion till some date
+type Locker interface {
+	LockedUntil(path string) (time.Time, error)
+}
+
+// BatchRemover is implemented by storages that are able to delete many files at once
+type BatchRemover interface {
+	RemoveBatch(paths []string) error
+}
+
+type RotationOpts struct {
+	JobName     string
+	StorageName string
+	BackupPath  string
+	Ofs         string
+	Enabled     bool
+	Retention   Retention
+	IncBackup   bool
+	// Full means that a new full incremental backup is created and all previous ones may be deleted
+	Full bool
+	// Safety means that a new backup is not delivered yet, so one more old backup has to be kept
+	Safety bool
+}
+
+// FileMove describes an old backup file that has to be moved to the place of its symlink
+type FileMove struct {
+	From string
+	To   string
+}
+
+// Relink describes a symlink that has to point to the new location of the moved backup file
+type Relink struct {
+	Link   string
+	Target string
+}
+
+// LockedFile describes an outdated backup that can't be deleted yet
+type LockedFile struct {
+	Path  string
+	Until time.Time
+}
+
+// RotationPlan is the set of actions to be done with old backups of one ofs on a storage
+type RotationPlan struct {
+	JobName     string
+	StorageName string
+	Ofs         string
+	Moves       []FileMove
+	Relinks     []Relink
+	Files       []string
+	Dirs        []string
+	Locked      []LockedFile
+	// Partials are the files left by the interrupted uploads
+	Partials []string
+	Warnings []string
+}
+
+// Len returns the number of backups to be removed by the plan
+func (p *RotationPlan) Len() int {
+	return countBackups(p.Files) + len(p.Dirs)
+}
+
+func (p *RotationPlan) String() string {
+	var sb strings.Builder
+
+	if p.Len() == 0 && len(p.Moves) == 0 && len(p.Partials) == 0 {
+		sb.WriteString("nothing to rotate\n")
+	}
+	for _, f := range p.Partials {
+		_, _ = fmt.Fprintf(&sb, "delete partial upload '%s'\n", f)
+	}
+	for _, m := range p.Moves {
+		_, _ = fmt.Fprintf(&sb, "move '%s' -> '%s'\n", m.From, m.To)
+	}
+	for _, l := range p.Relinks {
+		_, _ = fmt.Fprintf(&sb, "relink '%s' -> '%s'\n", l.Link, l.Target)
+	}
+	for _, f := range p.Files {
+		_, _ = fmt.Fprintf(&sb, "delete '%s'\n", f)
+	}
+	for _, d := range p.Dirs {
+		_, _ = fmt.Fprintf(&sb, "delete directory '%s'\n", d)
+	}
+	for _, l := range p.Locked {
+		_, _ = fmt.Fprintf(&sb, "keep '%s' locked until %s\n", l.Path, l.Until.Format(time.RFC3339))
+	}
+	for _, w := range p.Warnings {
+		_, _ = fmt.Fprintf(&sb, "warning: %s\n", w)
+	}
+
+	return sb.String()
+}
+
+// PlanRotation computes which old backups have to be deleted without changing anything on the storage
+func PlanRotation(d Driver, o RotationOpts) (*RotationPlan, error) {
+	plan := &RotationPlan{
+		JobName:     o.JobName,
+		StorageName: o.StorageName,
+		Ofs:         o.Ofs,
+	}
+
+	if _, ok := d.(Renamer); ok {
+		partials, err := findPartials(d, path.Join(o.BackupPath, o.Ofs))
+		if err != nil {
+			return plan, fmt.Errorf("Failed to find partial uploads: %w ", err)
+		}
+		plan.Partials = partials
+	}
+
+	if !o.Enabled {
+		return plan, nil
+	}
+
+	if o.IncBackup {
+		return plan, planIncRotation(d, o, plan)
+	}
+	return plan, planDescRotation(d, o, plan)
+}
+
+func planDescRotation(d Driver, o RotationOpts, plan *RotationPlan) error {
+	var errs *multierror.Error
+
+	// symlinks to the file ordered from the longest retention period
+	filesLinks := make(map[string][]string, 64)
+	filesToDelete := make(map[string]bool, 64)
+	// keeps the order of files to get the stable plan
+	var deleteOrder []string
+	// volumes without the manifest are left by the interrupted uploads
+	var orphans []string
+
+	linker, withLinks := d.(Linker)
+
+	// periods the next backup will be delivered to, only these make room for it
+	newPeriods := GetDescBackupPeriods(o.Retention.WithLastDaily(d, path.Join(o.BackupPath, o.Ofs)))
+
+	for _, p := range RetentionPeriodsList {
+		retentionCount, retentionDate := GetRetention(p, o.Retention)
+		if retentionCount == 0 && retentionDate.IsZero() {
+			continue
+		}
+
+		bakDir := path.Join(o.BackupPath, o.Ofs, p.String())
+		dirFiles, err := d.ReadDir(bakDir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("Failed to read files in directory '%s' with next error: %w ", bakDir, err)
+		}
+
+		bakFiles := dirFiles[:0]
+		for _, file := range dirFiles {
+			if file.Name() == "." || file.Name() == ".." || IsPartial(file.Name()) {
+				continue
+			}
+			bakFiles = append(bakFiles, file)
+
+			fPath := path.Join(bakDir, file.Name())
+			filesLinks[fPath] = nil
+			if withLinks && file.Mode()&fs.ModeSymlink != 0 {
+				link, err := linker.Readlink(fPath)
+				if err != nil {
+					// the file the symlink points to can't be deleted safely without knowing it
+					return fmt.Errorf("Failed to read a symlink for file '%s' with next error: %w ", fPath, err)
+				}
+				if !path.IsAbs(link) {
+					link = path.Join(bakDir, link)
+				}
+				if links, ok := filesLinks[link]; ok {
+					filesLinks[link] = append(links, fPath)
+				}
+			}
+		}
+
+		// the volumes of a backup split by size are rotated together
+		bakSets, orphanFiles := groupVolumeSets(bakFiles)
+		for _, file := range orphanFiles {
+			orphans = append(orphans, path.Join(bakDir, file.Name()))
+		}
+
+		if o.Retention.UseCount {
+			sort.SliceStable(bakSets, func(i, j int) bool {
+				return bakSets[i].modTime.Before(bakSets[j].modTime)
+			})
+
+			if !o.Safety && slices.Contains(newPeriods, p) {
+				retentionCount--
+			}
+			if retentionCount <= len(bakSets) {
+				bakSets = bakSets[:len(bakSets)-retentionCount]
+			} else {
+				bakSets = bakSets[:0]
+			}
+		} else {
+			i := 0
+			for _, set := range bakSets {
+				if set.modTime.Before(retentionDate) {
+					bakSets[i] = set
+					i++
+				}
+			}
+			bakSets = bakSets[:i]
+		}
+
+		for _, set := range bakSets {
+			if set.isDir {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("`%s` is directory in %s. Please check and remove it.", set.name, bakDir))
+				continue
+			}
+			for _, file := range set.files {
+				fPath := path.Join(bakDir, file.Name())
+				filesToDelete[fPath] = true
+				deleteOrder = append(deleteOrder, fPath)
+			}
+		}
+	}
+
+	for _, file := range deleteOrder {
+		target := ""
+		for _, link := range filesLinks[file] {
+			if filesToDelete[link] {
+				continue
+			}
+			if target == "" {
+				// the file is still needed by a longer period, so it takes the place of the first kept symlink
+				plan.Moves = append(plan.Moves, FileMove{From: file, To: link})
+				target = link
+				continue
+			}
+			// and the rest kept symlinks have to point to its new location
+			relative, _ := filepath.Rel(path.Dir(link), target)
+			plan.Relinks = append(plan.Relinks, Relink{Link: link, Target: relative})
+		}
+		if target == "" {
+			plan.Files = append(plan.Files, file)
+		}
+	}
+
+	if locker, ok := d.(Locker); ok {
+		now := time.Now()
+		i := 0
+		for _, file := range plan.Files {
+			until, err := locker.LockedUntil(file)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("Failed to get lock of file '%s': %w ", file, err))
+				continue
+			}
+			if until.After(now) {
+				plan.Locked = append(plan.Locked, LockedFile{Path: file, Until: until})
+				continue
+			}
+			plan.Files[i] = file
+			i++
+		}
+		plan.Files = plan.Files[:i]
+
+		i = 0
+		for _, file := range orphans {
+			until, err := locker.LockedUntil(file)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("Failed to get lock of file '%s': %w ", file, err))
+				continue
+			}
+			if until.After(now) {
+				continue
+			}
+			orphans[i] = file
+			i++
+		}
+		orphans = orphans[:i]
+	}
+	plan.Partials = append(plan.Partials, orphans...)
+
+	return errs.ErrorOrNil()
+}
+
+func planIncRotation(d Driver, o RotationOpts, plan *RotationPlan) error {
+	if o.Full {
+		backupDir := path.Join(o.BackupPath, o.Ofs)
+		if _, err := d.ReadDir(backupDir); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("Failed to get access to directory '%s' with next error: %w ", backupDir, err)
+		}
+		plan.Dirs = append(plan.Dirs, backupDir)
+		return nil
+	}
+
+	intMoy, _ := strconv.Atoi(misc.GetDateTimeNow("moy"))
+	lastMonth := intMoy - o.Retention.Months
+
+	var year string
+	if lastMonth > 0 {
+		year = misc.GetDateTimeNow("year")
+	} else {
+		year = misc.GetDateTimeNow("previous_year")
+		lastMonth += 12
+	}
+
+	backupDir := path.Join(o.BackupPath, o.Ofs, year)
+	dirs, err := d.ReadDir(backupDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("Failed to get access to directory '%s' with next error: %w ", backupDir, err)
+	}
+
+	rx := regexp.MustCompile(`^month_\d\d$`)
+	for _, dir := range dirs {
+		if !rx.MatchString(dir.Name()) {
+			continue
+		}
+		dirMonth, _ := strconv.Atoi(strings.TrimPrefix(dir.Name(), "month_"))
+		if dirMonth < lastMonth {
+			plan.Dirs = append(plan.Dirs, path.Join(backupDir, dir.Name()))
+		}
+	}
+	sort.Strings(plan.Dirs)
+
+	return nil
+}
+
+// RotationStats is the result of the rotation of old backups on a storage
+type RotationStats struct {
+	// Rotated is the number of outdated backups found by the rotation
+	Rotated int
+	// Deleted is the number of backups actually deleted, locked backups and failed deletions aren't counted
+	Deleted int
+}
+
+// Apply executes the plan on the storage and returns the rotation stats
+func (p *RotationPlan) Apply(logCh chan logger.LogRecord, d Driver) (RotationStats, error) {
+	var errs *multierror.Error
+
+	locked := make([]string, 0, len(p.Locked))
+	for _, l := range p.Locked {
+		locked = append(locked, l.Path)
+	}
+	stats := RotationStats{Rotated: p.Len() + countBackups(locked)}
+
+	rotateLog := logger.Log(p.JobName, p.StorageName).WithTarget(p.Ofs).WithPhase(logger.PhaseRotate)
+
+	for _, f := range p.Partials {
+		if err := d.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logCh <- rotateLog.Errorf("Failed to delete partial upload '%s' with next error: %s", f, err)
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		logCh <- rotateLog.Infof("Deleted partial upload '%s' left by the interrupted delivery", f)
+	}
+	for _, w := range p.Warnings {
+		logCh <- rotateLog.Warn(w)
+	}
+	for _, l := range p.Locked {
+		logCh <- rotateLog.Infof("Old backup '%s' is locked until %s. Skipping delete.", l.Path, l.Until.Format(time.RFC3339))
+	}
+
+	if len(p.Moves) > 0 || len(p.Relinks) > 0 {
+		linker, ok := d.(Linker)
+		if !ok {
+			return stats, fmt.Errorf("Storage '%s' doesn't support symlinks ", p.StorageName)
+		}
+
+		// the symlinks aren't changed to the files which failed to be moved
+		failed := make(map[string]bool)
+		for _, m := range p.Moves {
+			if err := d.Remove(m.To); err != nil {
+				logCh <- rotateLog.Errorf("Failed to delete symlink '%s' with next error: %s", m.To, err)
+				errs = multierror.Append(errs, err)
+				failed[m.To] = true
+				continue
+			}
+			if err := linker.Rename(m.From, m.To); err != nil {
+				logCh <- rotateLog.Errorf("Failed to move file '%s' with next error: %s", m.From, err)
+				errs = multierror.Append(errs, err)
+				failed[m.To] = true
+				// the deleted symlink is restored, the file stays in its place
+				relative, _ := filepath.Rel(path.Dir(m.To), m.From)
+				if err = linker.Symlink(relative, m.To); err != nil {
+					logCh <- rotateLog.Errorf("Failed to restore symlink '%s' with next error: %s", m.To, err)
+					errs = multierror.Append(errs, err)
+				}
+				continue
+			}
+			logCh <- rotateLog.Debugf("Successfully moved old backup to %s", m.To)
+		}
+		for _, l := range p.Relinks {
+			if failed[path.Join(path.Dir(l.Link), l.Target)] {
+				continue
+			}
+			if err := d.Remove(l.Link); err != nil {
+				logCh <- rotateLog.Error(err)
+				errs = multierror.Append(errs, err)
+				continue
+			}
+			if err := linker.Symlink(l.Target, l.Link); err != nil {
+				logCh <- rotateLog.Error(err)
+				errs = multierror.Append(errs, err)
+				continue
+			}
+			logCh <- rotateLog.Debugf("Successfully changed symlink %s", l.Link)
+		}
+	}
+
+	if br, ok := d.(BatchRemover); ok && len(p.Files) > 0 {
+		if err := br.RemoveBatch(p.Files); err != nil {
+			logCh <- rotateLog.Errorf("Error detected during multiple files deletion: '%s'", err)
+			errs = multierror.Append(errs, err)
+		} else {
+			for _, file := range p.Files {
+				logCh <- rotateLog.Infof("Deleted old backup file '%s'", file)
+			}
+			stats.Deleted += countBackups(p.Files)
+		}
+	} else {
+		var deleted []string
+		for _, file := range p.Files {
+			if err := d.Remove(file); err != nil {
+				logCh <- rotateLog.Errorf("Failed to delete file '%s' with next error: %s", file, err)
+				errs = multierror.Append(errs, err)
+				continue
+			}
+			logCh <- rotateLog.Infof("Deleted old backup file '%s'", file)
+			deleted = append(deleted, file)
+		}
+		stats.Deleted += countBackups(deleted)
+	}
+
+	for _, dir := range p.Dirs {
+		if err := d.RemoveAll(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logCh <- rotateLog.Errorf("Failed to delete '%s' with next error: %s", dir, err)
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		logCh <- rotateLog.Infof("Deleted old backup '%s'", dir)
+		stats.Deleted++
+	}
+
+	return stats, errs.ErrorOrNil()
+}
+
+// countBackups returns the number of backups the files belong to, the volumes of a backup are counted once
+// and the volumes without the manifest aren't counted
+func countBackups(files []string) int {
+	sets := manifestSets(files)
+	backups := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		if name, ok := volumeSetOf(f, sets); ok {
+			backups[name] = struct{}{}
+		} else if !IsVolume(f) {
+			backups[f] = struct{}{}
+		}
+	}
+	return len(backups)
+}
+
+// DeleteOldBackups plans the rotation of old backups, applies it and returns the rotation stats
+func DeleteOldBackups(logCh chan logger.LogRecord, d Driver, o RotationOpts) (RotationStats, error) {
+	if !o.Enabled {
+		logCh <- logger.Log(o.JobName, o.StorageName).WithTarget(o.Ofs).WithPhase(logger.PhaseRotate).Debugf("Backup rotate skipped by config.")
+	}
+
+	// the partial uploads are cleaned up even if the rotation is disabled
+	plan, err := PlanRotation(d, o)
+	if err != nil {
+		logCh <- logger.Log(o.JobName, o.StorageName).WithTarget(o.Ofs).WithPhase(logger.PhaseRotate).Errorf("Failed to plan backups rotation: %s", err)
+		if plan.Len() == 0 && len(plan.Moves) == 0 {
+			return RotationStats{}, err
+		}
+	}
+
+	stats, aErr := plan.Apply(logCh, d)
+	if aErr != nil {
+		err = multierror.Append(err, aErr)
+	}
+	return stats, err
+}
@@ -3,6 +3,8 @@ package s3
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -10,9 +12,6 @@ import (
 	"net/http"
 	"os"
 	"path"
-	"regexp"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -28,26 +27,39 @@ import (
 
 type S3 struct {
 	client        *minio.Client
+	retry         RetryPolicy
 	name          string
 	bucketName    string
 	backupPath    string
 	rateLimit     int64
+	volumeSize    int64
 	rotateEnabled bool
 	batchDeletion bool
+	lockMode      minio.RetentionMode
+	// bucketLocked means that object lock is enabled for the bucket, objects may be locked by its default retention
+	bucketLocked bool
 	Retention
 }
 
 type Opts struct {
-	BucketName    string
-	AccessKeyID   string
-	SecretKey     string
-	Endpoint      string
-	Region        string
-	BatchDeletion bool
-	Secure        bool
+	BucketName     string
+	AccessKeyID    string
+	SecretKey      string
+	Endpoint       string
+	Region         string
+	BatchDeletion  bool
+	Secure         bool
+	ObjectLockMode string
 }
 
-func Init(name string, opts Opts, rl int64) (*S3, error) {
+const (
+	// partSize is the minimal size of parts of the multipart upload, the failed parts are uploaded again separately
+	partSize = 64 << 20
+	// maxParts is the limit of the number of parts of the multipart upload
+	maxParts = 10000
+)
+
+func Init(name string, opts Opts, rl int64, retry RetryPolicy) (*S3, error) {
 	endpoint := opts.Endpoint
 	bucketLookup := minio.BucketLookupAuto
 	if strings.HasPrefix(endpoint, opts.BucketName+".") {
@@ -72,11 +84,32 @@ func Init(name string, opts Opts, rl int64) (*S3, error) {
 		return nil, fmt.Errorf("Bucket '%s' doesn't exist. ", opts.BucketName)
 	}
 
+	// the bucket without object lock configuration returns the error
+	lockEnabled, _, _, _, lockErr := s3Client.GetObjectLockConfig(context.Background(), opts.BucketName)
+	bucketLocked := lockErr == nil && lockEnabled == "Enabled"
+
+	var lockMode minio.RetentionMode
+	if opts.ObjectLockMode != "" {
+		lockMode = minio.RetentionMode(strings.ToUpper(opts.ObjectLockMode))
+		if !lockMode.IsValid() {
+			return nil, fmt.Errorf("Unknown object lock mode '%s' for S3 storage '%s'. Allowed modes: governance, compliance ", opts.ObjectLockMode, name)
+		}
+		if lockErr != nil {
+			return nil, fmt.Errorf("Failed to get object lock configuration of bucket '%s'. Error: %v ", opts.BucketName, lockErr)
+		}
+		if !bucketLocked {
+			return nil, fmt.Errorf("Object lock is not enabled for bucket '%s'. ", opts.BucketName)
+		}
+	}
+
 	return &S3{
 		name:          name,
 		client:        s3Client,
+		retry:         retry,
 		bucketName:    opts.BucketName,
 		batchDeletion: opts.BatchDeletion,
+		lockMode:      lockMode,
+		bucketLocked:  bucketLocked,
 		rateLimit:     rl,
 	}, nil
 }
@@ -84,192 +117,232 @@ func Init(name string, opts Opts, rl int64) (*S3, error) {
 func (s *S3) Configure(p Params) {
 	s.backupPath = strings.TrimPrefix(p.BackupPath, "/")
 	s.rateLimit = p.RateLimit
+	s.volumeSize = p.VolumeSize
 	s.rotateEnabled = p.RotateEnabled
 	s.Retention = p.Retention
 }
 
 func (s *S3) IsLocal() int { return 0 }
 
+func (s *S3) VolumeSize() int64 { return s.volumeSize }
+
 func (s *S3) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFile, ofs, bakType string) error {
+	deliveryLog := logger.Log(jobName, s.name).WithTarget(ofs).WithPhase(logger.PhaseDeliver)
+
 	var bakRemPaths, mtdRemPaths []string
 
 	if bakType == string(misc.IncFiles) {
 		bakRemPaths, mtdRemPaths = GetIncBackupDstList(tmpBackupFile, ofs, s.backupPath)
 	} else {
-		bakRemPaths = GetDescBackupDstList(tmpBackupFile, ofs, s.backupPath, s.Retention)
+		bakRemPaths = GetDescBackupDstList(tmpBackupFile, ofs, s.backupPath, s.Retention.WithLastDaily(s, path.Join(s.backupPath, ofs)))
 	}
 
 	if len(mtdRemPaths) > 0 {
-		mtdSrc, err := files.GetLimitedFileReader(tmpBackupFile+".inc", s.rateLimit)
-		if err != nil {
-			return err
-		}
-		defer func() { _ = mtdSrc.Close() }()
-
-		mtdSrcStat, err := os.Stat(tmpBackupFile + ".inc")
-		if err != nil {
-			return err
+		putOpts := minio.PutObjectOptions{ContentType: "application/octet-stream"}
+		if s.lockMode != "" {
+			// the metadata is needed to restore the inc backups, so it is kept as long as them
+			putOpts.Mode = s.lockMode
+			putOpts.RetainUntilDate = s.getLockUntil("", true)
 		}
-
 		for _, bucketPath := range mtdRemPaths {
-			_, err = s.client.PutObject(context.Background(), s.bucketName, bucketPath, mtdSrc, mtdSrcStat.Size(), minio.PutObjectOptions{
-				ContentType: "application/octet-stream",
-			})
+			err := s.upload(logCh, deliveryLog, tmpBackupFile+".inc", bucketPath, putOpts)
 			if err != nil {
+				logCh <- deliveryLog.Errorf("Failed to upload object '%s' to bucket %s. Error: %v", bucketPath, s.bucketName, err)
 				return err
 			}
-			logCh <- logger.Log(jobName, s.name).Infof("Successfully uploaded object '%s' in bucket %s", bucketPath, s.bucketName)
+			if s.lockMode != "" {
+				logCh <- deliveryLog.Infof("Successfully uploaded object '%s' in bucket %s, locked until %s",
+					bucketPath, s.bucketName, putOpts.RetainUntilDate.Format(time.RFC3339))
+			} else {
+				logCh <- deliveryLog.Infof("Successfully uploaded object '%s' in bucket %s", bucketPath, s.bucketName)
+			}
 		}
 	}
 
-	source, err := files.GetLimitedFileReader(tmpBackupFile, s.rateLimit)
+	volumes, err := SplitVolumes(tmpBackupFile, s.volumeSize)
 	if err != nil {
+		logCh <- deliveryLog.Errorf("Unable to split backup into volumes: %s", err)
 		return err
 	}
-	defer func() { _ = source.Close() }()
 
-	sourceStat, err := os.Stat(tmpBackupFile)
-	if err != nil {
-		return err
-	}
-
-	for _, bucketPath := range bakRemPaths {
-		if _, err = source.Seek(0, io.SeekStart); err != nil {
-			logCh <- logger.Log(jobName, s.name).Errorf("Failed to reset file reader to start. Error: %v", err)
-			return err
+	for _, bakPath := range bakRemPaths {
+		putOpts := minio.PutObjectOptions{ContentType: "application/octet-stream"}
+		if s.lockMode != "" {
+			putOpts.Mode = s.lockMode
+			putOpts.RetainUntilDate = s.getLockUntil(bakPath, bakType == string(misc.IncFiles))
 		}
-		res, err := s.client.PutObject(context.Background(), s.bucketName, bucketPath, source, sourceStat.Size(), minio.PutObjectOptions{ContentType: "application/octet-stream"})
-		if err != nil {
-			logCh <- logger.Log(jobName, s.name).Errorf("Failed to upload object '%s' to bucket %s. Error: %v", bucketPath, s.bucketName, err)
-			logCh <- logger.Log(jobName, s.name).Debugf("Response: %+v\n", res)
-			return err
+		for _, vol := range volumes {
+			bucketPath := VolumePath(bakPath, vol)
+			if err = s.upload(logCh, deliveryLog, vol, bucketPath, putOpts); err != nil {
+				logCh <- deliveryLog.Errorf("Failed to upload object '%s' to bucket %s. Error: %v", bucketPath, s.bucketName, err)
+				return err
+			}
+			if s.lockMode != "" {
+				logCh <- deliveryLog.Infof("Successfully uploaded object '%s' to bucket %s, locked until %s",
+					bucketPath, s.bucketName, putOpts.RetainUntilDate.Format(time.RFC3339))
+			} else {
+				logCh <- deliveryLog.Infof("Successfully uploaded object '%s' to bucket %s", bucketPath, s.bucketName)
+			}
 		}
-		logCh <- logger.Log(jobName, s.name).Infof("Successfully uploaded object '%s' to bucket %s", bucketPath, s.bucketName)
 	}
 
 	return nil
 }
 
-func (s *S3) DeleteOldBackups(logCh chan logger.LogRecord, ofs string, job interfaces.Job, full bool) error {
-	if !s.rotateEnabled {
-		logCh <- logger.Log(job.GetName(), s.name).Debugf("Backup rotate skipped by config.")
-		return nil
+// upload puts the file with retries. Large files are uploaded by parts, only the failed part is uploaded again on retry
+func (s *S3) upload(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, srcPath, bucketPath string, putOpts minio.PutObjectOptions) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
 	}
+	defer func() { _ = src.Close() }()
 
-	curDate := time.Now().Round(24 * time.Hour)
-
-	objCh := make(chan minio.ObjectInfo)
+	srcStat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	size := srcStat.Size()
+
+	if size <= partSize {
+		return Retry(logCh, deliveryLog, s.retry, nil, func(int) error {
+			_, err := s.client.PutObject(context.Background(), s.bucketName, bucketPath,
+				files.GetLimitedReader(io.NewSectionReader(src, 0, size), s.rateLimit), size, putOpts)
+			return retryErr(err)
+		})
+	}
 
-	// Send object that are needed to be removed to objCh
-	filesList := make(map[string][]minio.ObjectInfo)
+	core := minio.Core{Client: s.client}
 
-	backupDir := path.Join(s.backupPath, ofs)
+	var uploadID string
+	err = Retry(logCh, deliveryLog, s.retry, nil, func(int) (err error) {
+		uploadID, err = core.NewMultipartUpload(context.Background(), s.bucketName, bucketPath, putOpts)
+		return retryErr(err)
+	})
+	if err != nil {
+		return err
+	}
 
-	for object := range s.client.ListObjects(context.Background(), s.bucketName, minio.ListObjectsOptions{Recursive: true, Prefix: backupDir}) {
-		if object.Err != nil {
-			logCh <- logger.Log(job.GetName(), s.name).Errorf("Failed get objects: '%s'", object.Err)
-			return object.Err
-		}
+	// parts of large objects are enlarged to keep their number within the limit
+	pSize := max(partSize, (size+maxParts-1)/maxParts)
 
-		if job.GetType() == misc.IncFiles {
-			if full {
-				filesList["inc"] = append(filesList["inc"], object)
-			} else {
-				intMoy, _ := strconv.Atoi(misc.GetDateTimeNow("moy"))
-				lastMonth := intMoy - s.Months
-
-				var year string
-				if lastMonth > 0 {
-					year = misc.GetDateTimeNow("year")
-				} else {
-					year = misc.GetDateTimeNow("previous_year")
-					lastMonth += 12
-				}
-				rx := regexp.MustCompile(year + "/month_\\d\\d")
-				if rx.MatchString(object.Key) {
-					dirParts := strings.Split(path.Base(object.Key), "_")
-					dirMonth, _ := strconv.Atoi(dirParts[1])
-					if dirMonth < lastMonth {
-						filesList["inc"] = append(filesList["inc"], object)
-					}
-				}
-			}
-		} else {
-			if object.LastModified.Location() != curDate.Location() {
-				curDate = curDate.In(object.LastModified.Location())
+	var parts []minio.CompletePart
+	for n, offset := 1, int64(0); offset < size; n, offset = n+1, offset+pSize {
+		partLen := min(pSize, size-offset)
+		var partOpts minio.PutObjectPartOptions
+		if s.lockMode != "" {
+			// the locked objects require checksums of the parts
+			if partOpts.Md5Base64, err = md5Base64(io.NewSectionReader(src, offset, partLen)); err != nil {
+				return err
 			}
+		}
 
-			if strings.Contains(object.Key, Daily.String()) && s.Retention.Days > 0 {
-				if s.Retention.UseCount || object.LastModified.Before(curDate.AddDate(0, 0, -s.Retention.Days+1)) {
-					filesList["daily"] = append(filesList["daily"], object)
-				}
-			} else if strings.Contains(object.Key, Weekly.String()) && s.Retention.Weeks > 0 && misc.GetDateTimeNow("dow") == misc.WeeklyBackupDay {
-				if s.Retention.UseCount || object.LastModified.Before(curDate.AddDate(0, 0, -s.Retention.Weeks*7+1)) {
-					filesList["weekly"] = append(filesList["weekly"], object)
-				}
-			} else if strings.Contains(object.Key, Monthly.String()) && s.Retention.Weeks > 0 && misc.GetDateTimeNow("dom") == misc.MonthlyBackupDay {
-				if s.Retention.UseCount || object.LastModified.Before(curDate.AddDate(0, -s.Retention.Months, 1)) {
-					filesList["monthly"] = append(filesList["monthly"], object)
-				}
+		err = Retry(logCh, deliveryLog, s.retry, nil, func(int) error {
+			part, err := core.PutObjectPart(context.Background(), s.bucketName, bucketPath, uploadID, n,
+				files.GetLimitedReader(io.NewSectionReader(src, offset, partLen), s.rateLimit), partLen, partOpts)
+			if err != nil {
+				return retryErr(err)
 			}
+			parts = append(parts, minio.CompletePart{PartNumber: n, ETag: part.ETag})
+			return nil
+		})
+		if err != nil {
+			_ = core.AbortMultipartUpload(context.Background(), s.bucketName, bucketPath, uploadID)
+			return err
 		}
 	}
 
-	go func() {
-		defer close(objCh)
-		for period, s3Files := range filesList {
-			needSort := true
-			retentionCount := 0
-			switch period {
-			case "inc":
-				needSort = false
-			case "daily":
-				retentionCount = s.Retention.Days
-			case "weekly":
-				retentionCount = s.Retention.Weeks
-			case "monthly":
-				retentionCount = s.Retention.Months
-			}
+	err = Retry(logCh, deliveryLog, s.retry, nil, func(int) error {
+		_, err := core.CompleteMultipartUpload(context.Background(), s.bucketName, bucketPath, uploadID, parts, putOpts)
+		return retryErr(err)
+	})
+	if err != nil {
+		_ = core.AbortMultipartUpload(context.Background(), s.bucketName, bucketPath, uploadID)
+	}
+	return err
+}
 
-			if needSort && s.Retention.UseCount {
-				sort.Slice(s3Files, func(i, j int) bool {
-					return s3Files[i].LastModified.Before(s3Files[j].LastModified)
-				})
-
-				if !job.IsBackupSafety() {
-					retentionCount--
-				}
-				if retentionCount <= len(s3Files) {
-					s3Files = s3Files[:len(s3Files)-retentionCount]
-				} else {
-					s3Files = s3Files[:0]
-				}
-			}
+func md5Base64(r io.Reader) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
 
-			for _, file := range s3Files {
-				logCh <- logger.Log(job.GetName(), s.name).Infof("File '%s' going to be deleted", file.Key)
-				objCh <- file
-			}
-		}
-	}()
+// retryErr marks the S3 error responses to be retried according to their status
+func retryErr(err error) error {
+	var rErr minio.ErrorResponse
+	if errors.As(err, &rErr) {
+		return &ServerError{Code: rErr.StatusCode, Err: err}
+	}
+	return err
+}
+
+// getLockUntil returns the date till the backup has to be kept according to the retention of its period.
+// Both by count and by date the rotation removes a backup not earlier than the start of the period
+// the retention number of periods later, so the lock expires by then
+func (s *S3) getLockUntil(bucketPath string, inc bool) time.Time {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	if inc {
+		// the month directories of inc backups are removed when they are more than retention months old
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return month.AddDate(0, s.Months+1, 0).UTC()
+	}
 
-	if s.batchDeletion {
-		for err := range s.client.RemoveObjects(context.Background(), s.bucketName, objCh, minio.RemoveObjectsOptions{GovernanceBypass: true}) {
-			logCh <- logger.Log(job.GetName(), s.name).Errorf("Error detected during multiple objects deletion: '%s'", err)
-			return err.Err
+	for _, p := range RetentionPeriodsList {
+		if path.Base(path.Dir(bucketPath)) != p.String() {
+			continue
 		}
-	} else {
-		for object := range objCh {
-			if err := s.client.RemoveObject(context.Background(), s.bucketName, object.Key, minio.RemoveObjectOptions{GovernanceBypass: true}); err != nil {
-				logCh <- logger.Log(job.GetName(), s.name).Errorf("Error detected during single object deletion: '%s'", err)
-				return err
-			}
+		count, _ := GetRetentionLimits(p, s.Retention)
+		switch p {
+		case Hourly:
+			return now.Truncate(time.Hour).Add(time.Duration(count) * time.Hour).UTC()
+		case Daily:
+			return today.AddDate(0, 0, count).UTC()
+		case Weekly:
+			return today.AddDate(0, 0, count*7).UTC()
+		case Monthly:
+			return today.AddDate(0, count, 0).UTC()
+		case Yearly:
+			return today.AddDate(count, 0, 0).UTC()
 		}
 	}
-	return nil
+	return now.UTC()
+}
+
+func (s *S3) GetDeliveryPlan(tmpBackupFile, ofs, bakType string) (*DeliveryPlan, error) {
+	return GetCopiesDeliveryPlan(s.GetName(), tmpBackupFile, ofs, bakType, s.backupPath, s.Retention.WithLastDaily(s, path.Join(s.backupPath, ofs)), s.volumeSize), nil
+}
+
+func (s *S3) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) (RotationStats, error) {
+	return DeleteOldBackups(logCh, s, s.rotationOpts(ofsPart, job, full))
+}
+
+func (s *S3) GetRotationPlan(ofsPart string, job interfaces.Job, full bool) (*RotationPlan, error) {
+	return PlanRotation(s, s.rotationOpts(ofsPart, job, full))
+}
+
+func (s *S3) rotationOpts(ofsPart string, job interfaces.Job, full bool) RotationOpts {
+	return RotationOpts{
+		JobName:     job.GetName(),
+		StorageName: s.GetName(),
+		BackupPath:  s.backupPath,
+		Ofs:         ofsPart,
+		Enabled:     s.rotateEnabled,
+		Retention:   s.Retention,
+		IncBackup:   job.GetType() == misc.IncFiles,
+		Full:        full,
+		Safety:      job.IsBackupSafety(),
+	}
 }
 
 func (s *S3) GetFileReader(ofsPath string) (io.Reader, error) {
+	if r, err := ReadVolumes(s, path.Join(s.backupPath, ofsPath)); !errors.Is(err, fs.ErrNotExist) {
+		return r, err
+	}
+
 	_, err := s.client.StatObject(context.Background(), s.bucketName, path.Join(s.backupPath, ofsPath), minio.StatObjectOptions{})
 	if err != nil {
 		var rErr minio.ErrorResponse
@@ -296,17 +369,194 @@ func (s *S3) GetFileReader(ofsPath string) (io.Reader, error) {
 	return bytes.NewReader(buf), err
 }
 
-func (s *S3) ListBackups(ofsPath string) ([]string, error) {
-	var fList []string
+func (s *S3) ListBackups(ofsPath string) ([]BackupFile, error) {
+	var fList []BackupFile
 	backupDir := path.Join(s.backupPath, ofsPath)
 
 	for object := range s.client.ListObjects(context.Background(), s.bucketName, minio.ListObjectsOptions{Recursive: true, Prefix: backupDir}) {
 		if object.Err != nil {
 			return nil, object.Err
 		}
-		fList = append(fList, object.Key)
+		if s.bucketLocked {
+			until, err := s.getObjectLock(object.Key, "")
+			if err != nil {
+				return nil, err
+			}
+			if until.After(time.Now()) {
+				bf := NewBackupFile(object.Key, object.Size, object.LastModified)
+				bf.LockedUntil = &until
+				fList = append(fList, bf)
+				continue
+			}
+		}
+		fList = append(fList, NewBackupFile(object.Key, object.Size, object.LastModified))
 	}
-	return fList, nil
+	return GroupVolumes(fList), nil
+}
+
+func (s *S3) Stat(p string) (fs.FileInfo, error) {
+	obj, err := s.client.StatObject(context.Background(), s.bucketName, p, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s.convertErr(p, err)
+	}
+	return NewFileInfo(path.Base(obj.Key), obj.Size, obj.LastModified, false), nil
+}
+
+func (s *S3) ReadDir(p string) ([]fs.FileInfo, error) {
+	var fl []fs.FileInfo
+
+	prefix := listPrefix(p)
+	for object := range s.client.ListObjects(context.Background(), s.bucketName, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			fl = append(fl, NewFileInfo(path.Base(object.Key), 0, object.LastModified, true))
+		} else {
+			fl = append(fl, NewFileInfo(path.Base(object.Key), object.Size, object.LastModified, false))
+		}
+	}
+	if len(fl) == 0 {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: fs.ErrNotExist}
+	}
+	return fl, nil
+}
+
+func (s *S3) Open(p string) (io.ReadCloser, error) {
+	if _, err := s.Stat(p); err != nil {
+		return nil, err
+	}
+	return s.client.GetObject(context.Background(), s.bucketName, p, minio.GetObjectOptions{})
+}
+
+func (s *S3) Put(p string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(context.Background(), s.bucketName, p, files.GetLimitedReader(r, s.rateLimit), size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+func (s *S3) Remove(p string) error {
+	opts := minio.RemoveObjectOptions{}
+	if s.bucketLocked {
+		// a delete marker doesn't free space in a versioned bucket, so the version itself is removed
+		obj, err := s.client.StatObject(context.Background(), s.bucketName, p, minio.StatObjectOptions{})
+		if err != nil {
+			return s.convertErr(p, err)
+		}
+		opts.VersionID = obj.VersionID
+	}
+	return s.client.RemoveObject(context.Background(), s.bucketName, p, opts)
+}
+
+// RemoveAll deletes all objects with the prefix except the locked ones
+func (s *S3) RemoveAll(p string) error {
+	var objects []minio.ObjectInfo
+
+	for object := range s.client.ListObjects(context.Background(), s.bucketName, minio.ListObjectsOptions{
+		Recursive:    true,
+		Prefix:       listPrefix(p),
+		WithVersions: s.bucketLocked,
+	}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if s.bucketLocked && !object.IsDeleteMarker {
+			until, err := s.getObjectLock(object.Key, object.VersionID)
+			if err != nil {
+				return err
+			}
+			if until.After(time.Now()) {
+				continue
+			}
+		}
+		objects = append(objects, object)
+	}
+
+	return s.removeObjects(objects)
+}
+
+// listPrefix returns the prefix of the keys in the directory, the keys never start with the slash
+func listPrefix(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return p + "/"
+}
+
+func (s *S3) RemoveBatch(paths []string) error {
+	objects := make([]minio.ObjectInfo, 0, len(paths))
+
+	for _, p := range paths {
+		obj := minio.ObjectInfo{Key: p}
+		if s.bucketLocked {
+			info, err := s.client.StatObject(context.Background(), s.bucketName, p, minio.StatObjectOptions{})
+			if err != nil {
+				return s.convertErr(p, err)
+			}
+			obj.VersionID = info.VersionID
+		}
+		objects = append(objects, obj)
+	}
+
+	return s.removeObjects(objects)
+}
+
+func (s *S3) removeObjects(objects []minio.ObjectInfo) error {
+	if !s.batchDeletion {
+		for _, obj := range objects {
+			if err := s.client.RemoveObject(context.Background(), s.bucketName, obj.Key, minio.RemoveObjectOptions{VersionID: obj.VersionID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	objCh := make(chan minio.ObjectInfo, len(objects))
+	for _, obj := range objects {
+		objCh <- obj
+	}
+	close(objCh)
+
+	var err error
+	for rErr := range s.client.RemoveObjects(context.Background(), s.bucketName, objCh, minio.RemoveObjectsOptions{}) {
+		if err == nil {
+			err = rErr.Err
+		}
+	}
+	return err
+}
+
+// LockedUntil returns the object lock retention date, zero time means the object isn't locked.
+// The object may be locked by the default retention of the bucket even if the lock mode isn't configured
+func (s *S3) LockedUntil(p string) (time.Time, error) {
+	if !s.bucketLocked {
+		return time.Time{}, nil
+	}
+	return s.getObjectLock(p, "")
+}
+
+func (s *S3) getObjectLock(key, versionID string) (time.Time, error) {
+	_, until, err := s.client.GetObjectRetention(context.Background(), s.bucketName, key, versionID)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchObjectLockConfiguration" {
+			return time.Time{}, nil
+		}
+		return time.Time{}, s.convertErr(key, err)
+	}
+	if until == nil {
+		return time.Time{}, nil
+	}
+	return *until, nil
+}
+
+func (s *S3) convertErr(p string, err error) error {
+	var rErr minio.ErrorResponse
+	if errors.As(err, &rErr) && rErr.StatusCode == http.StatusNotFound {
+		return &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+	}
+	return err
 }
 
 func (s *S3) Close() error {
@@ -318,6 +568,10 @@ func (s *S3) Clone() interfaces.Storage {
 	return &cl
 }
 
+func (s *S3) BackupPath() string {
+	return s.backupPath
+}
+
 func (s *S3) GetName() string {
 	return s.name
 }
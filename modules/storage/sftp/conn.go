@@ -0,0 +1,359 @@
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/nixys/nxs-backup/misc"
+)
+
+// connection is the SFTP session over the SSH connection, possibly established through jump hosts.
+// It's shared by the storage clones and is re-established when the SSH connection is lost
+type connection struct {
+	mu        sync.Mutex
+	addr      string
+	jumps     []jumpHost
+	config    *ssh.ClientConfig
+	jumpHKCb  ssh.HostKeyCallback
+	keepalive time.Duration
+	agent     net.Conn
+	clients   []*ssh.Client
+	sftp      *sftp.Client
+	lost      bool
+	done      chan struct{}
+}
+
+type jumpHost struct {
+	user string
+	addr string
+}
+
+func newConnection(opts Opts) (*connection, error) {
+	c := &connection{
+		addr:      net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port)),
+		keepalive: opts.KeepaliveInterval * time.Second,
+		config: &ssh.ClientConfig{
+			User:          opts.User,
+			Timeout:       opts.ConnectTimeout * time.Second,
+			ClientVersion: "SSH-2.0-" + "nxs-backup/" + misc.VERSION,
+		},
+	}
+
+	for _, jh := range opts.JumpHosts {
+		c.jumps = append(c.jumps, parseJumpHost(jh, opts.User))
+	}
+
+	if err := c.setAuth(opts); err != nil {
+		c.closeAgent()
+		return nil, err
+	}
+	if err := c.setHostKeyCallbacks(opts); err != nil {
+		c.closeAgent()
+		return nil, err
+	}
+
+	if err := c.dial(); err != nil {
+		c.closeAgent()
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseJumpHost parses jump host in the ProxyJump format `[user@]host[:port]`
+func parseJumpHost(s, defaultUser string) jumpHost {
+	jh := jumpHost{user: defaultUser}
+	if u, h, ok := strings.Cut(s, "@"); ok {
+		jh.user, s = u, h
+	}
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		s = net.JoinHostPort(strings.Trim(s, "[]"), "22")
+	}
+	jh.addr = s
+	return jh
+}
+
+func (c *connection) setAuth(opts Opts) error {
+	if opts.Password != "" {
+		c.config.Auth = append(c.config.Auth, ssh.Password(opts.Password))
+	}
+
+	if opts.KeyFile != "" {
+		key, err := os.ReadFile(opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read private key file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		var pmErr *ssh.PassphraseMissingError
+		if errors.As(err, &pmErr) {
+			if opts.KeyPassphrase == "" {
+				return fmt.Errorf("private key file is encrypted, key passphrase required")
+			}
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(opts.KeyPassphrase))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse private key file: %w", err)
+		}
+		c.config.Auth = append(c.config.Auth, ssh.PublicKeys(signer))
+	}
+
+	if opts.UseAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return fmt.Errorf("ssh-agent auth enabled but SSH_AUTH_SOCK isn't set")
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return fmt.Errorf("failed to connect to ssh-agent: %w", err)
+		}
+		c.agent = conn
+		c.config.Auth = append(c.config.Auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+
+	if len(c.config.Auth) == 0 {
+		return fmt.Errorf("no auth methods configured, set a password, a key file or enable ssh-agent auth")
+	}
+	return nil
+}
+
+// setHostKeyCallbacks sets verification of the host keys. The pinned fingerprint is checked for the storage host only,
+// jump hosts are always checked with the known_hosts file
+func (c *connection) setHostKeyCallbacks(opts Opts) error {
+	if opts.InsecureIgnoreHostKey {
+		c.config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		c.jumpHKCb = ssh.InsecureIgnoreHostKey()
+		return nil
+	}
+
+	khFile := opts.KnownHostsFile
+	if khFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			khFile = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		if _, err := os.Stat(khFile); err != nil {
+			khFile = ""
+		}
+	}
+
+	var khCb ssh.HostKeyCallback
+	if khFile != "" {
+		cb, err := knownhosts.New(khFile)
+		if err != nil {
+			return fmt.Errorf("failed to read known hosts file: %w", err)
+		}
+		khCb = cb
+	}
+
+	switch {
+	case opts.HostKeyFingerprint != "":
+		c.config.HostKeyCallback = fingerprintCallback(opts.HostKeyFingerprint)
+	case khCb != nil:
+		c.config.HostKeyCallback = khCb
+	default:
+		return fmt.Errorf("host key verification isn't configured, set `known_hosts_file` or `host_key_fingerprint`")
+	}
+
+	if len(c.jumps) > 0 {
+		if khCb == nil {
+			return fmt.Errorf("jump hosts keys can be verified only with the known hosts file, set `known_hosts_file`")
+		}
+		c.jumpHKCb = khCb
+	}
+	return nil
+}
+
+// fingerprintCallback checks the host key fingerprint in the `SHA256:...` or the legacy MD5 `xx:xx:...` format
+func fingerprintCallback(fp string) ssh.HostKeyCallback {
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		if fp == ssh.FingerprintSHA256(key) || strings.TrimPrefix(fp, "MD5:") == ssh.FingerprintLegacyMD5(key) {
+			return nil
+		}
+		return fmt.Errorf("host key fingerprint mismatch for %s: got %s", hostname, ssh.FingerprintSHA256(key))
+	}
+}
+
+// dial establishes the SSH connection through the jump hosts and starts the SFTP session
+func (c *connection) dial() error {
+	var (
+		clients []*ssh.Client
+		client  *ssh.Client
+		err     error
+	)
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			_ = clients[i].Close()
+		}
+	}
+
+	hops := append(slices.Clone(c.jumps), jumpHost{user: c.config.User, addr: c.addr})
+	for i, h := range hops {
+		cfg := *c.config
+		cfg.User = h.user
+		if i < len(hops)-1 {
+			cfg.HostKeyCallback = c.jumpHKCb
+		}
+
+		if client == nil {
+			client, err = ssh.Dial("tcp", h.addr, &cfg)
+		} else {
+			client, err = dialThrough(client, h.addr, &cfg)
+		}
+		if err != nil {
+			closeAll()
+			if i < len(hops)-1 {
+				return fmt.Errorf("couldn't connect SSH jump host %s: %w", h.addr, err)
+			}
+			return fmt.Errorf("couldn't connect SSH: %w", err)
+		}
+		clients = append(clients, client)
+	}
+
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		closeAll()
+		return fmt.Errorf("couldn't initialise SFTP: %w", err)
+	}
+
+	c.clients = clients
+	c.sftp = sftpClient
+	c.lost = false
+	c.done = make(chan struct{})
+
+	go c.watch(client, c.done)
+	if c.keepalive > 0 {
+		go c.keepAlive(client, c.done)
+	}
+	return nil
+}
+
+func dialThrough(via *ssh.Client, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	sc, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(sc, chans, reqs), nil
+}
+
+// watch marks the connection as lost when the SSH connection is closed
+func (c *connection) watch(client *ssh.Client, done chan struct{}) {
+	_ = client.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-done:
+		// the connection was closed or replaced
+	default:
+		c.lost = true
+	}
+}
+
+// keepAlive sends keepalive requests and closes the connection if the server doesn't respond
+func (c *connection) keepAlive(client *ssh.Client, done chan struct{}) {
+	t := time.NewTicker(c.keepalive)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			if err := ping(client, c.keepalive); err != nil {
+				_ = client.Close()
+				return
+			}
+		}
+	}
+}
+
+func ping(client *ssh.Client, timeout time.Duration) error {
+	res := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		res <- err
+	}()
+	select {
+	case err := <-res:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("keepalive timeout")
+	}
+}
+
+// client returns the SFTP client, the connection is re-established if it was lost
+func (c *connection) client() (*sftp.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lost {
+		c.closeClients()
+		if err := c.dial(); err != nil {
+			return c.sftp, err
+		}
+	}
+	return c.sftp, nil
+}
+
+// ensure checks the connection and re-establishes it if the server doesn't respond
+func (c *connection) ensure() error {
+	c.mu.Lock()
+	if !c.lost {
+		client := c.clients[len(c.clients)-1]
+		timeout := c.config.Timeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		if err := ping(client, timeout); err != nil {
+			_ = client.Close()
+			c.lost = true
+		}
+	}
+	c.mu.Unlock()
+
+	_, err := c.client()
+	return err
+}
+
+func (c *connection) closeClients() {
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	_ = c.sftp.Close()
+	for i := len(c.clients) - 1; i >= 0; i-- {
+		_ = c.clients[i].Close()
+	}
+}
+
+func (c *connection) closeAgent() {
+	if c.agent != nil {
+		_ = c.agent.Close()
+	}
+}
+
+func (c *connection) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closeClients()
+	c.closeAgent()
+	return nil
+}
@@ -8,16 +8,9 @@ import (
 	"io/fs"
 	"os"
 	"path"
-	"path/filepath"
-	"regexp"
-	"sort"
-	"strconv"
-	"strings"
 	"time"
 
-	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/sftp"
-	"golang.org/x/crypto/ssh"
 
 	"github.com/nixys/nxs-backup/interfaces"
 	"github.com/nixys/nxs-backup/misc"
@@ -27,79 +20,69 @@ import (
 )
 
 type SFTP struct {
-	client        *sftp.Client
+	conn          *connection
+	retry         RetryPolicy
 	name          string
 	backupPath    string
 	rateLimit     int64
+	volumeSize    int64
 	rotateEnabled bool
 	Retention
 }
 
 type Opts struct {
-	User           string
-	Host           string
-	Port           int
-	Password       string
-	KeyFile        string
-	ConnectTimeout time.Duration
+	User                  string
+	Host                  string
+	Port                  int
+	Password              string
+	KeyFile               string
+	KeyPassphrase         string
+	UseAgent              bool
+	KnownHostsFile        string
+	HostKeyFingerprint    string
+	InsecureIgnoreHostKey bool
+	JumpHosts             []string
+	KeepaliveInterval     time.Duration
+	ConnectTimeout        time.Duration
 }
 
-func Init(name string, opts Opts, rl int64) (*SFTP, error) {
+func Init(name string, opts Opts, rl int64, retry RetryPolicy) (*SFTP, error) {
 
-	sshConfig := &ssh.ClientConfig{
-		User:            opts.User,
-		Auth:            []ssh.AuthMethod{},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         opts.ConnectTimeout * time.Second,
-		ClientVersion:   "SSH-2.0-" + "nxs-backup/" + misc.VERSION,
-	}
-
-	if opts.Password != "" {
-		sshConfig.Auth = append(sshConfig.Auth, ssh.Password(opts.Password))
-	}
-
-	// Load key file if specified
-	if opts.KeyFile != "" {
-		key, err := os.ReadFile(opts.KeyFile)
-		if err != nil {
-			return nil, fmt.Errorf("Failed to init '%s' SFTP storage. Error: %v ", name, fmt.Errorf("failed to read private key file: %w", err))
-		}
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return nil, fmt.Errorf("Failed to init '%s' SFTP storage. Error: %v ", name, fmt.Errorf("failed to parse private key file: %w", err))
-		}
-		sshConfig.Auth = append(sshConfig.Auth, ssh.PublicKeys(signer))
-	}
-
-	sshConn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", opts.Host, opts.Port), sshConfig)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to init '%s' SFTP storage. Error: %v ", name, fmt.Errorf("couldn't connect SSH: %w", err))
-	}
-
-	sftpClient, err := sftp.NewClient(sshConn)
+	conn, err := newConnection(opts)
 	if err != nil {
-		_ = sshConn.Close()
-		return nil, fmt.Errorf("Failed to init '%s' SFTP storage. Error: %v ", name, fmt.Errorf("couldn't initialise SFTP: %w", err))
+		return nil, fmt.Errorf("Failed to init '%s' SFTP storage. Error: %v ", name, err)
 	}
 
 	return &SFTP{
 		name:      name,
-		client:    sftpClient,
+		conn:      conn,
+		retry:     retry,
 		rateLimit: rl,
 	}, nil
 
 }
 
+// client returns the SFTP client, operations with it fail if the lost connection can't be re-established
+func (s *SFTP) client() *sftp.Client {
+	c, _ := s.conn.client()
+	return c
+}
+
 func (s *SFTP) Configure(p Params) {
 	s.backupPath = p.BackupPath
 	s.rateLimit = p.RateLimit
+	s.volumeSize = p.VolumeSize
 	s.rotateEnabled = p.RotateEnabled
 	s.Retention = p.Retention
 }
 
 func (s *SFTP) IsLocal() int { return 0 }
 
+func (s *SFTP) VolumeSize() int64 { return s.volumeSize }
+
 func (s *SFTP) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFile, ofs, bakType string) (err error) {
+	deliveryLog := logger.Log(jobName, s.name).WithTarget(ofs).WithPhase(logger.PhaseDeliver)
+
 	var (
 		bakDstPath, mtdDstPath string
 		links                  map[string]string
@@ -108,57 +91,54 @@ func (s *SFTP) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFil
 	if bakType == string(misc.IncFiles) {
 		bakDstPath, mtdDstPath, links, err = GetIncBackupDstAndLinks(tmpBackupFile, ofs, s.backupPath)
 	} else {
-		bakDstPath, links, err = GetDescBackupDstAndLinks(tmpBackupFile, ofs, s.backupPath, s.Retention)
+		bakDstPath, links, err = GetDescBackupDstAndLinks(tmpBackupFile, ofs, s.backupPath, s.Retention.WithLastDaily(s, path.Join(s.backupPath, ofs)))
 	}
 	if err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to get destination path and links: '%s'", err)
+		logCh <- deliveryLog.Errorf("Unable to get destination path and links: '%s'", err)
+		return
+	}
+
+	if err = Retry(logCh, deliveryLog, s.retry, nil, func(int) error { return s.conn.ensure() }); err != nil {
+		logCh <- deliveryLog.Errorf("Unable to reconnect: %s", err)
 		return
 	}
 
 	if mtdDstPath != "" {
-		if err = s.deliveryBackupMetadata(logCh, jobName, tmpBackupFile, mtdDstPath); err != nil {
+		if err = s.put(logCh, deliveryLog, tmpBackupFile+".inc", mtdDstPath); err != nil {
+			logCh <- deliveryLog.Errorf("Unable to upload metadata: %s", err)
 			return
 		}
+		logCh <- deliveryLog.Infof("Successfully copied metadata to %s", mtdDstPath)
 	}
 
-	// Make remote directories
-	rmDir := path.Dir(bakDstPath)
-	if err = s.client.MkdirAll(rmDir); err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to create remote directory '%s': '%s'", rmDir, err)
-		return err
-	}
-
-	dstFile, err := s.client.Create(bakDstPath)
+	volumes, err := SplitVolumes(tmpBackupFile, s.volumeSize)
 	if err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to create remote file: %s", err)
-		return err
-	}
-	defer func() { _ = dstFile.Close() }()
-
-	srcFile, err := files.GetLimitedFileReader(tmpBackupFile, s.rateLimit)
-	if err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to open tmp backup: '%s'", err)
-		return err
-	}
-	defer func() { _ = srcFile.Close() }()
-
-	_, err = io.Copy(dstFile, srcFile)
-	if err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to upload file: %s", err)
-		return err
+		logCh <- deliveryLog.Errorf("Unable to split backup into volumes: %s", err)
+		return
 	}
-	logCh <- logger.Log(jobName, s.name).Infof("file %s uploaded", dstFile.Name())
 
-	for dst, src := range links {
-		rmDir = path.Dir(dst)
-		err = s.client.MkdirAll(rmDir)
-		if err != nil {
-			logCh <- logger.Log(jobName, s.name).Errorf("Unable to create remote directory '%s': '%s'", rmDir, err)
+	for _, vol := range volumes {
+		volDst := VolumePath(bakDstPath, vol)
+		if err = s.put(logCh, deliveryLog, vol, volDst); err != nil {
+			logCh <- deliveryLog.Errorf("Unable to upload file: %s", err)
 			return
 		}
-		err = s.client.Symlink(src, dst)
+		logCh <- deliveryLog.Infof("file %s uploaded", volDst)
+	}
+
+	for dst, src := range VolumeLinks(links, tmpBackupFile, volumes) {
+		err = Retry(logCh, deliveryLog, s.retry, s.conn.ensure, func(attempt int) error {
+			if err := s.client().MkdirAll(path.Dir(dst)); err != nil {
+				return fmt.Errorf("unable to create remote directory: %w", err)
+			}
+			if attempt > 1 {
+				// the link may be made before the connection was lost
+				_ = s.client().Remove(dst)
+			}
+			return s.client().Symlink(src, dst)
+		})
 		if err != nil {
-			logCh <- logger.Log(jobName, s.name).Errorf("Unable to create symlink: %s", err)
+			logCh <- deliveryLog.Errorf("Unable to create symlink: %s", err)
 			return
 		}
 	}
@@ -166,254 +146,109 @@ func (s *SFTP) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFil
 	return
 }
 
-func (s *SFTP) deliveryBackupMetadata(logCh chan logger.LogRecord, jobName, tmpBackupFile, mtdDstPath string) error {
-	mtdSrcPath := tmpBackupFile + ".inc"
-
-	// Make remote directories
-	rmDir := path.Dir(mtdDstPath)
-	if err := s.client.MkdirAll(rmDir); err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to create remote directory '%s': '%s'", rmDir, err)
+// put uploads the file with retries to the partial file and renames it after the complete upload.
+// The interrupted upload is resumed from the size of the uploaded part
+func (s *SFTP) put(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, srcPath, dstPath string) error {
+	srcStat, err := os.Stat(srcPath)
+	if err != nil {
 		return err
 	}
 
-	_ = s.client.Remove(mtdDstPath)
-	mtdDst, err := s.client.Create(mtdDstPath)
+	partPath := PartialPath(dstPath)
+	err = Retry(logCh, deliveryLog, s.retry, s.conn.ensure, func(attempt int) error {
+		return s.upload(logCh, deliveryLog, srcPath, partPath, attempt > 1)
+	})
 	if err != nil {
 		return err
 	}
-	defer func() { _ = mtdDst.Close() }()
+	return Retry(logCh, deliveryLog, s.retry, s.conn.ensure, func(int) error {
+		return CommitPartial(s, partPath, dstPath, srcStat.Size())
+	})
+}
 
-	mtdSrc, err := files.GetLimitedFileReader(mtdSrcPath, s.rateLimit)
+func (s *SFTP) upload(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, srcPath, dstPath string, resume bool) error {
+	if err := s.client().MkdirAll(path.Dir(dstPath)); err != nil {
+		return fmt.Errorf("unable to create remote directory: %w", err)
+	}
+
+	srcFile, err := files.GetLimitedFileReader(srcPath, s.rateLimit)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to open tmp backup: %w", err)
 	}
-	defer func() { _ = mtdSrc.Close() }()
+	defer func() { _ = srcFile.Close() }()
 
-	_, err = io.Copy(mtdDst, mtdSrc)
+	srcStat, err := os.Stat(srcPath)
 	if err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to make copy: %s", err)
 		return err
 	}
-	logCh <- logger.Log(jobName, s.name).Infof("Successfully copied metadata to %s", mtdDstPath)
 
-	return nil
-}
-
-func (s *SFTP) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) error {
-	if !s.rotateEnabled {
-		logCh <- logger.Log(job.GetName(), s.name).Debugf("Backup rotate skipped by config.")
-		return nil
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		if fi, err := s.client().Stat(dstPath); err == nil && fi.Size() <= srcStat.Size() {
+			offset = fi.Size()
+			flags = os.O_WRONLY
+		}
 	}
-
-	if job.GetType() == misc.IncFiles {
-		return s.deleteIncBackup(logCh, job.GetName(), ofsPart, full)
-	} else {
-		return s.deleteDescBackup(logCh, job.GetName(), ofsPart, job.IsBackupSafety())
+	if offset == 0 {
+		// don't write through the link left by the previous backups
+		_ = s.client().Remove(dstPath)
 	}
-}
 
-func (s *SFTP) deleteDescBackup(logCh chan logger.LogRecord, jobName, ofsPart string, safety bool) error {
-	type fileLinks struct {
-		wLink string
-		dLink string
+	dstFile, err := s.client().OpenFile(dstPath, flags)
+	if err != nil {
+		return fmt.Errorf("unable to open remote file: %w", err)
 	}
-	var errs *multierror.Error
-	filesMap := make(map[string]*fileLinks, 64)
-	filesToDeleteMap := make(map[string]*fileLinks, 64)
-
-	for _, p := range RetentionPeriodsList {
-		retentionCount, retentionDate := GetRetention(p, s.Retention)
-		if retentionCount == 0 && retentionDate.IsZero() {
-			continue
-		}
+	defer func() { _ = dstFile.Close() }()
 
-		bakDir := path.Join(s.backupPath, ofsPart, p.String())
-		files, err := s.client.ReadDir(bakDir)
-		if err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				continue
-			}
-			logCh <- logger.Log(jobName, s.name).Errorf("Failed to read files in remote directory '%s' with next error: %s", bakDir, err)
+	if offset > 0 {
+		logCh <- deliveryLog.Infof("Resuming upload of '%s' from %d bytes", dstPath, offset)
+		if _, err = dstFile.Seek(offset, io.SeekStart); err != nil {
 			return err
 		}
-
-		for _, file := range files {
-			fPath := path.Join(bakDir, file.Name())
-			if file.Mode()&fs.ModeSymlink != 0 {
-				link, err := s.client.ReadLink(fPath)
-				if err != nil {
-					logCh <- logger.Log(jobName, s.name).Errorf("Failed to read a symlink for file '%s': %s",
-						file, err)
-					errs = multierror.Append(errs, err)
-					continue
-				}
-				linkPath := filepath.Join(bakDir, link)
-
-				if fl, ok := filesMap[linkPath]; ok {
-					switch p {
-					case Weekly:
-						fl.wLink = fPath
-					case Daily:
-						fl.dLink = fPath
-					}
-					filesMap[linkPath] = fl
-				}
-			}
-			filesMap[fPath] = &fileLinks{}
-		}
-
-		if s.Retention.UseCount {
-			sort.Slice(files, func(i, j int) bool {
-				return files[i].ModTime().Before(files[j].ModTime())
-			})
-
-			if !safety {
-				retentionCount--
-			}
-			if retentionCount <= len(files) {
-				files = files[:len(files)-retentionCount]
-			} else {
-				files = files[:0]
-			}
-		} else {
-			i := 0
-			for _, file := range files {
-				if file.ModTime().Location() != retentionDate.Location() {
-					retentionDate = retentionDate.In(file.ModTime().Location())
-				}
-
-				if file.ModTime().Before(retentionDate) {
-					files[i] = file
-					i++
-				}
-			}
-			files = files[:i]
-		}
-
-		for _, file := range files {
-			if file.Name() == ".." || file.Name() == "." {
-				continue
-			}
-			fPath := path.Join(bakDir, file.Name())
-			filesToDeleteMap[fPath] = filesMap[fPath]
+		if _, err = srcFile.Seek(offset, io.SeekStart); err != nil {
+			return err
 		}
 	}
 
-	for file, fl := range filesToDeleteMap {
-		delFile := true
-		moved := false
-		if fl.wLink != "" {
-			if _, toDel := filesToDeleteMap[fl.wLink]; !toDel {
-				delFile = false
-				if err := s.moveFile(file, fl.wLink); err != nil {
-					logCh <- logger.Log(jobName, s.name).Error(err)
-					errs = multierror.Append(errs, err)
-				} else {
-					logCh <- logger.Log(jobName, s.name).Debugf("Successfully moved old backup to %s", fl.wLink)
-					moved = true
-				}
-				if _, toDel = filesToDeleteMap[fl.dLink]; !toDel {
-					if err := s.client.Remove(fl.dLink); err != nil {
-						logCh <- logger.Log(jobName, s.name).Error(err)
-						errs = multierror.Append(errs, err)
-						break
-					}
-					relative, _ := filepath.Rel(filepath.Dir(fl.dLink), fl.wLink)
-					if err := s.client.Symlink(relative, fl.dLink); err != nil {
-						logCh <- logger.Log(jobName, s.name).Error(err)
-						errs = multierror.Append(errs, err)
-					} else {
-						logCh <- logger.Log(jobName, s.name).Debugf("Successfully changed symlink %s", fl.dLink)
-					}
-				}
-			}
-		}
-		if fl.dLink != "" && !moved {
-			if _, toDel := filesToDeleteMap[fl.dLink]; !toDel {
-				delFile = false
-				if err := s.moveFile(file, fl.dLink); err != nil {
-					logCh <- logger.Log(jobName, s.name).Error(err)
-					errs = multierror.Append(errs, err)
-				} else {
-					logCh <- logger.Log(jobName, s.name).Debugf("Successfully moved old backup to %s", fl.dLink)
-				}
-			}
-		}
-
-		if delFile {
-			if err := s.client.Remove(file); err != nil {
-				logCh <- logger.Log(jobName, s.name).Errorf("Failed to delete file '%s' with next error: %s",
-					file, err)
-				errs = multierror.Append(errs, err)
-			} else {
-				logCh <- logger.Log(jobName, s.name).Infof("Deleted old backup file '%s'", file)
-			}
-		}
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		return err
 	}
-
-	return errs.ErrorOrNil()
+	return dstFile.Close()
 }
 
-func (s *SFTP) deleteIncBackup(logCh chan logger.LogRecord, jobName, ofsPart string, full bool) error {
-	var errs *multierror.Error
+func (s *SFTP) GetDeliveryPlan(tmpBackupFile, ofs, bakType string) (*DeliveryPlan, error) {
+	return GetLinksDeliveryPlan(s.GetName(), tmpBackupFile, ofs, bakType, s.backupPath, s.Retention.WithLastDaily(s, path.Join(s.backupPath, ofs)), s.volumeSize)
+}
 
-	if full {
-		backupDir := path.Join(s.backupPath, ofsPart)
-		if err := s.client.Remove(backupDir); err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				logCh <- logger.Log(jobName, s.name).Debugf("Directory '%s' not exist. Skipping delete.", backupDir)
-				return nil
-			}
-			logCh <- logger.Log(jobName, s.name).Errorf("Failed to delete '%s' with next error: %s", backupDir, err)
-			errs = multierror.Append(errs, err)
-		}
-	} else {
-		intMoy, _ := strconv.Atoi(misc.GetDateTimeNow("moy"))
-		lastMonth := intMoy - s.Months
-
-		var year string
-		if lastMonth > 0 {
-			year = misc.GetDateTimeNow("year")
-		} else {
-			year = misc.GetDateTimeNow("previous_year")
-			lastMonth += 12
-		}
+func (s *SFTP) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) (RotationStats, error) {
+	return DeleteOldBackups(logCh, s, s.rotationOpts(ofsPart, job, full))
+}
 
-		backupDir := path.Join(s.backupPath, ofsPart, year)
+func (s *SFTP) GetRotationPlan(ofsPart string, job interfaces.Job, full bool) (*RotationPlan, error) {
+	return PlanRotation(s, s.rotationOpts(ofsPart, job, full))
+}
 
-		dirs, err := s.client.ReadDir(backupDir)
-		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				logCh <- logger.Log(jobName, s.name).Debugf("Directory '%s' not exist. Skipping rotate.", backupDir)
-				return nil
-			}
-			logCh <- logger.Log(jobName, s.name).Errorf("Failed to get access to directory '%s' with next error: %v", backupDir, err)
-			return err
-		}
-		rx := regexp.MustCompile(`month_\d\d`)
-		for _, dir := range dirs {
-			dirName := dir.Name()
-			if rx.MatchString(dirName) {
-				dirParts := strings.Split(dirName, "_")
-				dirMonth, _ := strconv.Atoi(dirParts[1])
-				if dirMonth < lastMonth {
-					if err = s.client.Remove(path.Join(backupDir, dirName)); err != nil {
-						logCh <- logger.Log(jobName, s.name).Errorf("Failed to delete '%s' in dir '%s' with next error: %s",
-							dirName, backupDir, err)
-						errs = multierror.Append(errs, err)
-					} else {
-						logCh <- logger.Log(jobName, s.name).Infof("Deleted old backup '%s' in directory '%s'", dirName, backupDir)
-					}
-				}
-			}
-		}
+func (s *SFTP) rotationOpts(ofsPart string, job interfaces.Job, full bool) RotationOpts {
+	return RotationOpts{
+		JobName:     job.GetName(),
+		StorageName: s.GetName(),
+		BackupPath:  s.backupPath,
+		Ofs:         ofsPart,
+		Enabled:     s.rotateEnabled,
+		Retention:   s.Retention,
+		IncBackup:   job.GetType() == misc.IncFiles,
+		Full:        full,
+		Safety:      job.IsBackupSafety(),
 	}
-
-	return errs.ErrorOrNil()
 }
 
 func (s *SFTP) GetFileReader(ofsPath string) (io.Reader, error) {
-	f, err := s.client.Open(path.Join(s.backupPath, ofsPath))
+	if r, err := ReadVolumes(s, path.Join(s.backupPath, ofsPath)); !errors.Is(err, fs.ErrNotExist) {
+		return r, err
+	}
+
+	f, err := s.client().Open(path.Join(s.backupPath, ofsPath))
 	if err != nil {
 		return nil, err
 	}
@@ -428,12 +263,10 @@ func (s *SFTP) GetFileReader(ofsPath string) (io.Reader, error) {
 	return bytes.NewReader(buf), err
 }
 
-func (s *SFTP) ListBackups(filePath string) (fl []string, err error) {
-	walker := s.client.Walk(path.Join(s.backupPath, filePath))
+func (s *SFTP) ListBackups(filePath string) (fl []BackupFile, err error) {
+	walker := s.client().Walk(path.Join(s.backupPath, filePath))
 
-	next := true
-	for next {
-		next = walker.Step()
+	for walker.Step() {
 		err = walker.Err()
 		if err != nil {
 			if errors.Is(err, fs.ErrNotExist) {
@@ -441,16 +274,74 @@ func (s *SFTP) ListBackups(filePath string) (fl []string, err error) {
 			}
 			return
 		}
-		if !walker.Stat().IsDir() {
-			fl = append(fl, walker.Path())
+		if fi := walker.Stat(); !fi.IsDir() {
+			fl = append(fl, NewBackupFile(walker.Path(), fi.Size(), fi.ModTime()))
 		}
 	}
 
-	return
+	return GroupVolumes(fl), nil
+}
+
+// FreeSpace requires the `statvfs@openssh.com` extension supported by the server
+func (s *SFTP) FreeSpace(p string) (int64, error) {
+	st, err := s.client().StatVFS(p)
+	if err != nil {
+		return 0, err
+	}
+	return int64(st.Frsize * st.Bavail), nil
+}
+
+func (s *SFTP) Stat(p string) (fs.FileInfo, error) {
+	return s.client().Lstat(p)
+}
+
+func (s *SFTP) ReadDir(p string) ([]fs.FileInfo, error) {
+	return s.client().ReadDir(p)
+}
+
+func (s *SFTP) Open(p string) (io.ReadCloser, error) {
+	return s.client().Open(p)
+}
+
+func (s *SFTP) Put(p string, r io.Reader, _ int64) error {
+	if err := s.client().MkdirAll(path.Dir(p)); err != nil {
+		return err
+	}
+
+	dst, err := s.client().Create(p)
+	if err != nil {
+		return err
+	}
+
+	if _, err = dst.ReadFrom(files.GetLimitedReader(r, s.rateLimit)); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func (s *SFTP) Remove(p string) error {
+	return s.client().Remove(p)
+}
+
+func (s *SFTP) RemoveAll(p string) error {
+	return s.client().RemoveAll(p)
+}
+
+func (s *SFTP) Readlink(p string) (string, error) {
+	return s.client().ReadLink(p)
+}
+
+func (s *SFTP) Symlink(oldname, newname string) error {
+	return s.client().Symlink(oldname, newname)
+}
+
+func (s *SFTP) Rename(oldpath, newpath string) error {
+	return s.client().Rename(oldpath, newpath)
 }
 
 func (s *SFTP) Close() error {
-	return s.client.Close()
+	return s.conn.close()
 }
 
 func (s *SFTP) Clone() interfaces.Storage {
@@ -458,16 +349,10 @@ func (s *SFTP) Clone() interfaces.Storage {
 	return &cl
 }
 
-func (s *SFTP) GetName() string {
-	return s.name
+func (s *SFTP) BackupPath() string {
+	return s.backupPath
 }
 
-func (s *SFTP) moveFile(oldPath, newPath string) error {
-	if err := s.client.Remove(newPath); err != nil {
-		return fmt.Errorf("Failed to delete file '%s' with next error: %s ", oldPath, err)
-	}
-	if err := s.client.Rename(oldPath, newPath); err != nil {
-		return fmt.Errorf("Failed to move file '%s' with next error: %s ", oldPath, err)
-	}
-	return nil
+func (s *SFTP) GetName() string {
+	return s.name
 }
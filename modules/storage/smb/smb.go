@@ -2,20 +2,16 @@ package smb
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net"
 	"os"
 	"path"
-	"path/filepath"
-	"regexp"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/hashicorp/go-multierror"
 	"github.com/hirochachacha/go-smb2"
 
 	"github.com/nixys/nxs-backup/interfaces"
@@ -28,9 +24,12 @@ import (
 type SMB struct {
 	session       *smb2.Session
 	share         *smb2.Share
+	opts          Opts
+	retry         RetryPolicy
 	name          string
 	backupPath    string
 	rateLimit     int64
+	volumeSize    int64
 	rotateEnabled bool
 	Retention
 }
@@ -45,54 +44,80 @@ type Opts struct {
 	ConnectionTimeout time.Duration
 }
 
-func Init(sName string, params Opts, rl int64) (s *SMB, err error) {
+func Init(sName string, params Opts, rl int64, retry RetryPolicy) (s *SMB, err error) {
 	s = &SMB{
 		name:      sName,
+		opts:      params,
+		retry:     retry,
 		rateLimit: rl,
 	}
 
+	if err = s.connect(); err != nil {
+		return s, fmt.Errorf("Failed to init '%s' SMB storage. Error: %v ", sName, err)
+	}
+
+	return
+}
+
+func (s *SMB) connect() error {
 	conn, err := net.DialTimeout(
 		"tcp",
 		fmt.Sprintf(
 			"%s:%d",
-			params.Host,
-			params.Port,
+			s.opts.Host,
+			s.opts.Port,
 		),
-		params.ConnectionTimeout*time.Second,
+		s.opts.ConnectionTimeout*time.Second,
 	)
 	if err != nil {
-		return s, fmt.Errorf("Failed to init '%s' SMB storage. Error: %v ", sName, err)
+		return err
 	}
 
-	s.session, err = (&smb2.Dialer{
+	session, err := (&smb2.Dialer{
 		Initiator: &smb2.NTLMInitiator{
-			User:     params.User,
-			Password: params.Password,
-			Domain:   params.Domain,
+			User:     s.opts.User,
+			Password: s.opts.Password,
+			Domain:   s.opts.Domain,
 		},
 	}).Dial(conn)
 	if err != nil {
-		return s, err
+		_ = conn.Close()
+		return err
 	}
 
-	s.share, err = s.session.Mount(params.Share)
+	share, err := session.Mount(s.opts.Share)
 	if err != nil {
-		return s, fmt.Errorf("Failed to init '%s' SMB storage. Error: %v ", sName, err)
+		_ = session.Logoff()
+		return err
 	}
 
-	return
+	s.session, s.share = session, share
+	return nil
+}
+
+// reconnect drops the current session and establishes the new one
+func (s *SMB) reconnect() error {
+	if s.session != nil {
+		_ = s.share.Umount()
+		_ = s.session.Logoff()
+	}
+	return s.connect()
 }
 
 func (s *SMB) Configure(p Params) {
 	s.backupPath = strings.TrimPrefix(p.BackupPath, "/")
 	s.rateLimit = p.RateLimit
+	s.volumeSize = p.VolumeSize
 	s.rotateEnabled = p.RotateEnabled
 	s.Retention = p.Retention
 }
 
 func (s *SMB) IsLocal() int { return 0 }
 
+func (s *SMB) VolumeSize() int64 { return s.volumeSize }
+
 func (s *SMB) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFile, ofs, bakType string) (err error) {
+	deliveryLog := logger.Log(jobName, s.name).WithTarget(ofs).WithPhase(logger.PhaseDeliver)
 
 	var (
 		bakDstPath, mtdDstPath string
@@ -102,35 +127,47 @@ func (s *SMB) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFile
 	if bakType == string(misc.IncFiles) {
 		bakDstPath, mtdDstPath, links, err = GetIncBackupDstAndLinks(tmpBackupFile, ofs, s.backupPath)
 	} else {
-		bakDstPath, links, err = GetDescBackupDstAndLinks(tmpBackupFile, ofs, s.backupPath, s.Retention)
+		bakDstPath, links, err = GetDescBackupDstAndLinks(tmpBackupFile, ofs, s.backupPath, s.Retention.WithLastDaily(s, path.Join(s.backupPath, ofs)))
 	}
 	if err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to get destination path and links: '%s'", err)
+		logCh <- deliveryLog.Errorf("Unable to get destination path and links: '%s'", err)
 		return
 	}
 
 	if mtdDstPath != "" {
-		if err = s.copy(logCh, jobName, tmpBackupFile+".inc", bakDstPath); err != nil {
-			logCh <- logger.Log(jobName, s.name).Errorf("Unable to upload tmp backup")
+		if err = s.copy(logCh, deliveryLog, tmpBackupFile+".inc", bakDstPath); err != nil {
+			logCh <- deliveryLog.Errorf("Unable to upload tmp backup")
 			return
 		}
 	}
 
-	if err = s.copy(logCh, jobName, tmpBackupFile, bakDstPath); err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to upload tmp backup")
+	volumes, err := SplitVolumes(tmpBackupFile, s.volumeSize)
+	if err != nil {
+		logCh <- deliveryLog.Errorf("Unable to split backup into volumes: %s", err)
 		return
 	}
 
-	for dst, src := range links {
-		remDir := path.Dir(dst)
-		err = s.share.MkdirAll(remDir, os.ModeDir)
-		if err != nil {
-			logCh <- logger.Log(jobName, s.name).Errorf("Unable to create remote directory '%s': '%s'", remDir, err)
-			return err
+	for _, vol := range volumes {
+		if err = s.copy(logCh, deliveryLog, vol, VolumePath(bakDstPath, vol)); err != nil {
+			logCh <- deliveryLog.Errorf("Unable to upload tmp backup")
+			return
 		}
-		err = s.share.Symlink(src, dst)
+	}
+
+	for dst, src := range VolumeLinks(links, tmpBackupFile, volumes) {
+		err = Retry(logCh, deliveryLog, s.retry, s.reconnect, func(attempt int) error {
+			remDir := path.Dir(dst)
+			if err := s.share.MkdirAll(remDir, os.ModeDir); err != nil {
+				return fmt.Errorf("unable to create remote directory '%s': %w", remDir, err)
+			}
+			if attempt > 1 {
+				// the link may be made before the connection was lost
+				_ = s.share.Remove(dst)
+			}
+			return s.share.Symlink(src, dst)
+		})
 		if err != nil {
-			logCh <- logger.Log(jobName, s.name).Errorf("Unable to make symlink: %s", err)
+			logCh <- deliveryLog.Errorf("Unable to make symlink: %s", err)
 			return err
 		}
 	}
@@ -138,246 +175,111 @@ func (s *SMB) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFile
 	return nil
 }
 
-func (s *SMB) copy(logCh chan logger.LogRecord, jobName, srcPath, dstPath string) (err error) {
-	// Make remote directories
-	remDir := path.Dir(dstPath)
-	if err = s.share.MkdirAll(remDir, os.ModeDir); err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to create remote directory '%s': '%s'", remDir, err)
-		return
-	}
-
-	dstFile, err := s.share.Create(dstPath)
+func (s *SMB) copy(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, srcPath, dstPath string) error {
+	srcStat, err := os.Stat(srcPath)
 	if err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to create remote file: %s", err)
-		return
+		logCh <- deliveryLog.Errorf("Unable to open '%s'", err)
+		return err
 	}
-	defer func() { _ = dstFile.Close() }()
 
-	srcFile, err := files.GetLimitedFileReader(srcPath, s.rateLimit)
-	if err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to open '%s'", err)
-		return
+	partPath := PartialPath(dstPath)
+	err = Retry(logCh, deliveryLog, s.retry, s.reconnect, func(attempt int) error {
+		return s.upload(logCh, deliveryLog, srcPath, partPath, attempt > 1)
+	})
+	if err == nil {
+		err = Retry(logCh, deliveryLog, s.retry, s.reconnect, func(int) error {
+			return CommitPartial(s, partPath, dstPath, srcStat.Size())
+		})
 	}
-	defer func() { _ = srcFile.Close() }()
-
-	_, err = io.Copy(dstFile, srcFile)
 	if err != nil {
-		logCh <- logger.Log(jobName, s.name).Errorf("Unable to make copy: %s", err)
+		logCh <- deliveryLog.Errorf("Unable to make copy: %s", err)
 	} else {
-		logCh <- logger.Log(jobName, s.name).Infof("File %s successfully uploaded", dstPath)
+		logCh <- deliveryLog.Infof("File %s successfully uploaded", dstPath)
 	}
-	return
+	return err
 }
 
-func (s *SMB) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) error {
-	if !s.rotateEnabled {
-		logCh <- logger.Log(job.GetName(), s.name).Debugf("Backup rotate skipped by config.")
-		return nil
+// upload writes the file, the interrupted upload is resumed from the size of the uploaded part
+func (s *SMB) upload(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, srcPath, dstPath string, resume bool) error {
+	// Make remote directories
+	remDir := path.Dir(dstPath)
+	if err := s.share.MkdirAll(remDir, os.ModeDir); err != nil {
+		return fmt.Errorf("unable to create remote directory '%s': %w", remDir, err)
 	}
 
-	if job.GetType() == misc.IncFiles {
-		return s.deleteIncBackup(logCh, job.GetName(), ofsPart, full)
-	} else {
-		return s.deleteDescBackup(logCh, job.GetName(), ofsPart, job.IsBackupSafety())
+	srcFile, err := files.GetLimitedFileReader(srcPath, s.rateLimit)
+	if err != nil {
+		return err
 	}
-}
+	defer func() { _ = srcFile.Close() }()
 
-func (s *SMB) deleteDescBackup(logCh chan logger.LogRecord, jobName, ofsPart string, safety bool) error {
-	type fileLinks struct {
-		wLink string
-		dLink string
+	srcStat, err := os.Stat(srcPath)
+	if err != nil {
+		return err
 	}
-	var errs *multierror.Error
-	filesMap := make(map[string]*fileLinks, 64)
-	filesToDeleteMap := make(map[string]*fileLinks, 64)
-
-	for _, p := range RetentionPeriodsList {
-		retentionCount, retentionDate := GetRetention(p, s.Retention)
-		if retentionCount == 0 && retentionDate.IsZero() {
-			continue
-		}
-
-		bakDir := path.Join(s.backupPath, ofsPart, p.String())
-		smbFiles, err := s.share.ReadDir(bakDir)
-		if err != nil {
-			if os.IsNotExist(err) {
-				continue
-			}
-			logCh <- logger.Log(jobName, s.name).Errorf("Failed to read files in remote directory '%s' with next error: %s", bakDir, err)
-			return err
-		}
-
-		for _, file := range smbFiles {
-			fPath := path.Join(bakDir, file.Name())
-			if file.Mode()&fs.ModeSymlink != 0 {
-				link, err := s.share.Readlink(fPath)
-				if err != nil {
-					logCh <- logger.Log(jobName, s.name).Errorf("Failed to read a symlink for file '%s': %s",
-						file, err)
-					errs = multierror.Append(errs, err)
-					continue
-				}
-				linkPath := filepath.Join(bakDir, link)
-
-				if fl, ok := filesMap[linkPath]; ok {
-					switch p {
-					case Weekly:
-						fl.wLink = fPath
-					case Daily:
-						fl.dLink = fPath
-					}
-					filesMap[linkPath] = fl
-				}
-			}
-			filesMap[fPath] = &fileLinks{}
-		}
 
-		if s.Retention.UseCount {
-			sort.Slice(smbFiles, func(i, j int) bool {
-				return smbFiles[i].ModTime().Before(smbFiles[j].ModTime())
-			})
-
-			if !safety {
-				retentionCount--
-			}
-			if retentionCount <= len(smbFiles) {
-				smbFiles = smbFiles[:len(smbFiles)-retentionCount]
-			} else {
-				smbFiles = smbFiles[:0]
-			}
-		} else {
-			i := 0
-			for _, file := range smbFiles {
-				if file.ModTime().Location() != retentionDate.Location() {
-					retentionDate = retentionDate.In(file.ModTime().Location())
-				}
-
-				if file.ModTime().Before(retentionDate) {
-					smbFiles[i] = file
-					i++
-				}
-			}
-			smbFiles = smbFiles[:i]
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		if fi, err := s.share.Stat(dstPath); err == nil && fi.Size() <= srcStat.Size() {
+			offset = fi.Size()
+			flags = os.O_WRONLY
 		}
+	}
 
-		for _, file := range smbFiles {
-			if file.Name() == ".." || file.Name() == "." {
-				continue
-			}
-
-			fPath := path.Join(bakDir, file.Name())
-			filesToDeleteMap[fPath] = filesMap[fPath]
-		}
+	dstFile, err := s.share.OpenFile(dstPath, flags, 0666)
+	if err != nil {
+		return fmt.Errorf("unable to open remote file: %w", err)
 	}
+	defer func() { _ = dstFile.Close() }()
 
-	for file, fl := range filesToDeleteMap {
-		delFile := true
-		moved := false
-		if fl.wLink != "" {
-			if _, toDel := filesToDeleteMap[fl.wLink]; !toDel {
-				delFile = false
-				if err := s.moveFile(file, fl.wLink); err != nil {
-					logCh <- logger.Log(jobName, s.name).Error(err)
-					errs = multierror.Append(errs, err)
-				} else {
-					logCh <- logger.Log(jobName, s.name).Debugf("Successfully moved old backup to %s", fl.wLink)
-					moved = true
-				}
-				if _, toDel = filesToDeleteMap[fl.dLink]; !toDel {
-					if err := s.share.Remove(fl.dLink); err != nil {
-						logCh <- logger.Log(jobName, s.name).Error(err)
-						errs = multierror.Append(errs, err)
-						break
-					}
-					relative, _ := filepath.Rel(filepath.Dir(fl.dLink), fl.wLink)
-					if err := s.share.Symlink(relative, fl.dLink); err != nil {
-						logCh <- logger.Log(jobName, s.name).Error(err)
-						errs = multierror.Append(errs, err)
-					} else {
-						logCh <- logger.Log(jobName, s.name).Debugf("Successfully changed symlink %s", fl.dLink)
-					}
-				}
-			}
-		}
-		if fl.dLink != "" && !moved {
-			if _, toDel := filesToDeleteMap[fl.dLink]; !toDel {
-				delFile = false
-				if err := s.moveFile(file, fl.dLink); err != nil {
-					logCh <- logger.Log(jobName, s.name).Error(err)
-					errs = multierror.Append(errs, err)
-				} else {
-					logCh <- logger.Log(jobName, s.name).Debugf("Successfully moved old backup to %s", fl.dLink)
-				}
-			}
+	if offset > 0 {
+		logCh <- deliveryLog.Infof("Resuming upload of '%s' from %d bytes", dstPath, offset)
+		if _, err = dstFile.Seek(offset, io.SeekStart); err != nil {
+			return err
 		}
-
-		if delFile {
-			if err := s.share.Remove(file); err != nil {
-				logCh <- logger.Log(jobName, s.name).Errorf("Failed to delete file '%s' with next error: %s",
-					file, err)
-				errs = multierror.Append(errs, err)
-			} else {
-				logCh <- logger.Log(jobName, s.name).Infof("Deleted old backup file '%s'", file)
-			}
+		if _, err = srcFile.Seek(offset, io.SeekStart); err != nil {
+			return err
 		}
 	}
 
-	return errs.ErrorOrNil()
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		return err
+	}
+	return dstFile.Close()
 }
 
-func (s *SMB) deleteIncBackup(logCh chan logger.LogRecord, jobName, ofsPart string, full bool) error {
-	var errs *multierror.Error
-
-	if full {
-		backupDir := path.Join(s.backupPath, ofsPart)
-
-		err := s.share.RemoveAll(backupDir)
-		if err != nil {
-			logCh <- logger.Log(jobName, s.name).Errorf("Failed to delete '%s' with next error: %s", backupDir, err)
-			errs = multierror.Append(errs, err)
-		}
-	} else {
-		intMoy, _ := strconv.Atoi(misc.GetDateTimeNow("moy"))
-		lastMonth := intMoy - s.Months
+func (s *SMB) GetDeliveryPlan(tmpBackupFile, ofs, bakType string) (*DeliveryPlan, error) {
+	return GetLinksDeliveryPlan(s.GetName(), tmpBackupFile, ofs, bakType, s.backupPath, s.Retention.WithLastDaily(s, path.Join(s.backupPath, ofs)), s.volumeSize)
+}
 
-		var year string
-		if lastMonth > 0 {
-			year = misc.GetDateTimeNow("year")
-		} else {
-			year = misc.GetDateTimeNow("previous_year")
-			lastMonth += 12
-		}
+func (s *SMB) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) (RotationStats, error) {
+	return DeleteOldBackups(logCh, s, s.rotationOpts(ofsPart, job, full))
+}
 
-		backupDir := path.Join(s.backupPath, ofsPart, year)
+func (s *SMB) GetRotationPlan(ofsPart string, job interfaces.Job, full bool) (*RotationPlan, error) {
+	return PlanRotation(s, s.rotationOpts(ofsPart, job, full))
+}
 
-		dirs, err := s.share.ReadDir(backupDir)
-		if err != nil {
-			logCh <- logger.Log(jobName, s.name).Errorf("Failed to get access to directory '%s' with next error: %v", backupDir, err)
-			return err
-		}
-		rx := regexp.MustCompile(`month_\d\d`)
-		for _, dir := range dirs {
-			dirName := dir.Name()
-			if rx.MatchString(dirName) {
-				dirParts := strings.Split(dirName, "_")
-				dirMonth, _ := strconv.Atoi(dirParts[1])
-				if dirMonth < lastMonth {
-					if err = s.share.RemoveAll(path.Join(backupDir, dirName)); err != nil {
-						logCh <- logger.Log(jobName, s.name).Errorf("Failed to delete '%s' in dir '%s' with next error: %s",
-							dirName, backupDir, err)
-						errs = multierror.Append(errs, err)
-					} else {
-						logCh <- logger.Log(jobName, s.name).Infof("Deleted old backup '%s' in directory '%s'", dirName, backupDir)
-					}
-				}
-			}
-		}
+func (s *SMB) rotationOpts(ofsPart string, job interfaces.Job, full bool) RotationOpts {
+	return RotationOpts{
+		JobName:     job.GetName(),
+		StorageName: s.GetName(),
+		BackupPath:  s.backupPath,
+		Ofs:         ofsPart,
+		Enabled:     s.rotateEnabled,
+		Retention:   s.Retention,
+		IncBackup:   job.GetType() == misc.IncFiles,
+		Full:        full,
+		Safety:      job.IsBackupSafety(),
 	}
-
-	return errs.ErrorOrNil()
 }
 
 func (s *SMB) GetFileReader(ofsPath string) (io.Reader, error) {
+	if r, err := ReadVolumes(s, path.Join(s.backupPath, ofsPath)); !errors.Is(err, fs.ErrNotExist) {
+		return r, err
+	}
+
 	f, err := s.share.Open(path.Join(s.backupPath, ofsPath))
 	if err != nil {
 		return nil, err
@@ -393,7 +295,7 @@ func (s *SMB) GetFileReader(ofsPath string) (io.Reader, error) {
 	return bytes.NewReader(buf), err
 }
 
-func (s *SMB) ListBackups(ofsPath string) ([]string, error) {
+func (s *SMB) ListBackups(ofsPath string) ([]BackupFile, error) {
 	bPath := path.Join(s.backupPath, ofsPath)
 
 	fl, err := s.listFiles(bPath)
@@ -401,7 +303,12 @@ func (s *SMB) ListBackups(ofsPath string) ([]string, error) {
 		return nil, err
 	}
 
-	return s.listPaths(bPath, fl)
+	list, err := s.listPaths(bPath, fl)
+	if err != nil {
+		return nil, err
+	}
+
+	return GroupVolumes(list), nil
 }
 
 func (s *SMB) listFiles(dstPath string) ([]fs.FileInfo, error) {
@@ -409,7 +316,7 @@ func (s *SMB) listFiles(dstPath string) ([]fs.FileInfo, error) {
 	smbEntries, err := s.share.ReadDir(dstPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			err = fmt.Errorf("%s: %v", dstPath, fs.ErrNotExist)
+			err = fmt.Errorf("%s: %w", dstPath, fs.ErrNotExist)
 		}
 		return nil, err
 	}
@@ -417,13 +324,13 @@ func (s *SMB) listFiles(dstPath string) ([]fs.FileInfo, error) {
 	return smbEntries, nil
 }
 
-func (s *SMB) listPaths(base string, fList []fs.FileInfo) ([]string, error) {
-	var paths []string
+func (s *SMB) listPaths(base string, fList []fs.FileInfo) ([]BackupFile, error) {
+	var paths []BackupFile
 
 	for _, file := range fList {
 		if !file.IsDir() {
 			fp := path.Join(base, file.Name())
-			paths = append(paths, fp)
+			paths = append(paths, NewBackupFile(fp, file.Size(), file.ModTime()))
 		} else {
 			subDir := path.Join(base, file.Name())
 			subDirFiles, err := s.listFiles(subDir)
@@ -441,6 +348,64 @@ func (s *SMB) listPaths(base string, fList []fs.FileInfo) ([]string, error) {
 	return paths, nil
 }
 
+func (s *SMB) FreeSpace(p string) (int64, error) {
+	fi, err := s.share.Statfs(p)
+	if err != nil {
+		return 0, err
+	}
+	// the blocks are allocation units, FragmentSize is the number of sectors in the unit
+	return int64(fi.AvailableBlockCount() * fi.FragmentSize() * fi.BlockSize()), nil
+}
+
+func (s *SMB) Stat(p string) (fs.FileInfo, error) {
+	return s.share.Lstat(p)
+}
+
+func (s *SMB) ReadDir(p string) ([]fs.FileInfo, error) {
+	return s.share.ReadDir(p)
+}
+
+func (s *SMB) Open(p string) (io.ReadCloser, error) {
+	return s.share.Open(p)
+}
+
+func (s *SMB) Put(p string, r io.Reader, _ int64) error {
+	if err := s.share.MkdirAll(path.Dir(p), os.ModeDir); err != nil {
+		return err
+	}
+
+	dst, err := s.share.Create(p)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(dst, files.GetLimitedReader(r, s.rateLimit)); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func (s *SMB) Remove(p string) error {
+	return s.share.Remove(p)
+}
+
+func (s *SMB) RemoveAll(p string) error {
+	return s.share.RemoveAll(p)
+}
+
+func (s *SMB) Readlink(p string) (string, error) {
+	return s.share.Readlink(p)
+}
+
+func (s *SMB) Symlink(oldname, newname string) error {
+	return s.share.Symlink(oldname, newname)
+}
+
+func (s *SMB) Rename(oldpath, newpath string) error {
+	return s.share.Rename(oldpath, newpath)
+}
+
 func (s *SMB) Close() error {
 	_ = s.share.Umount()
 	return s.session.Logoff()
@@ -451,16 +416,10 @@ func (s *SMB) Clone() interfaces.Storage {
 	return &cl
 }
 
-func (s *SMB) GetName() string {
-	return s.name
+func (s *SMB) BackupPath() string {
+	return s.backupPath
 }
 
-func (s *SMB) moveFile(oldPath, newPath string) error {
-	if err := s.share.Remove(newPath); err != nil {
-		return fmt.Errorf("Failed to delete file '%s' with next error: %s ", oldPath, err)
-	}
-	if err := s.share.Rename(oldPath, newPath); err != nil {
-		return fmt.Errorf("Failed to move file '%s' with next error: %s ", oldPath, err)
-	}
-	return nil
+func (s *SMB) GetName() string {
+	return s.name
 }
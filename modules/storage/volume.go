@@ -0,0 +1,402 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ManifestSuffix is added to the name of the backup split into volumes to get the name of its manifest.
+// The manifest is delivered after all volumes, so a volume set without it is incomplete
+const ManifestSuffix = ".manifest"
+
+var volumeRx = regexp.MustCompile(`\.\d{3,}$`)
+
+// VolumeSplitter is implemented by storages that split backups into volumes, the size is 0 if they don't
+type VolumeSplitter interface {
+	VolumeSize() int64
+}
+
+// Manifest describes the backup split into volumes
+type Manifest struct {
+	Name       string         `json:"name"`
+	Size       int64          `json:"size"`
+	VolumeSize int64          `json:"volume_size"`
+	Volumes    []VolumeRecord `json:"volumes"`
+}
+
+// VolumeRecord describes one volume of the backup
+type VolumeRecord struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func VolumeName(name string, n int) string {
+	return fmt.Sprintf("%s.%03d", name, n)
+}
+
+// VolumePath returns the path of the volume or manifest file placed next to the backup file
+func VolumePath(bakPath, volume string) string {
+	return path.Join(path.Dir(bakPath), path.Base(volume))
+}
+
+func IsManifest(p string) bool {
+	return strings.HasSuffix(p, ManifestSuffix)
+}
+
+func IsVolume(p string) bool {
+	return volumeRx.MatchString(p)
+}
+
+// VolumeSetName returns the name of the backup the volume or manifest file belongs to,
+// other files are returned as is
+func VolumeSetName(p string) string {
+	switch {
+	case IsManifest(p):
+		return strings.TrimSuffix(p, ManifestSuffix)
+	case IsVolume(p):
+		return volumeRx.ReplaceAllString(p, "")
+	}
+	return p
+}
+
+// SplitVolumes splits the temp backup file into volumes of the given size and writes the manifest next to them.
+// It returns the files to be delivered with the manifest as the last one, or the backup file itself if the size is 0.
+// The volumes already made with the same size for another storage are reused
+func SplitVolumes(tmpBackupFile string, volumeSize int64) ([]string, error) {
+	if volumeSize <= 0 {
+		return []string{tmpBackupFile}, nil
+	}
+
+	mPath := tmpBackupFile + ManifestSuffix
+	if m, err := readManifestFile(mPath); err == nil && m.VolumeSize == volumeSize {
+		if files, ok := volumeFiles(tmpBackupFile, m); ok {
+			return files, nil
+		}
+	}
+	RemoveVolumes(tmpBackupFile)
+
+	src, err := os.Open(tmpBackupFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = src.Close() }()
+
+	m := Manifest{
+		Name:       path.Base(tmpBackupFile),
+		VolumeSize: volumeSize,
+	}
+	for n := 0; ; n++ {
+		vol, err := writeVolume(src, VolumeName(tmpBackupFile, n), volumeSize)
+		if err != nil {
+			RemoveVolumes(tmpBackupFile)
+			return nil, err
+		}
+		// an empty backup is kept as the single empty volume
+		if vol.Size == 0 && n > 0 {
+			_ = os.Remove(VolumeName(tmpBackupFile, n))
+			break
+		}
+		m.Size += vol.Size
+		m.Volumes = append(m.Volumes, vol)
+		if vol.Size < volumeSize {
+			break
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		RemoveVolumes(tmpBackupFile)
+		return nil, err
+	}
+	if err = os.WriteFile(mPath, data, 0644); err != nil {
+		RemoveVolumes(tmpBackupFile)
+		return nil, err
+	}
+
+	files, _ := volumeFiles(tmpBackupFile, m)
+	return files, nil
+}
+
+// VolumeLinks returns the links to each volume and the manifest instead of the links to the backup file,
+// the links to the metadata files are kept as is
+func VolumeLinks(links map[string]string, tmpBackupFile string, volumes []string) map[string]string {
+	if len(volumes) == 1 && volumes[0] == tmpBackupFile {
+		return links
+	}
+
+	res := make(map[string]string, len(links)*len(volumes))
+	for dst, src := range links {
+		if path.Base(dst) != path.Base(tmpBackupFile) {
+			res[dst] = src
+			continue
+		}
+		for _, vol := range volumes {
+			res[VolumePath(dst, vol)] = VolumePath(src, vol)
+		}
+	}
+	return res
+}
+
+func writeVolume(src io.Reader, volPath string, size int64) (VolumeRecord, error) {
+	vol := VolumeRecord{Name: path.Base(volPath)}
+
+	dst, err := os.Create(volPath)
+	if err != nil {
+		return vol, err
+	}
+	h := sha256.New()
+	vol.Size, err = io.Copy(io.MultiWriter(dst, h), io.LimitReader(src, size))
+	if cErr := dst.Close(); err == nil {
+		err = cErr
+	}
+	vol.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return vol, err
+}
+
+// volumeFiles returns the paths of the volumes and the manifest if all volumes of the manifest exist
+func volumeFiles(tmpBackupFile string, m Manifest) ([]string, bool) {
+	files := make([]string, 0, len(m.Volumes)+1)
+	for _, v := range m.Volumes {
+		p := VolumePath(tmpBackupFile, v.Name)
+		if fi, err := os.Stat(p); err != nil || fi.Size() != v.Size {
+			return nil, false
+		}
+		files = append(files, p)
+	}
+	return append(files, tmpBackupFile+ManifestSuffix), true
+}
+
+// RemoveVolumes removes the volumes and the manifest of the temp backup file
+func RemoveVolumes(tmpBackupFile string) {
+	matches, _ := filepath.Glob(escapeGlob(tmpBackupFile) + ".[0-9][0-9][0-9]*")
+	for _, m := range matches {
+		if IsVolume(m) {
+			_ = os.Remove(m)
+		}
+	}
+	_ = os.Remove(tmpBackupFile + ManifestSuffix)
+}
+
+func escapeGlob(p string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`).Replace(p)
+}
+
+func readManifestFile(p string) (m Manifest, err error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &m)
+	return
+}
+
+// GroupVolumes replaces the volumes and the manifest of each volume set in the list by one backup file
+// named as the backup before the split
+func GroupVolumes(list []BackupFile) []BackupFile {
+	paths := make([]string, 0, len(list))
+	for _, f := range list {
+		paths = append(paths, f.Path)
+	}
+	sets := manifestSets(paths)
+
+	res := make([]BackupFile, 0, len(list))
+	idx := make(map[string]int)
+
+	for _, f := range list {
+		name, ok := volumeSetOf(f.Path, sets)
+		if !ok {
+			res = append(res, f)
+			continue
+		}
+
+		i, ok := idx[name]
+		if !ok {
+			i = len(res)
+			idx[name] = i
+			res = append(res, BackupFile{Path: name, Tier: f.Tier})
+		}
+
+		set := &res[i]
+		set.Size += f.Size
+		if f.ModTime.After(set.ModTime) {
+			set.ModTime = f.ModTime
+		}
+		if f.LockedUntil != nil && (set.LockedUntil == nil || f.LockedUntil.After(*set.LockedUntil)) {
+			set.LockedUntil = f.LockedUntil
+		}
+		if IsVolume(f.Path) {
+			set.Volumes++
+		}
+	}
+
+	return res
+}
+
+// manifestSets returns the names of the backups split into volumes. Only the sets with the manifest are
+// recognized, so files that just have a numeric extension are kept as they are
+func manifestSets(paths []string) map[string]struct{} {
+	sets := make(map[string]struct{})
+	for _, p := range paths {
+		if IsManifest(p) {
+			sets[strings.TrimSuffix(p, ManifestSuffix)] = struct{}{}
+		}
+	}
+	return sets
+}
+
+// volumeSetOf returns the name of the volume set the volume or manifest file belongs to
+func volumeSetOf(p string, sets map[string]struct{}) (string, bool) {
+	if !IsVolume(p) && !IsManifest(p) {
+		return "", false
+	}
+	name := VolumeSetName(p)
+	_, ok := sets[name]
+	return name, ok
+}
+
+// volumeSet is a backup file or a set of volumes with the manifest found in a directory
+type volumeSet struct {
+	name    string
+	files   []fs.FileInfo
+	modTime time.Time
+	isDir   bool
+}
+
+// groupVolumeSets groups the volumes and manifests of the directory files, the set is as new as its newest file.
+// The volumes without the manifest are returned separately, they are left by the interrupted uploads
+func groupVolumeSets(files []fs.FileInfo) (res []volumeSet, orphans []fs.FileInfo) {
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sets := manifestSets(names)
+
+	res = make([]volumeSet, 0, len(files))
+	idx := make(map[string]int)
+
+	for _, f := range files {
+		if f.IsDir() {
+			res = append(res, volumeSet{name: f.Name(), files: []fs.FileInfo{f}, modTime: f.ModTime(), isDir: true})
+			continue
+		}
+
+		name, ok := volumeSetOf(f.Name(), sets)
+		if !ok {
+			if IsVolume(f.Name()) {
+				orphans = append(orphans, f)
+				continue
+			}
+			res = append(res, volumeSet{name: f.Name(), files: []fs.FileInfo{f}, modTime: f.ModTime()})
+			continue
+		}
+		i, ok := idx[name]
+		if !ok {
+			i = len(res)
+			idx[name] = i
+			res = append(res, volumeSet{name: name})
+		}
+		set := &res[i]
+		set.files = append(set.files, f)
+		if f.ModTime().After(set.modTime) {
+			set.modTime = f.ModTime()
+		}
+	}
+
+	return res, orphans
+}
+
+// ReadVolumes returns the reader reassembling the backup split into volumes by its manifest.
+// The size and the checksum of each volume are verified while reading, so the reader fails on a damaged volume.
+// The error matches fs.ErrNotExist if the backup isn't split into volumes
+func ReadVolumes(d Driver, bakPath string) (io.ReadCloser, error) {
+	rc, err := d.Open(bakPath + ManifestSuffix)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest '%s': %w", bakPath+ManifestSuffix, err)
+	}
+	if len(m.Volumes) == 0 {
+		return nil, fmt.Errorf("manifest '%s' has no volumes", bakPath+ManifestSuffix)
+	}
+
+	return &volumeReader{d: d, bakPath: bakPath, volumes: m.Volumes}, nil
+}
+
+type volumeReader struct {
+	d       Driver
+	bakPath string
+	volumes []VolumeRecord
+	cur     io.ReadCloser
+	hash    hash.Hash
+	read    int64
+}
+
+func (r *volumeReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.volumes) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := r.d.Open(VolumePath(r.bakPath, r.volumes[0].Name))
+			if err != nil {
+				return 0, fmt.Errorf("unable to open volume '%s': %w", r.volumes[0].Name, err)
+			}
+			r.cur, r.hash, r.read = rc, sha256.New(), 0
+		}
+
+		n, err := r.cur.Read(p)
+		r.hash.Write(p[:n])
+		r.read += int64(n)
+		if err == io.EOF {
+			err = r.nextVolume()
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// nextVolume closes the read volume and verifies it
+func (r *volumeReader) nextVolume() error {
+	v := r.volumes[0]
+	_ = r.cur.Close()
+	r.cur = nil
+	r.volumes = r.volumes[1:]
+
+	if r.read != v.Size {
+		return fmt.Errorf("size of volume '%s' is %d bytes, expected %d", v.Name, r.read, v.Size)
+	}
+	if sum := hex.EncodeToString(r.hash.Sum(nil)); sum != v.SHA256 {
+		return fmt.Errorf("checksum of volume '%s' mismatch", v.Name)
+	}
+	return nil
+}
+
+func (r *volumeReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
@@ -8,14 +8,8 @@ import (
 	"io/fs"
 	"os"
 	"path"
-	"regexp"
-	"sort"
-	"strconv"
-	"strings"
 	"time"
 
-	"github.com/hashicorp/go-multierror"
-
 	"github.com/nixys/nxs-backup/interfaces"
 	"github.com/nixys/nxs-backup/misc"
 	"github.com/nixys/nxs-backup/modules/backend/files"
@@ -26,9 +20,11 @@ import (
 
 type WebDav struct {
 	client        *webdav.Client
+	retry         RetryPolicy
 	name          string
 	backupPath    string
 	rateLimit     int64
+	volumeSize    int64
 	rotateEnabled bool
 	Retention
 }
@@ -41,7 +37,7 @@ type Opts struct {
 	ConnectionTimeout time.Duration
 }
 
-func Init(name string, params Opts, rl int64) (*WebDav, error) {
+func Init(name string, params Opts, rl int64, retry RetryPolicy) (*WebDav, error) {
 
 	client, err := webdav.Init(webdav.Params{
 		URL:               params.URL,
@@ -57,20 +53,31 @@ func Init(name string, params Opts, rl int64) (*WebDav, error) {
 	return &WebDav{
 		name:      name,
 		client:    client,
+		retry:     retry,
 		rateLimit: rl,
 	}, nil
 }
 
+// reconnect drops the idle connections, the new ones are dialed by the next requests
+func (wd *WebDav) reconnect() error {
+	wd.client.CloseIdleConnections()
+	return nil
+}
+
 func (wd *WebDav) Configure(p Params) {
 	wd.backupPath = path.Join("/", p.BackupPath)
 	wd.rateLimit = p.RateLimit
+	wd.volumeSize = p.VolumeSize
 	wd.rotateEnabled = p.RotateEnabled
 	wd.Retention = p.Retention
 }
 
 func (wd *WebDav) IsLocal() int { return 0 }
 
+func (wd *WebDav) VolumeSize() int64 { return wd.volumeSize }
+
 func (wd *WebDav) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackupFile, ofs, bakType string) (err error) {
+	deliveryLog := logger.Log(jobName, wd.name).WithTarget(ofs).WithPhase(logger.PhaseDeliver)
 
 	var (
 		bakDstPath, mtdDstPath string
@@ -80,35 +87,43 @@ func (wd *WebDav) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackup
 	if bakType == string(misc.IncFiles) {
 		bakDstPath, mtdDstPath, links, err = GetIncBackupDstAndLinks(tmpBackupFile, ofs, wd.backupPath)
 	} else {
-		bakDstPath, links, err = GetDescBackupDstAndLinks(tmpBackupFile, ofs, wd.backupPath, wd.Retention)
+		bakDstPath, links, err = GetDescBackupDstAndLinks(tmpBackupFile, ofs, wd.backupPath, wd.Retention.WithLastDaily(wd, path.Join(wd.backupPath, ofs)))
 	}
 	if err != nil {
-		logCh <- logger.Log(jobName, wd.name).Errorf("Unable to get destination path and links: '%s'", err)
+		logCh <- deliveryLog.Errorf("Unable to get destination path and links: '%s'", err)
 		return
 	}
 
 	if mtdDstPath != "" {
-		if err = wd.copy(logCh, jobName, tmpBackupFile+".inc", bakDstPath); err != nil {
-			logCh <- logger.Log(jobName, wd.name).Errorf("Unable to upload tmp backup")
+		if err = wd.copy(logCh, deliveryLog, tmpBackupFile+".inc", bakDstPath); err != nil {
+			logCh <- deliveryLog.Errorf("Unable to upload tmp backup")
 			return
 		}
 	}
 
-	if err = wd.copy(logCh, jobName, tmpBackupFile, bakDstPath); err != nil {
-		logCh <- logger.Log(jobName, wd.name).Errorf("Unable to upload tmp backup")
+	volumes, err := SplitVolumes(tmpBackupFile, wd.volumeSize)
+	if err != nil {
+		logCh <- deliveryLog.Errorf("Unable to split backup into volumes: %s", err)
 		return
 	}
 
-	for dst, src := range links {
+	for _, vol := range volumes {
+		if err = wd.copy(logCh, deliveryLog, vol, VolumePath(bakDstPath, vol)); err != nil {
+			logCh <- deliveryLog.Errorf("Unable to upload tmp backup")
+			return
+		}
+	}
+
+	for dst, src := range VolumeLinks(links, tmpBackupFile, volumes) {
 		remDir := path.Dir(dst)
 		err = wd.mkDir(path.Dir(dst))
 		if err != nil {
-			logCh <- logger.Log(jobName, wd.name).Errorf("Unable to create remote directory '%s': '%s'", remDir, err)
+			logCh <- deliveryLog.Errorf("Unable to create remote directory '%s': '%s'", remDir, err)
 			return
 		}
 		err = wd.client.Copy(src, dst)
 		if err != nil {
-			logCh <- logger.Log(jobName, wd.name).Errorf("Unable to make copy: %s", err)
+			logCh <- deliveryLog.Errorf("Unable to make copy: %s", err)
 			return
 		}
 	}
@@ -116,157 +131,112 @@ func (wd *WebDav) DeliveryBackup(logCh chan logger.LogRecord, jobName, tmpBackup
 	return
 }
 
-func (wd *WebDav) copy(logCh chan logger.LogRecord, jobName, srcPath, dstPath string) (err error) {
-
-	// Make remote directories
-	remDir := path.Dir(dstPath)
-	if err = wd.mkDir(remDir); err != nil {
-		logCh <- logger.Log(jobName, wd.name).Errorf("Unable to create remote directory '%s': '%s'", remDir, err)
-		return
-	}
-
-	srcFile, err := files.GetLimitedFileReader(srcPath, wd.rateLimit)
+func (wd *WebDav) copy(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, srcPath, dstPath string) (err error) {
+	srcStat, err := os.Stat(srcPath)
 	if err != nil {
-		logCh <- logger.Log(jobName, wd.name).Errorf("Unable to open '%s'", err)
+		logCh <- deliveryLog.Errorf("Unable to open '%s'", err)
 		return
 	}
-	defer func() { _ = srcFile.Close() }()
 
-	err = wd.client.Upload(dstPath, srcFile)
+	partPath := PartialPath(dstPath)
+	err = Retry(logCh, deliveryLog, wd.retry, wd.reconnect, func(attempt int) error {
+		return convertErr(wd.upload(logCh, deliveryLog, srcPath, partPath, attempt > 1))
+	})
+	if err == nil {
+		err = Retry(logCh, deliveryLog, wd.retry, wd.reconnect, func(int) error {
+			return convertErr(CommitPartial(wd, partPath, dstPath, srcStat.Size()))
+		})
+	}
 	if err != nil {
-		logCh <- logger.Log(jobName, wd.name).Errorf("Unable to upload file: %s", err)
+		logCh <- deliveryLog.Errorf("Unable to upload file: %s", err)
 	} else {
-		logCh <- logger.Log(jobName, wd.name).Infof("File %s successfull uploaded", dstPath)
+		logCh <- deliveryLog.Infof("File %s successfull uploaded", dstPath)
 	}
 
 	return err
 }
 
-func (wd *WebDav) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) error {
-	if !wd.rotateEnabled {
-		logCh <- logger.Log(job.GetName(), wd.name).Debugf("Backup rotate skipped by config.")
-		return nil
+// upload puts the file. The interrupted upload is resumed with the partial PUT if the server stored the uploaded part,
+// the file is uploaded again if the server doesn't support partial updates
+func (wd *WebDav) upload(logCh chan logger.LogRecord, deliveryLog logger.LogRecord, srcPath, dstPath string, resume bool) error {
+	// Make remote directories
+	remDir := path.Dir(dstPath)
+	if err := wd.mkDir(remDir); err != nil {
+		return fmt.Errorf("unable to create remote directory '%s': %w", remDir, err)
 	}
 
-	if job.GetType() == misc.IncFiles {
-		return wd.deleteIncBackup(logCh, job.GetName(), ofsPart, full)
-	} else {
-		return wd.deleteDescBackup(logCh, job.GetName(), ofsPart, job.IsBackupSafety())
+	srcFile, err := files.GetLimitedFileReader(srcPath, wd.rateLimit)
+	if err != nil {
+		return err
 	}
-}
-
-func (wd *WebDav) deleteDescBackup(logCh chan logger.LogRecord, jobName, ofsPart string, safety bool) error {
-	var errs *multierror.Error
-
-	for _, p := range RetentionPeriodsList {
-		retentionCount, retentionDate := GetRetention(p, wd.Retention)
-		if retentionCount == 0 && retentionDate.IsZero() {
-			continue
-		}
-
-		bakDir := path.Join(wd.backupPath, ofsPart, p.String())
-		wdFiles, err := wd.client.Ls(bakDir)
-		if err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				continue
-			}
-			logCh <- logger.Log(jobName, wd.name).Errorf("Failed to read files in remote directory '%s' with next error: %s", bakDir, err)
-			return err
-		}
+	defer func() { _ = srcFile.Close() }()
 
-		if wd.Retention.UseCount {
-			sort.Slice(wdFiles, func(i, j int) bool {
-				return wdFiles[i].ModTime().Before(wdFiles[j].ModTime())
-			})
+	srcStat, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
 
-			if !safety {
-				retentionCount--
+	if resume {
+		if fi, err := wd.getInfo(dstPath); err == nil && fi.Size() > 0 && fi.Size() < srcStat.Size() {
+			offset := fi.Size()
+			if _, err = srcFile.Seek(offset, io.SeekStart); err != nil {
+				return err
 			}
-			if retentionCount <= len(wdFiles) {
-				wdFiles = wdFiles[:len(wdFiles)-retentionCount]
-			} else {
-				wdFiles = wdFiles[:0]
+			logCh <- deliveryLog.Infof("Resuming upload of '%s' from %d bytes", dstPath, offset)
+			err = wd.client.UploadRange(dstPath, srcFile, offset, srcStat.Size())
+			var sErr *webdav.StatusError
+			if err != nil && !errors.As(err, &sErr) {
+				return err
 			}
-		} else {
-			i := 0
-			for _, file := range wdFiles {
-				if file.ModTime().Location() != retentionDate.Location() {
-					retentionDate = retentionDate.In(file.ModTime().Location())
-				}
-
-				if file.ModTime().Before(retentionDate) {
-					wdFiles[i] = file
-					i++
+			if err == nil {
+				if fi, err = wd.getInfo(dstPath); err == nil && fi.Size() == srcStat.Size() {
+					return nil
 				}
 			}
-			wdFiles = wdFiles[:i]
-		}
+			logCh <- deliveryLog.Warnf("Server doesn't support resuming of upload of '%s', uploading whole file", dstPath)
 
-		for _, file := range wdFiles {
-			err = wd.client.Rm(path.Join(bakDir, file.Name()))
-			if err != nil {
-				logCh <- logger.Log(jobName, wd.name).Errorf("Failed to delete file '%s' in remote directory '%s' with next error: %s",
-					file.Name(), bakDir, err)
-				errs = multierror.Append(errs, err)
-			} else {
-				logCh <- logger.Log(jobName, wd.name).Infof("Deleted old backup file '%s' in remote directory '%s'", file.Name(), bakDir)
+			if srcFile, err = files.GetLimitedFileReader(srcPath, wd.rateLimit); err != nil {
+				return err
 			}
+			defer func() { _ = srcFile.Close() }()
 		}
 	}
 
-	return errs.ErrorOrNil()
+	return wd.client.Upload(dstPath, srcFile)
 }
 
-func (wd *WebDav) deleteIncBackup(logCh chan logger.LogRecord, jobName, ofsPart string, full bool) error {
-	var errs *multierror.Error
-
-	if full {
-		backupDir := path.Join(wd.backupPath, ofsPart)
+func convertErr(err error) error {
+	var sErr *webdav.StatusError
+	if errors.As(err, &sErr) {
+		return &ServerError{Code: sErr.Code, Err: err}
+	}
+	return err
+}
 
-		err := wd.client.Rm(backupDir)
-		if err != nil {
-			logCh <- logger.Log(jobName, wd.name).Errorf("Failed to delete '%s' with next error: %s", backupDir, err)
-			errs = multierror.Append(errs, err)
-		}
-	} else {
-		intMoy, _ := strconv.Atoi(misc.GetDateTimeNow("moy"))
-		lastMonth := intMoy - wd.Months
+func (wd *WebDav) GetDeliveryPlan(tmpBackupFile, ofs, bakType string) (*DeliveryPlan, error) {
+	return GetCopiesDeliveryPlan(wd.GetName(), tmpBackupFile, ofs, bakType, wd.backupPath, wd.Retention.WithLastDaily(wd, path.Join(wd.backupPath, ofs)), wd.volumeSize), nil
+}
 
-		var year string
-		if lastMonth > 0 {
-			year = misc.GetDateTimeNow("year")
-		} else {
-			year = misc.GetDateTimeNow("previous_year")
-			lastMonth += 12
-		}
+func (wd *WebDav) DeleteOldBackups(logCh chan logger.LogRecord, ofsPart string, job interfaces.Job, full bool) (RotationStats, error) {
+	return DeleteOldBackups(logCh, wd, wd.rotationOpts(ofsPart, job, full))
+}
 
-		backupDir := path.Join(wd.backupPath, ofsPart, year)
+func (wd *WebDav) GetRotationPlan(ofsPart string, job interfaces.Job, full bool) (*RotationPlan, error) {
+	return PlanRotation(wd, wd.rotationOpts(ofsPart, job, full))
+}
 
-		dirs, err := wd.client.Ls(backupDir)
-		if err != nil {
-			logCh <- logger.Log(jobName, wd.name).Errorf("Failed to get access to directory '%s' with next error: %v", backupDir, err)
-			return err
-		}
-		rx := regexp.MustCompile(`month_\d\d`)
-		for _, dir := range dirs {
-			dirName := dir.Name()
-			if rx.MatchString(dirName) {
-				dirParts := strings.Split(dirName, "_")
-				dirMonth, _ := strconv.Atoi(dirParts[1])
-				if dirMonth < lastMonth {
-					if err = wd.client.Rm(path.Join(backupDir, dirName)); err != nil {
-						logCh <- logger.Log(jobName, wd.name).Errorf("Failed to delete '%s' in dir '%s' with next error: %s",
-							dirName, backupDir, err)
-						errs = multierror.Append(errs, err)
-					} else {
-						logCh <- logger.Log(jobName, wd.name).Infof("Deleted old backup '%s' in directory '%s'", dirName, backupDir)
-					}
-				}
-			}
-		}
+func (wd *WebDav) rotationOpts(ofsPart string, job interfaces.Job, full bool) RotationOpts {
+	return RotationOpts{
+		JobName:     job.GetName(),
+		StorageName: wd.GetName(),
+		BackupPath:  wd.backupPath,
+		Ofs:         ofsPart,
+		Enabled:     wd.rotateEnabled,
+		Retention:   wd.Retention,
+		IncBackup:   job.GetType() == misc.IncFiles,
+		Full:        full,
+		Safety:      job.IsBackupSafety(),
 	}
-
-	return errs.ErrorOrNil()
 }
 
 func (wd *WebDav) mkDir(dstPath string) error {
@@ -317,6 +287,10 @@ func (wd *WebDav) getInfo(dstPath string) (os.FileInfo, error) {
 }
 
 func (wd *WebDav) GetFileReader(ofsPath string) (io.Reader, error) {
+	if r, err := ReadVolumes(wd, path.Join(wd.backupPath, ofsPath)); !errors.Is(err, fs.ErrNotExist) {
+		return r, err
+	}
+
 	f, err := wd.client.Read(path.Join(wd.backupPath, ofsPath))
 	if err != nil {
 		return nil, err
@@ -332,7 +306,7 @@ func (wd *WebDav) GetFileReader(ofsPath string) (io.Reader, error) {
 	return bytes.NewReader(buf), err
 }
 
-func (wd *WebDav) ListBackups(ofsPath string) ([]string, error) {
+func (wd *WebDav) ListBackups(ofsPath string) ([]BackupFile, error) {
 	bPath := path.Join(wd.backupPath, ofsPath)
 
 	fl, err := wd.client.Ls(bPath)
@@ -340,16 +314,21 @@ func (wd *WebDav) ListBackups(ofsPath string) ([]string, error) {
 		return nil, err
 	}
 
-	return wd.listPaths(bPath, fl)
+	list, err := wd.listPaths(bPath, fl)
+	if err != nil {
+		return nil, err
+	}
+
+	return GroupVolumes(list), nil
 }
 
-func (wd *WebDav) listPaths(base string, fList []fs.FileInfo) ([]string, error) {
-	var paths []string
+func (wd *WebDav) listPaths(base string, fList []fs.FileInfo) ([]BackupFile, error) {
+	var paths []BackupFile
 
 	for _, file := range fList {
 		if !file.IsDir() {
 			fp := path.Join(base, file.Name())
-			paths = append(paths, fp)
+			paths = append(paths, NewBackupFile(fp, file.Size(), file.ModTime()))
 		} else {
 			subDir := path.Join(base, file.Name())
 			subDirFiles, err := wd.client.Ls(subDir)
@@ -367,6 +346,37 @@ func (wd *WebDav) listPaths(base string, fList []fs.FileInfo) ([]string, error)
 	return paths, nil
 }
 
+func (wd *WebDav) Stat(p string) (fs.FileInfo, error) {
+	return wd.getInfo(p)
+}
+
+func (wd *WebDav) ReadDir(p string) ([]fs.FileInfo, error) {
+	return wd.client.Ls(p)
+}
+
+func (wd *WebDav) Open(p string) (io.ReadCloser, error) {
+	return wd.client.Read(p)
+}
+
+func (wd *WebDav) Put(p string, r io.Reader, _ int64) error {
+	if err := wd.mkDir(path.Dir(p)); err != nil {
+		return err
+	}
+	return wd.client.Upload(p, files.GetLimitedReader(r, wd.rateLimit))
+}
+
+func (wd *WebDav) Rename(oldpath, newpath string) error {
+	return wd.client.Move(oldpath, newpath)
+}
+
+func (wd *WebDav) Remove(p string) error {
+	return wd.client.Rm(p)
+}
+
+func (wd *WebDav) RemoveAll(p string) error {
+	return wd.client.Rm(p)
+}
+
 func (wd *WebDav) Close() error {
 	return nil
 }
@@ -376,6 +386,10 @@ func (wd *WebDav) Clone() interfaces.Storage {
 	return &cl
 }
 
+func (wd *WebDav) BackupPath() string {
+	return wd.backupPath
+}
+
 func (wd *WebDav) GetName() string {
 	return wd.name
 }
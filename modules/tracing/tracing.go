@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/nixys/nxs-backup/misc"
+)
+
+const (
+	tracerName    = "github.com/nixys/nxs-backup"
+	exportTimeout = 5 * time.Second
+)
+
+// Attributes of the spans
+const (
+	AttrRunID   = attribute.Key("nxs_backup.run_id")
+	AttrJobName = attribute.Key("nxs_backup.job.name")
+	AttrJobType = attribute.Key("nxs_backup.job.type")
+	AttrTarget  = attribute.Key("nxs_backup.target")
+	AttrStorage = attribute.Key("nxs_backup.storage")
+	AttrBytes   = attribute.Key("nxs_backup.bytes")
+	AttrDeleted = attribute.Key("nxs_backup.deleted")
+)
+
+type Opts struct {
+	Enabled  bool
+	Protocol string
+	Endpoint string
+	Insecure bool
+	Headers  map[string]string
+	Project  string
+	Server   string
+}
+
+// Provider exports the spans to the OTLP collector
+type Provider struct {
+	tp *sdktrace.TracerProvider
+}
+
+// Init sets up the export of spans to the OTLP collector. The provider is nil if tracing is disabled.
+// Spans are recorded by the provider after it's registered
+func Init(o Opts) (*Provider, error) {
+	if !o.Enabled {
+		return nil, nil
+	}
+
+	var (
+		client otlptrace.Client
+		err    error
+	)
+
+	switch o.Protocol {
+	case "grpc":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(o.Endpoint), otlptracegrpc.WithHeaders(o.Headers), otlptracegrpc.WithTimeout(exportTimeout)}
+		if o.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		client = otlptracegrpc.NewClient(opts...)
+	case "http":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(o.Endpoint), otlptracehttp.WithHeaders(o.Headers), otlptracehttp.WithTimeout(exportTimeout)}
+		if o.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		client = otlptracehttp.NewClient(opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing protocol \"%s\", available protocols: 'grpc', 'http'", o.Protocol)
+	}
+
+	// the connection is established on export, so an unavailable collector doesn't prevent backups
+	exporter, err := otlptrace.New(context.Background(), client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("nxs-backup"),
+		semconv.ServiceVersion(misc.VERSION),
+		semconv.ServiceNamespace(o.Project),
+		semconv.HostName(o.Server),
+	)
+
+	p := &Provider{
+		tp: sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(res),
+		),
+	}
+
+	return p, nil
+}
+
+// Register makes the provider record the spans of the app. Nil provider disables the recording
+func (p *Provider) Register() {
+	if p == nil {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return
+	}
+	// export errors are reported on shutdown instead of being printed to stderr
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(error) {}))
+	otel.SetTracerProvider(p.tp)
+}
+
+// Shutdown exports the remaining spans and stops the provider
+func (p *Provider) Shutdown() error {
+	if p == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	return p.tp.Shutdown(ctx)
+}
+
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records the error of the operation and ends the span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -20,6 +20,18 @@ func Runtime(app appctx.App) error {
 		case <-app.SelfCtxDone():
 			cc.Log.Trace("cmd routine: shutdown")
 			return nil
+		case res := <-cc.ReloadCh:
+			nc, err := cc.Reinit()
+			if err != nil {
+				cc.Log.Errorf("Failed to reload config, the current one is kept: %v", err)
+				res <- err
+				break
+			}
+			app.ValueSet(nc)
+			go cc.Release()
+			cc = nc
+			cc.Log.Info("Config reloaded")
+			res <- nil
 		case err = <-cc.Done:
 			if err != nil {
 				cc.Log.WithFields(logrus.Fields{"details": err}).Errorf("cmd routine fail:")
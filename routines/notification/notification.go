@@ -1,11 +1,16 @@
 package notification
 
 import (
+	"sync"
+	"time"
+
 	appctx "github.com/nixys/nxs-go-appctx/v3"
 
 	"github.com/nixys/nxs-backup/ctx"
 	"github.com/nixys/nxs-backup/interfaces"
 	"github.com/nixys/nxs-backup/modules/logger"
+	"github.com/nixys/nxs-backup/modules/notifier/outbox"
+	"github.com/nixys/nxs-backup/modules/report"
 )
 
 // Runtime executes the routine
@@ -13,21 +18,99 @@ func Runtime(app appctx.App) error {
 	cc := app.ValueGet().(*ctx.Ctx)
 	cc.Log.Trace("notification routine: start")
 
+	collector := report.NewCollector()
+
+	// the logs of the replaced contexts are closed when their notifications are sent
+	var replaced sync.WaitGroup
+
+	ns := outboxNotifiers(cc)
+
+	// notifications queued by previous runs are sent before the new ones
+	var (
+		flushCh <-chan time.Time
+		ticker  *time.Ticker
+	)
+	if cc.FlushOutbox {
+		flush(cc, ns)
+		if cc.FlushInterval > 0 {
+			ticker = time.NewTicker(cc.FlushInterval)
+			flushCh = ticker.C
+		}
+	}
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
 	for {
 		select {
 		case event := <-cc.EventCh:
+			// secrets are masked before the event is written, collected to the report and delivered
+			event = cc.Redactor.RedactRecord(event)
+			if event.JobType == "" {
+				event.JobType = cc.JobTypes[event.JobName]
+			}
 			logger.WriteLog(cc.Log, event)
-			for _, n := range cc.Notifiers {
-				cc.EventsWG.Add(1)
-				go func(n interfaces.Notifier) {
-					n.Send(cc.Log, event)
-					cc.EventsWG.Done()
-				}(n)
+			collector.Collect(event)
+			deliver(cc, outbox.Message{Event: &event})
+		case rep := <-cc.ReportCh:
+			// all events of the run are already collected as they are sent before the report
+			collector.Complete(rep)
+			deliver(cc, outbox.Message{Report: rep})
+		case <-flushCh:
+			flush(cc, ns)
+		case <-app.ValueC():
+			// the config is reloaded, the queued notifications are sent with the new notifiers
+			nc := app.ValueGet().(*ctx.Ctx)
+			for _, prev := range nc.Replaced(cc) {
+				replaced.Add(1)
+				go func() {
+					prev.CloseLog()
+					replaced.Done()
+				}()
+			}
+			cc = nc
+			ns = outboxNotifiers(cc)
+			if ticker != nil {
+				ticker.Stop()
+				ticker, flushCh = nil, nil
+			}
+			if cc.FlushOutbox && cc.FlushInterval > 0 {
+				ticker = time.NewTicker(cc.FlushInterval)
+				flushCh = ticker.C
 			}
 		case <-app.SelfCtxDone():
 			cc.EventsWG.Wait()
+			replaced.Wait()
 			cc.Log.Trace("notification routine: done")
 			return nil
 		}
 	}
 }
+
+func outboxNotifiers(cc *ctx.Ctx) []outbox.Notifier {
+	var ns []outbox.Notifier
+	for _, n := range cc.Notifiers {
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+func deliver(cc *ctx.Ctx, msg outbox.Message) {
+	for _, n := range cc.Notifiers {
+		cc.EventsWG.Add(1)
+		go func(n interfaces.Notifier) {
+			cc.Outbox.Deliver(cc.Log, n, msg)
+			cc.EventsWG.Done()
+		}(n)
+	}
+}
+
+func flush(cc *ctx.Ctx, ns []outbox.Notifier) {
+	cc.EventsWG.Add(1)
+	go func() {
+		cc.Outbox.Flush(cc.Log, ns)
+		cc.EventsWG.Done()
+	}()
+}